@@ -1,3 +1,9 @@
+-- Marks the database as a demo database, destructive actions refuse to run
+-- against databases without it.
+CREATE TABLE IF NOT EXISTS demo_db_marker (
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
 CREATE TABLE timestamp (
     id SERIAL PRIMARY KEY,
     created_at TIMESTAMP NOT NULL
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ackTracker keeps the ids of the rows whose insert the server
+// acknowledged, returned by INSERT ... RETURNING, per table. Comparing them
+// with the rows found at the end of a run proves whether acknowledged rows
+// survived, e.g. a failover. A nil ackTracker runs the inserts without
+// RETURNING.
+type ackTracker struct {
+	mu   sync.Mutex
+	ids  map[string][]int64
+	keys map[string]string
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{ids: map[string][]int64{}, keys: map[string]string{}}
+}
+
+// add records ids of table, whose key column is key.
+func (a *ackTracker) add(table, key string, ids []int64) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys[table] = key
+	a.ids[table] = append(a.ids[table], ids...)
+}
+
+// exec runs an insert into table and records the keys of the inserted rows.
+func (a *ackTracker) exec(ctx context.Context, pool *pgxpool.Pool, table, key, query string, args ...any) error {
+	if a == nil {
+		_, err := pool.Exec(ctx, query, args...)
+		return err
+	}
+	rows, err := pool.Query(ctx, query+" RETURNING "+key, args...)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return err
+	}
+	a.add(table, key, ids)
+	return nil
+}
+
+// ackVerifyBatch is the number of ids looked up per query by verify.
+const ackVerifyBatch = 10000
+
+// verify looks up the acknowledged rows of every table and prints how many
+// were found. Rows deleted by other workloads, e.g. churn, show up as
+// missing too.
+func (a *ackTracker) verify(ctx context.Context, pool *pgxpool.Pool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fmt.Println("Insert acknowledgment report:")
+	lost := 0
+	for _, table := range slices.Sorted(maps.Keys(a.ids)) {
+		ids := a.ids[table]
+		var found int64
+		for chunk := range slices.Chunk(ids, ackVerifyBatch) {
+			var n int64
+			err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s = ANY($1)`, table, a.keys[table]), chunk).Scan(&n)
+			if err != nil {
+				return fmt.Errorf("verifying the acknowledged rows of %s failed: %w", table, err)
+			}
+			found += n
+		}
+		missing := int64(len(ids)) - found
+		status := "all durable"
+		if missing > 0 {
+			status = fmt.Sprintf("%d MISSING", missing)
+			lost++
+		}
+		fmt.Printf("  %-30s acknowledged=%d found=%d %s\n", table, len(ids), found, status)
+	}
+	if lost > 0 {
+		fmt.Printf("  %d tables lost acknowledged rows\n", lost)
+	}
+	return nil
+}
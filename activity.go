@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// activitySampler polls pg_stat_activity and counts the wait events of
+// active sessions per workload phase, a poor man's active session history.
+// A nil sampler records nothing.
+type activitySampler struct {
+	mu     sync.Mutex
+	phases []string
+	ticks  map[string]int
+	events map[string]map[string]int
+}
+
+// startActivitySampler samples the sessions of the current database every
+// interval until ctx is done, attributing each sample to stats.phase().
+// It observes the workers rather than being one, so it stays off the worker
+// engine, where pausing or rate limiting it would skew the samples.
+func startActivitySampler(wg *sync.WaitGroup, ctx context.Context, pool *pgxpool.Pool, stats *runStats, interval time.Duration) *activitySampler {
+	s := &activitySampler{ticks: map[string]int{}, events: map[string]map[string]int{}}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fmt.Printf("Sampling pg_stat_activity every %s ...\n", interval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			if err := s.sample(ctx, pool, stats.phase()); err != nil && ctx.Err() == nil {
+				fmt.Println("Error sampling pg_stat_activity:", err)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *activitySampler) sample(ctx context.Context, pool *pgxpool.Pool, phase string) error {
+	rows, err := pool.Query(ctx, `SELECT COALESCE(wait_event_type || ':' || wait_event, 'CPU')
+		FROM pg_stat_activity
+		WHERE datname = current_database() AND state = 'active' AND pid <> pg_backend_pid()`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var events []string
+	for rows.Next() {
+		var event string
+		if err := rows.Scan(&event); err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.events[phase]; !ok {
+		s.phases = append(s.phases, phase)
+		s.events[phase] = map[string]int{}
+	}
+	s.ticks[phase]++
+	for _, event := range events {
+		s.events[phase][event]++
+	}
+	return nil
+}
+
+// report returns the wait event breakdown per phase, with the average
+// number of active sessions waiting on each event.
+func (s *activitySampler) report() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("Wait event report:\n")
+	for _, phase := range s.phases {
+		ticks, events := s.ticks[phase], s.events[phase]
+		total := 0
+		names := make([]string, 0, len(events))
+		for name, n := range events {
+			names = append(names, name)
+			total += n
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if events[names[i]] != events[names[j]] {
+				return events[names[i]] > events[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		fmt.Fprintf(&b, "  phase %q: %d samples, %.2f average active sessions\n", phase, ticks, float64(total)/float64(ticks))
+		for _, name := range names {
+			n := events[name]
+			fmt.Fprintf(&b, "    %-35s %5.1f%%  aas=%.2f\n", name, float64(n)/float64(total)*100, float64(n)/float64(ticks))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
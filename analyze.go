@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// analyzeTables applies the configured per-column statistics targets and
+// runs ANALYZE on the demo tables, so the planner has fresh statistics
+// right after seeding. Tables that do not exist, as with a schema_dir, are
+// skipped, and a schema_dir gets a plain ANALYZE of all its tables.
+func analyzeTables(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	if cfg.Statistics.SkipAnalyze {
+		return nil
+	}
+
+	exists := func(name string) (bool, error) {
+		var found bool
+		err := pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&found)
+		return found, err
+	}
+
+	analyzed := 0
+	for _, schema := range workloadSchemas(cfg) {
+		for column, target := range cfg.Statistics.ColumnTargets {
+			table, col, _ := strings.Cut(column, ".")
+			if found, err := exists(qualifiedTable(schema, table)); err != nil {
+				return err
+			} else if !found {
+				fmt.Printf("Table %s does not exist, skipping its statistics target for %s\n", table, col)
+				continue
+			}
+			query := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET STATISTICS %d",
+				qualifiedTable(schema, table), pgx.Identifier{col}.Sanitize(), target)
+			if _, err := pool.Exec(ctx, query); err != nil {
+				return fmt.Errorf("setting statistics target for %s failed: %w", column, err)
+			}
+		}
+
+		if cfg.SchemaDir != "" {
+			continue
+		}
+		for _, table := range demoTables {
+			if found, err := exists(qualifiedTable(schema, table)); err != nil {
+				return err
+			} else if !found {
+				continue
+			}
+			if _, err := pool.Exec(ctx, "ANALYZE "+qualifiedTable(schema, table)); err != nil {
+				return fmt.Errorf("analyzing table %s failed: %w", table, err)
+			}
+			analyzed++
+		}
+	}
+
+	if cfg.SchemaDir != "" {
+		if _, err := pool.Exec(ctx, "ANALYZE"); err != nil {
+			return fmt.Errorf("analyzing the database failed: %w", err)
+		}
+		fmt.Println("Analyzed all tables of the database.")
+		return nil
+	}
+	fmt.Printf("Analyzed %d tables.\n", analyzed)
+	return nil
+}
+
+func validateColumnTargets(targets map[string]int) error {
+	for column, target := range targets {
+		table, col, ok := strings.Cut(column, ".")
+		if !ok || table == "" || col == "" {
+			return fmt.Errorf("invalid statistics.column_targets key '%s', must be table.column", column)
+		}
+		if target < -1 || target > 10000 {
+			return fmt.Errorf("invalid statistics target %d for %s, must be between -1 and 10000", target, column)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Events sent to the webhook notifier when an injected anomaly starts and
+// stops, so alerting pipelines can be checked against them.
+const (
+	EventAnomalyStarted = "anomaly_started"
+	EventAnomalyStopped = "anomaly_stopped"
+)
+
+// anomalySpec is an anomaly injected into an insert run, from the anomalies
+// list of the configuration or an -inject flag.
+type anomalySpec struct {
+	Type            string `json:"type"`
+	AfterSeconds    int    `json:"after_seconds"`
+	DurationSeconds int    `json:"duration_seconds"`
+	// Intensity is the number of waiting sessions of a lock_storm, the
+	// errors per second of an error_burst, the sleeping sessions of a
+	// latency_spike and the connections of a connection_flood.
+	Intensity int `json:"intensity"`
+}
+
+// anomaly produces an anomaly until ctx is done, calling started once it is
+// in effect, and returns a description of what it did.
+type anomaly func(ctx context.Context, pool *pgxpool.Pool, label string, intensity int, started func()) (string, error)
+
+var anomalies = map[string]struct {
+	run              anomaly
+	defaultIntensity int
+}{
+	"lock_storm":       {lockStorm, 20},
+	"error_burst":      {errorBurst, 100},
+	"latency_spike":    {latencySpike, 5},
+	"connection_flood": {connectionFlood, 100},
+}
+
+func anomalyTypes() []string {
+	types := make([]string, 0, len(anomalies))
+	for name := range anomalies {
+		types = append(types, name)
+	}
+	slices.Sort(types)
+	return types
+}
+
+func (s anomalySpec) validate() error {
+	if _, ok := anomalies[s.Type]; !ok {
+		return fmt.Errorf("invalid anomaly type '%s', must be one of %v", s.Type, anomalyTypes())
+	}
+	if s.AfterSeconds < 0 || s.DurationSeconds < 0 || s.Intensity < 0 {
+		return fmt.Errorf("anomaly %s: after_seconds, duration_seconds and intensity must not be negative", s.Type)
+	}
+	return nil
+}
+
+// parseAnomalySpec parses the value of an -inject flag, e.g.
+// anomaly=lock_storm,after=2m,duration=30s,intensity=50.
+func parseAnomalySpec(value string) (anomalySpec, error) {
+	var s anomalySpec
+	for _, option := range splitList(value) {
+		key, val, ok := strings.Cut(option, "=")
+		if !ok {
+			return s, fmt.Errorf("invalid option '%s', expected key=value", option)
+		}
+		var err error
+		switch key {
+		case "anomaly":
+			s.Type = val
+		case "after", "duration":
+			var d time.Duration
+			if d, err = time.ParseDuration(val); err == nil {
+				if key == "after" {
+					s.AfterSeconds = int(d.Seconds())
+				} else {
+					s.DurationSeconds = int(d.Seconds())
+				}
+			}
+		case "intensity":
+			s.Intensity, err = strconv.Atoi(val)
+		default:
+			return s, fmt.Errorf("unknown option '%s', must be one of [anomaly after duration intensity]", key)
+		}
+		if err != nil {
+			return s, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	return s, s.validate()
+}
+
+// dedicatedConn opens a connection outside the pool, so an anomaly holding
+// sessions does not starve the workers of the run.
+func dedicatedConn(ctx context.Context, pool *pgxpool.Pool) (*pgx.Conn, error) {
+	return pgx.ConnectConfig(ctx, pool.Config().ConnConfig.Copy())
+}
+
+// lockStorm holds a row lock on artist while sessions queue up behind it.
+func lockStorm(ctx context.Context, pool *pgxpool.Pool, label string, sessions int, started func()) (string, error) {
+	holder, err := dedicatedConn(ctx, pool)
+	if err != nil {
+		return "", err
+	}
+	defer holder.Close(context.Background())
+	tx, err := holder.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	var artistID int64
+	if err := tx.QueryRow(ctx, label+`SELECT artist_id FROM artist ORDER BY artist_id LIMIT 1 FOR UPDATE`).Scan(&artistID); err != nil {
+		tx.Rollback(context.Background())
+		return "", fmt.Errorf("locking an artist row failed: %w", err)
+	}
+
+	var waiters sync.WaitGroup
+	var queued atomic.Int64
+	for range sessions {
+		conn, err := dedicatedConn(ctx, pool)
+		if err != nil {
+			fmt.Printf("Lock storm: opening a waiting session failed: %v\n", err)
+			break
+		}
+		queued.Add(1)
+		waiters.Add(1)
+		go func() {
+			defer waiters.Done()
+			defer conn.Close(context.Background())
+			// The waiters are released by the rollback of the holder, not by
+			// cancelling their queries.
+			conn.Exec(context.WithoutCancel(ctx), label+`SELECT 1 FROM artist WHERE artist_id = $1 FOR UPDATE`, artistID)
+		}()
+	}
+	started()
+
+	<-ctx.Done()
+	tx.Rollback(context.Background())
+	waiters.Wait()
+	return fmt.Sprintf("%d sessions queued on the lock of artist_id %d", queued.Load(), artistID), nil
+}
+
+// errorBurst runs failing statements at rate per second.
+func errorBurst(ctx context.Context, pool *pgxpool.Pool, label string, rate int, started func()) (string, error) {
+	limiter := newRateLimiter(float64(rate))
+	var errors int
+	started()
+	for limiter.wait(ctx) == nil {
+		if _, err := pool.Exec(ctx, label+`SELECT 1 / 0`); err != nil && ctx.Err() == nil {
+			errors++
+		}
+	}
+	return fmt.Sprintf("%d division_by_zero errors", errors), nil
+}
+
+// latencySpike keeps sessions running one second pg_sleep queries.
+func latencySpike(ctx context.Context, pool *pgxpool.Pool, label string, sessions int, started func()) (string, error) {
+	var wg sync.WaitGroup
+	var queries atomic.Int64
+	started()
+	for range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if _, err := pool.Exec(context.WithoutCancel(ctx), label+`SELECT pg_sleep(1)`); err != nil {
+					fmt.Printf("Latency spike: %v\n", err)
+					return
+				}
+				queries.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return fmt.Sprintf("%d queries of 1s from %d sessions", queries.Load(), sessions), nil
+}
+
+// connectionFlood opens connections and keeps them idle, stopping at the
+// first connection refused, e.g. by max_connections.
+func connectionFlood(ctx context.Context, pool *pgxpool.Pool, label string, connections int, started func()) (string, error) {
+	var opened []*pgx.Conn
+	defer func() {
+		for _, conn := range opened {
+			conn.Close(context.Background())
+		}
+	}()
+	for range connections {
+		conn, err := dedicatedConn(ctx, pool)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Printf("Connection flood: stopped after %d connections: %v\n", len(opened), err)
+			break
+		}
+		opened = append(opened, conn)
+	}
+	started()
+	<-ctx.Done()
+	return fmt.Sprintf("%d connections opened", len(opened)), nil
+}
+
+// createAnomaliesTable creates the demo_db_anomalies table, the ground truth
+// of the anomalies injected by every run.
+func createAnomaliesTable(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS demo_db_anomalies (
+		id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+		run_id TEXT NOT NULL,
+		anomaly TEXT NOT NULL,
+		intensity INT NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		stopped_at TIMESTAMPTZ,
+		details TEXT
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating demo_db_anomalies table failed: %w", err)
+	}
+	return registerObjects(ctx, pool, managedObject{Kind: "table", Name: "demo_db_anomalies"})
+}
+
+// startAnomalies injects every anomaly after its delay from the start of the
+// run, for its duration or until ctx is done, and records when it started
+// and stopped in demo_db_anomalies, the output and the webhook. Anomalies
+// are timed one-shot injections on sessions of their own, which the worker
+// engine, running tasks repeatedly, has no use for.
+func startAnomalies(wg *sync.WaitGroup, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, stats *runStats, webhook *notifier) {
+	if err := createAnomaliesTable(ctx, pool); err != nil {
+		fmt.Printf("Error: %v, anomalies are not recorded in the database\n", err)
+	}
+	for _, spec := range cfg.Anomalies {
+		kind := anomalies[spec.Type]
+		intensity := spec.Intensity
+		if intensity == 0 {
+			intensity = kind.defaultIntensity
+		}
+		duration := time.Duration(spec.DurationSeconds) * time.Second
+		if duration <= 0 {
+			duration = 30 * time.Second
+		}
+		label := statementLabel(cfg, stats.runID, "anomaly-"+spec.Type)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !sleep(ctx, time.Duration(spec.AfterSeconds)*time.Second) {
+				return
+			}
+			anomalyCtx, cancel := context.WithTimeout(ctx, duration)
+			defer cancel()
+
+			var id int64
+			var startedAt time.Time
+			details, err := kind.run(anomalyCtx, pool, label, intensity, func() {
+				startedAt = time.Now()
+				fmt.Printf("Anomaly %s (intensity %d) started at %s\n", spec.Type, intensity, startedAt.UTC().Format(time.RFC3339Nano))
+				webhook.notify(EventAnomalyStarted, fmt.Sprintf("%s, intensity %d, for %s", spec.Type, intensity, duration))
+				err := pool.QueryRow(context.WithoutCancel(ctx), `INSERT INTO demo_db_anomalies (run_id, anomaly, intensity, started_at)
+					VALUES ($1, $2, $3, $4) RETURNING id`, stats.runID, spec.Type, intensity, startedAt).Scan(&id)
+				if err != nil {
+					fmt.Printf("Error recording start of anomaly %s: %v\n", spec.Type, err)
+				}
+			})
+			if err != nil {
+				fmt.Printf("Error injecting anomaly %s: %v\n", spec.Type, err)
+			}
+			if startedAt.IsZero() {
+				return
+			}
+
+			stoppedAt := time.Now()
+			fmt.Printf("Anomaly %s stopped at %s: %s\n", spec.Type, stoppedAt.UTC().Format(time.RFC3339Nano), details)
+			webhook.notify(EventAnomalyStopped, fmt.Sprintf("%s: %s", spec.Type, details))
+			if id != 0 {
+				_, err := pool.Exec(context.WithoutCancel(ctx), `UPDATE demo_db_anomalies SET stopped_at = $2, details = $3 WHERE id = $1`,
+					id, stoppedAt, details)
+				if err != nil {
+					fmt.Printf("Error recording end of anomaly %s: %v\n", spec.Type, err)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParseAnomalySpec(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    anomalySpec
+		wantErr bool
+	}{
+		{"anomaly=lock_storm,after=2m,duration=30s,intensity=50",
+			anomalySpec{Type: "lock_storm", AfterSeconds: 120, DurationSeconds: 30, Intensity: 50}, false},
+		{"anomaly=error_burst", anomalySpec{Type: "error_burst"}, false},
+		{" anomaly=latency_spike , duration=1h ", anomalySpec{Type: "latency_spike", DurationSeconds: 3600}, false},
+		{"after=10s", anomalySpec{}, true},
+		{"anomaly=meteor", anomalySpec{}, true},
+		{"anomaly=lock_storm,after", anomalySpec{}, true},
+		{"anomaly=lock_storm,every=1m", anomalySpec{}, true},
+		{"anomaly=lock_storm,after=soon", anomalySpec{}, true},
+		{"anomaly=lock_storm,intensity=high", anomalySpec{}, true},
+		{"anomaly=lock_storm,intensity=-1", anomalySpec{}, true},
+		{"anomaly=lock_storm,after=-1m", anomalySpec{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseAnomalySpec(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAnomalySpec(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseAnomalySpec(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// anySchemaInsert builds the statement inserting batchSize generated rows
+// into table t of schema. Columns with a default are left to it, foreign
+// keys reference random existing rows of their parent and unique columns
+// continue after the highest existing value. Rows that still collide with
+// a unique constraint are skipped.
+func anySchemaInsert(schema string, t *tableInfo, batchSize int) (string, error) {
+	target := qualifiedTable(schema, t.name)
+	if batchSize <= 1 && !slices.ContainsFunc(t.columns, func(c tableColumn) bool { return !c.hasDefault }) {
+		return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", target), nil
+	}
+
+	var names, exprs []string
+columns:
+	for _, c := range t.columns {
+		if c.hasDefault {
+			continue
+		}
+		column := pgx.Identifier{c.name}.Sanitize()
+
+		for _, fk := range t.foreignKeys {
+			if !slices.Contains(fk.columns, c.name) {
+				continue
+			}
+			if len(fk.columns) > 1 {
+				if c.notNull {
+					return "", fmt.Errorf("column %s is part of composite foreign key %s", c.name, fk.name)
+				}
+				names, exprs = append(names, column), append(exprs, "NULL")
+				continue columns
+			}
+
+			refSchema, refTable, ok := strings.Cut(fk.refTable, ".")
+			if !ok {
+				refSchema, refTable = schema, fk.refTable
+			}
+			parent, key := qualifiedTable(refSchema, refTable), pgx.Identifier{fk.refColumns[0]}.Sanitize()
+			// Referencing g makes the subqueries run again for every row.
+			expr := fmt.Sprintf("(SELECT %[2]s FROM %[1]s WHERE g IS NOT NULL ORDER BY random() LIMIT 1)", parent, key)
+			if isIntegerType(c.typName) {
+				expr = fmt.Sprintf(`(SELECT %[2]s FROM %[1]s WHERE %[2]s >= (SELECT MIN(%[2]s) + floor(random() * (MAX(%[2]s) - MIN(%[2]s) + 1))::bigint
+					FROM %[1]s WHERE g IS NOT NULL) ORDER BY %[2]s LIMIT 1)`, parent, key)
+			}
+			names, exprs = append(names, column), append(exprs, expr)
+			continue columns
+		}
+
+		seq := "g"
+		if isIntegerType(c.typName) {
+			seq = fmt.Sprintf("(SELECT COALESCE(MAX(%s), 0) FROM %s) + g", column, target)
+		}
+		expr := valueExpr(c, t.unique(c.name), seq)
+		if expr == "" {
+			return "", fmt.Errorf("column %s has unsupported type %s", c.name, c.typ)
+		}
+		names, exprs = append(names, column), append(exprs, expr)
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM generate_series(1, %d) AS g ON CONFLICT DO NOTHING",
+		target, strings.Join(names, ", "), strings.Join(exprs, ", "), max(batchSize, 1)), nil
+}
+
+// runAnySchema inserts generated rows into the user tables of
+// any_schema.schema until ctx is done, with one worker per table. The
+// tables are read from the catalog, so any schema can be loaded, not only
+// the embedded Chinook one.
+func runAnySchema(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	schema := cfg.AnySchema.Schema
+	if schema == "" {
+		schema = "public"
+	}
+
+	tables, err := introspectSchema(ctx, pool, schema, schema)
+	if err != nil {
+		return err
+	}
+
+	execCtx, cancelExec := statementContext(ctx, drainTimeout(cfg))
+	defer cancelExec()
+
+	stats := newRunStats()
+	engine := newWorkerEngine(ctx, stats, newRetryPolicy(cfg), nil)
+	limiter := newRateLimiter(cfg.AnySchema.RatePerSecond)
+	started := 0
+	for _, t := range referenceOrder(tables) {
+		if strings.HasPrefix(t.name, "demo_db_") || len(cfg.AnySchema.Tables) > 0 && !slices.Contains(cfg.AnySchema.Tables, t.name) {
+			continue
+		}
+		query, err := anySchemaInsert(schema, t, cfg.AnySchema.BatchSize)
+		if err != nil {
+			fmt.Printf("Skipping table %s: %v\n", t.name, err)
+			continue
+		}
+		for _, check := range t.checks {
+			if !check.parsed {
+				fmt.Printf("Check constraint %s of %s is not understood, inserts may violate it: %s\n", check.name, t.name, check.def)
+			}
+		}
+		engine.start(workerSpec{
+			name:        t.name,
+			description: "insert worker for table " + t.name,
+			limiter:     limiter,
+			newTask: func(int) task {
+				return func() (outcome, error) {
+					tag, err := pool.Exec(execCtx, query)
+					return outcome{inserted: tag.RowsAffected()}, err
+				}
+			},
+		})
+		started++
+	}
+	if started == 0 {
+		return fmt.Errorf("no table of schema %s can be inserted into", schema)
+	}
+	engine.started()
+	fmt.Printf("Inserting into %d tables of schema %s\n", started, schema)
+
+	engine.wait()
+	fmt.Println(stats.summary())
+	return nil
+}
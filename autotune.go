@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tuneStep is the outcome of running the autotune workload at one rate.
+type tuneStep struct {
+	target, achieved float64
+	p95              time.Duration
+	errors, attempts int
+}
+
+func (s tuneStep) errorPercent() float64 {
+	if s.attempts == 0 {
+		return 0
+	}
+	return float64(s.errors) / float64(s.attempts) * 100
+}
+
+// runAutotune inserts batches into bigtable at increasing rates until the
+// p95 latency or the error rate exceed their thresholds, or the database
+// cannot keep up with the requested rate. It then bisects between the last
+// good and the first bad rate and reports the highest sustainable rate.
+func runAutotune(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	at := cfg.Autotune
+	rate := at.StartRowsPerSecond
+	if rate <= 0 {
+		rate = 100
+	}
+	growth := at.GrowthFactor
+	if growth <= 1 {
+		growth = 1.5
+	}
+	step := time.Duration(at.StepSeconds) * time.Second
+	if step <= 0 {
+		step = 10 * time.Second
+	}
+	maxLatency := time.Duration(at.MaxP95LatencyMs) * time.Millisecond
+	if maxLatency <= 0 {
+		maxLatency = 100 * time.Millisecond
+	}
+	maxErrors := at.MaxErrorPercent
+	if maxErrors <= 0 {
+		maxErrors = 1
+	}
+	batchSize := max(cfg.Inserter.BigTableInserts.BatchSize, 1)
+	workers := at.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	r := newRand(runSeed(cfg), "autotune")
+	randStr := GenerateRandomString(r, 120)
+	query := fmt.Sprintf(`INSERT INTO bigtable(cola, colb, colc, cold, cole) VALUES %s`, valuesPlaceholders(batchSize, 5))
+	args := make([]any, 0, batchSize*5)
+	for range batchSize {
+		args = append(args, randStr, randStr, randStr, randStr, randStr)
+	}
+
+	ok := func(s tuneStep) bool {
+		return s.achieved >= 0.9*s.target && s.p95 <= maxLatency && s.errorPercent() <= maxErrors
+	}
+
+	fmt.Printf("Autotuning bigtable inserts: %d workers, batches of %d rows, %s per step, p95 <= %s, errors <= %g%%\n",
+		workers, batchSize, step, maxLatency, maxErrors)
+	var good, bad float64
+	for i := 0; i < 20 && ctx.Err() == nil; i++ {
+		s := runTuneStep(ctx, pool, query, args, batchSize, workers, rate, step)
+		verdict := "ok"
+		if !ok(s) {
+			verdict = "breached"
+		}
+		fmt.Printf("  target %8.0f rows/s: achieved %8.0f rows/s, p95 %s, errors %.2f%% -> %s\n",
+			s.target, s.achieved, s.p95.Round(time.Microsecond), s.errorPercent(), verdict)
+
+		if ok(s) {
+			good = max(good, s.achieved)
+		} else {
+			bad = rate
+		}
+		if bad == 0 {
+			rate *= growth
+			continue
+		}
+		if bad-good < max(good*0.05, 1) {
+			break
+		}
+		rate = (good + bad) / 2
+	}
+
+	if good == 0 {
+		fmt.Println("No sustainable rate found, even the starting rate breached the thresholds.")
+		return nil
+	}
+	fmt.Printf("Maximum sustainable rate: %.0f rows/s\n", good)
+	return nil
+}
+
+// runTuneStep runs the insert workers limited to rate rows per second for
+// duration and measures the achieved rate, p95 latency and errors.
+func runTuneStep(ctx context.Context, pool *pgxpool.Pool, query string, args []any, batchSize, workers int, rate float64, duration time.Duration) tuneStep {
+	stepCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	limiter := newRateLimiter(rate / float64(batchSize))
+
+	var mu sync.Mutex
+	var latencies []time.Duration
+	s := tuneStep{target: rate}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for limiter.wait(stepCtx) == nil {
+				began := time.Now()
+				_, err := pool.Exec(stepCtx, query, args...)
+				latency := time.Since(began)
+				if stepCtx.Err() != nil {
+					// Statements cut short by the end of the step do not count.
+					return
+				}
+				mu.Lock()
+				s.attempts++
+				if err != nil {
+					s.errors++
+				} else {
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.achieved = float64(len(latencies)*batchSize) / time.Since(start).Seconds()
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		s.p95 = latencies[(len(latencies)*95)/100]
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// isDataError reports whether err was caused by the values of the rows, a
+// data exception or an integrity constraint violation, rather than by the
+// connection or the server.
+func isDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
+
+// batchIsolation keeps a batch insert going past its bad rows: a batch
+// failing because of its data is inserted again row by row and the rows
+// failing on their own are logged and counted as rejected. A nil
+// batchIsolation fails the whole batch, like a plain multi-row insert.
+type batchIsolation struct {
+	mu       sync.Mutex
+	rejected map[string]int64
+}
+
+func newBatchIsolation() *batchIsolation {
+	return &batchIsolation{rejected: map[string]int64{}}
+}
+
+// insert runs insert for the rows of a batch of table name, args holding
+// width values per row, and returns the number of rows inserted.
+func (b *batchIsolation) insert(name string, rows, width int, args []any, insert func(rows int, args []any) error) (int, error) {
+	err := insert(rows, args)
+	if err == nil {
+		return rows, nil
+	}
+	if b == nil || !isDataError(err) {
+		return 0, err
+	}
+	if rows == 1 {
+		b.reject(name, err)
+		return 0, nil
+	}
+
+	inserted := 0
+	for i := range rows {
+		err := insert(1, args[i*width:(i+1)*width])
+		switch {
+		case err == nil:
+			inserted++
+		case isDataError(err):
+			b.reject(name, err)
+		default:
+			return inserted, err
+		}
+	}
+	return inserted, nil
+}
+
+func (b *batchIsolation) reject(name string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rejected[name]++
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Detail != "" {
+		fmt.Printf("Rejected a row of %s: %v, %s\n", name, err, pgErr.Detail)
+		return
+	}
+	fmt.Printf("Rejected a row of %s: %v\n", name, err)
+}
+
+// report prints the rows rejected per table.
+func (b *batchIsolation) report() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fmt.Println("Rejected rows report:")
+	if len(b.rejected) == 0 {
+		fmt.Println("  no rows rejected")
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(b.rejected)) {
+		fmt.Printf("  %-20s %d rows rejected\n", name, b.rejected[name])
+	}
+}
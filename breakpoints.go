@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// breakpoints pause a scenario before the phases marked with breakpoint
+// until the operator resumes it, with Enter on the terminal or a POST to
+// /resume on the resume address. Resuming while the scenario is not paused
+// does nothing, so a stray Enter never skips the next breakpoint. A nil
+// breakpoints never pauses.
+type breakpoints struct {
+	resume   chan struct{}
+	terminal bool
+	url      string
+}
+
+// newBreakpoints starts listening for the operator. It reads stdin unless
+// noPrompt is set or stdin is not a terminal, and serves /resume on addr
+// when set, until ctx is done.
+func newBreakpoints(ctx context.Context, noPrompt bool, addr string) *breakpoints {
+	b := &breakpoints{resume: make(chan struct{})}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && !noPrompt {
+		b.terminal = true
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				b.tryResume()
+			}
+		}()
+	}
+
+	if addr != "" {
+		b.url = fmt.Sprintf("http://%s/resume", addr)
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+			if !b.tryResume() {
+				http.Error(w, "scenario is not paused", http.StatusConflict)
+				return
+			}
+			fmt.Fprintln(w, "resumed")
+		})
+		server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Println("Error serving the resume endpoint:", err)
+			}
+		}()
+	}
+	return b
+}
+
+// tryResume resumes a paused scenario and reports whether it was paused.
+func (b *breakpoints) tryResume() bool {
+	select {
+	case b.resume <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// pause prints the notes of the next phase and waits for the operator.
+// Without a terminal or a resume address nobody could resume, so the
+// breakpoint is skipped.
+func (b *breakpoints) pause(ctx context.Context, p scenarioPhase) error {
+	if b == nil {
+		return nil
+	}
+	if !b.terminal && b.url == "" {
+		fmt.Printf("Skipping breakpoint before %s: stdin is not a terminal and no -resume-address is set\n", p.title())
+		return nil
+	}
+
+	fmt.Printf("\n=== Breakpoint before %s ===\n", p.title())
+	if p.Notes != "" {
+		fmt.Println(p.Notes)
+	}
+	switch {
+	case b.terminal && b.url != "":
+		fmt.Printf("Press Enter or POST %s to continue\n", b.url)
+	case b.terminal:
+		fmt.Println("Press Enter to continue")
+	default:
+		fmt.Printf("POST %s to continue\n", b.url)
+	}
+
+	paused := time.Now()
+	select {
+	case <-b.resume:
+		fmt.Printf("Resumed after %s\n", time.Since(paused).Round(time.Second))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
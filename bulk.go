@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// bulkTables describes the columns and the row generator used when bulk
+// loading a table with COPY.
+var bulkTables = map[string]struct {
+	columns []string
+	row     func(r *rand.Rand) []any
+}{
+	"bigtable": {
+		columns: []string{"cola", "colb", "colc", "cold", "cole"},
+		row: func(r *rand.Rand) []any {
+			return []any{GenerateRandomString(r, 120), GenerateRandomString(r, 120), GenerateRandomString(r, 120), GenerateRandomString(r, 120), GenerateRandomString(r, 120)}
+		},
+	},
+	"timestamp": {
+		columns: []string{"created_at"},
+		row:     func(r *rand.Rand) []any { return []any{time.Now()} },
+	},
+	"artist":     {columns: []string{"name"}, row: func(r *rand.Rand) []any { return []any{GenerateRandomString(r, 20)} }},
+	"genre":      {columns: []string{"name"}, row: func(r *rand.Rand) []any { return []any{GenerateRandomString(r, 120)} }},
+	"media_type": {columns: []string{"name"}, row: func(r *rand.Rand) []any { return []any{GenerateRandomString(r, 120)} }},
+	"playlist":   {columns: []string{"name"}, row: func(r *rand.Rand) []any { return []any{GenerateRandomString(r, 120)} }},
+}
+
+func validateBulkTables(tables []string) error {
+	for _, t := range tables {
+		if _, ok := bulkTables[t]; !ok {
+			valid := make([]string, 0, len(bulkTables))
+			for name := range bulkTables {
+				valid = append(valid, name)
+			}
+			slices.Sort(valid)
+			return fmt.Errorf("table '%s' cannot be bulk loaded, must be one of %v", t, valid)
+		}
+	}
+	return nil
+}
+
+// startBulkLoader starts the workers streaming generated rows into table
+// with the COPY protocol, rowsPerCopy rows per COPY, until targetRows rows
+// are loaded. A target of zero keeps loading until the run is stopped. The
+// workers are named after the table, so they share its rate limit, worker
+// count, think time and start_after with its insert workers.
+func startBulkLoader(e *workerEngine, execCtx context.Context, pool *pgxpool.Pool, schemas []string, seed uint64, table string, rowsPerCopy, targetRows int) {
+	if rowsPerCopy <= 0 {
+		rowsPerCopy = 10000
+	}
+	spec := bulkTables[table]
+	// reserved counts the rows of the finished and running COPYs, so the
+	// workers together load exactly targetRows rows.
+	var reserved, loaded atomic.Int64
+	e.start(workerSpec{
+		name:        table,
+		description: "bulk loader for table " + table,
+		newTask: func(i int) task {
+			r := newRand(workerSeed(seed, i), "bulk-"+table)
+			return func() (outcome, error) {
+				n := int64(rowsPerCopy)
+				if targetRows > 0 {
+					n = min(n, int64(targetRows)-reserved.Add(n)+n)
+					if n <= 0 {
+						reserved.Add(-int64(rowsPerCopy))
+						return outcome{}, errWorkDone
+					}
+					reserved.Add(n - int64(rowsPerCopy))
+				}
+
+				schema := pickSchema(r, schemas)
+				name := pgx.Identifier{table}
+				if schema != "" {
+					name = pgx.Identifier{schema, table}
+				}
+				var rows int64
+				copied, err := pool.CopyFrom(execCtx, name, spec.columns, pgx.CopyFromFunc(func() ([]any, error) {
+					if rows >= n {
+						return nil, nil
+					}
+					rows++
+					return spec.row(r), nil
+				}))
+				if targetRows > 0 {
+					reserved.Add(copied - n)
+					if total := loaded.Add(copied); err == nil {
+						fmt.Printf("Copied %d/%d rows into table %s\n", total, targetRows, table)
+					}
+				}
+				return outcome{inserted: copied}, err
+			}
+		},
+	})
+}
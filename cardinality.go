@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// textColumns are the generated text columns of the main tables, by
+// table.column, with their maximum length.
+var textColumns = map[string]int{
+	"artist.name": 120, "album.title": 160, "track.name": 200, "track.composer": 220,
+	"genre.name": 120, "media_type.name": 120, "playlist.name": 120,
+	"employee.last_name": 20, "employee.first_name": 20, "employee.title": 30, "employee.address": 70,
+	"employee.city": 40, "employee.state": 40, "employee.country": 40, "employee.postal_code": 10,
+	"employee.phone": 24, "employee.fax": 24, "employee.email": 60,
+	"customer.first_name": 40, "customer.last_name": 20, "customer.company": 80, "customer.address": 70,
+	"customer.city": 40, "customer.state": 40, "customer.country": 40, "customer.postal_code": 10,
+	"customer.phone": 24, "customer.email": 60,
+}
+
+// minUniqueLength is the shortest column that can be unique, which leaves
+// room for the tag making the values unique.
+const minUniqueLength = 20
+
+// columnCardinality sets the number of distinct values of a column.
+type columnCardinality struct {
+	// Distinct limits the column to exactly that many distinct values,
+	// once enough rows were inserted.
+	Distinct int `json:"distinct"`
+	// Unique makes every value of the column distinct.
+	Unique bool `json:"unique"`
+}
+
+func (c columnCardinality) validate(column string) error {
+	length, ok := textColumns[column]
+	if !ok {
+		return fmt.Errorf("unknown column, must be table.column of a generated text column")
+	}
+	switch {
+	case c.Distinct < 0:
+		return fmt.Errorf("distinct must not be negative")
+	case c.Distinct > 0 && c.Unique:
+		return fmt.Errorf("distinct and unique are mutually exclusive")
+	case c.Unique && length < minUniqueLength:
+		return fmt.Errorf("unique requires a column of at least %d characters", minUniqueLength)
+	}
+	return nil
+}
+
+// columnValues enforces the cardinality of the columns on the generated
+// values. Distinct columns map every value to one of their buckets, which
+// keeps the first value it received; values already taken by another bucket
+// get its number, so the column ends up with exactly that many values even
+// when the generator has fewer. Unique columns get a tag of the run and a
+// counter. A nil columnValues keeps the values as generated.
+type columnValues struct {
+	columns map[string]columnCardinality
+	runID   string
+
+	mu      sync.Mutex
+	buckets map[string][]string
+	taken   map[string]map[string]bool
+	counter atomic.Int64
+}
+
+func newColumnValues(columns map[string]columnCardinality, runID string) *columnValues {
+	if len(columns) == 0 {
+		return nil
+	}
+	return &columnValues{
+		columns: columns,
+		runID:   runID[:min(len(runID), 6)],
+		buckets: map[string][]string{},
+		taken:   map[string]map[string]bool{},
+	}
+}
+
+// fit appends suffix to value, shortening value so that the result fits
+// into column.
+func fit(column, value, suffix string) string {
+	limit := textColumns[column] - len(suffix)
+	if len(value) > limit {
+		value = value[:max(limit, 0)]
+	}
+	return value + suffix
+}
+
+// shape returns the value to insert into table.column instead of value.
+func (v *columnValues) shape(r *rand.Rand, table, column, value string) string {
+	if v == nil {
+		return value
+	}
+	key := table + "." + column
+	c, ok := v.columns[key]
+	switch {
+	case !ok:
+		return value
+	case c.Unique:
+		tag := "-" + v.runID + strconv.FormatInt(v.counter.Add(1), 36)
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			// Keep the domain of email addresses.
+			return fit(key, value[:at], tag+value[at:])
+		}
+		return fit(key, value, tag)
+	case c.Distinct > 0:
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		buckets := v.buckets[key]
+		if buckets == nil {
+			buckets = make([]string, c.Distinct)
+			v.buckets[key] = buckets
+			v.taken[key] = map[string]bool{}
+		}
+		i := r.IntN(c.Distinct)
+		if buckets[i] == "" {
+			generated := value
+			for n := i + 1; v.taken[key][value]; n += c.Distinct {
+				value = fit(key, generated, " "+strconv.Itoa(n))
+			}
+			buckets[i] = value
+			v.taken[key][value] = true
+		}
+		return buckets[i]
+	}
+	return value
+}
+
+// of returns shape for the columns of table.
+func (v *columnValues) of(r *rand.Rand, table string) func(column, value string) string {
+	return func(column, value string) string { return v.shape(r, table, column, value) }
+}
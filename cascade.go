@@ -0,0 +1,294 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cascadeTables are the tables of the cascading delete workload, parents
+// first. Deleting an artist deletes its albums, and deleting an album its
+// tracks.
+var cascadeTables = []string{"demo_db_cascade_artist", "demo_db_cascade_album", "demo_db_cascade_track"}
+
+// cascadeIndexes index the foreign key columns, so the cascades find the
+// child rows without scanning the child tables.
+var cascadeIndexes = map[string]string{
+	"demo_db_cascade_album_artist_id_idx": "demo_db_cascade_album (artist_id)",
+	"demo_db_cascade_track_album_id_idx":  "demo_db_cascade_track (album_id)",
+}
+
+// setupCascadeDeletes creates the tables of the cascading delete workload,
+// with or without indexes on the foreign key columns.
+func setupCascadeDeletes(ctx context.Context, pool *pgxpool.Pool, indexed bool) error {
+	steps := []string{
+		`CREATE TABLE IF NOT EXISTS demo_db_cascade_artist (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`,
+		`CREATE TABLE IF NOT EXISTS demo_db_cascade_album (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			artist_id BIGINT NOT NULL REFERENCES demo_db_cascade_artist (id) ON DELETE CASCADE,
+			title TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS demo_db_cascade_track (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			album_id BIGINT NOT NULL REFERENCES demo_db_cascade_album (id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			payload TEXT
+		)`,
+	}
+	for name, columns := range cascadeIndexes {
+		if indexed {
+			steps = append(steps, `CREATE INDEX IF NOT EXISTS `+name+` ON `+columns)
+		} else {
+			steps = append(steps, `DROP INDEX IF EXISTS `+name)
+		}
+	}
+	for _, step := range steps {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return fmt.Errorf("creating cascade tables failed: %w", err)
+		}
+	}
+	var objects []managedObject
+	for _, table := range cascadeTables {
+		objects = append(objects, managedObject{Kind: "table", Name: table})
+	}
+	return registerObjects(ctx, pool, objects...)
+}
+
+// latencyStats aggregates the durations of a kind of statement.
+type latencyStats struct {
+	mu    sync.Mutex
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+func (l *latencyStats) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	l.total += d
+	l.max = max(l.max, d)
+}
+
+func (l *latencyStats) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d, avg %s, max %s", l.count,
+		(l.total / time.Duration(l.count)).Round(time.Microsecond), l.max.Round(time.Microsecond))
+}
+
+// cascadeDeletes inserts artists with many albums and tracks and deletes
+// the oldest artists again, each delete cascading to thousands of rows in
+// one statement. Meanwhile the child workers insert tracks into the albums
+// of the oldest artists: their foreign key checks lock the album rows the
+// cascades delete, so they wait for the deletes to commit and then fail.
+type cascadeDeletes struct {
+	pool            *pgxpool.Pool
+	label           string
+	albumsPerArtist int
+	tracksPerAlbum  int
+	keepArtists     int
+
+	mu             sync.Mutex
+	deletes        latencyStats
+	children       latencyStats
+	deletedArtists int64
+	cascadedRows   int64
+	maxCascaded    int64
+	orphanedWaits  int64
+}
+
+// insertTree inserts an artist with its albums and their tracks in one
+// transaction.
+func (c *cascadeDeletes) insertTree(ctx context.Context, r *rand.Rand) task {
+	return func() (outcome, error) {
+		result := outcome{name: "cascade_insert"}
+		err := pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+			var artist int64
+			err := tx.QueryRow(ctx, c.label+`INSERT INTO demo_db_cascade_artist (name) VALUES ($1) RETURNING id`,
+				"Artist "+strconv.FormatUint(r.Uint64()%1_000_000, 10)).Scan(&artist)
+			if err != nil {
+				return err
+			}
+			rows, err := tx.Query(ctx, c.label+`INSERT INTO demo_db_cascade_album (artist_id, title)
+				SELECT $1, 'Album ' || g FROM generate_series(1, $2::int) g RETURNING id`, artist, c.albumsPerArtist)
+			if err != nil {
+				return err
+			}
+			albums, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+			if err != nil {
+				return err
+			}
+			tag, err := tx.Exec(ctx, c.label+`INSERT INTO demo_db_cascade_track (album_id, name, payload)
+				SELECT a, 'Track ' || g, md5(random()::text) FROM unnest($1::bigint[]) a, generate_series(1, $2::int) g`,
+				albums, c.tracksPerAlbum)
+			if err != nil {
+				return err
+			}
+			result.inserted = 1 + int64(len(albums)) + tag.RowsAffected()
+			return nil
+		})
+		if err != nil {
+			return outcome{name: result.name}, fmt.Errorf("inserting artist with albums and tracks failed: %w", err)
+		}
+		return result, nil
+	}
+}
+
+// insertChild inserts a track into one of the albums of the oldest
+// artists, the next ones to be deleted. A foreign key violation means the
+// album was deleted by a cascade while the insert waited for it.
+func (c *cascadeDeletes) insertChild(ctx context.Context, r *rand.Rand) task {
+	return func() (outcome, error) {
+		result := outcome{name: "cascade_child"}
+		start := time.Now()
+		tag, err := c.pool.Exec(ctx, c.label+`INSERT INTO demo_db_cascade_track (album_id, name, payload)
+			SELECT id, 'Late track', md5(random()::text) FROM demo_db_cascade_album ORDER BY id LIMIT 1 OFFSET $1`,
+			r.IntN(2*c.albumsPerArtist))
+		c.children.add(time.Since(start))
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			c.mu.Lock()
+			c.orphanedWaits++
+			c.mu.Unlock()
+			return result, nil
+		case err != nil:
+			return result, err
+		}
+		result.inserted = tag.RowsAffected()
+		return result, nil
+	}
+}
+
+// deleteOldest deletes the oldest artist once more than keepArtists
+// artists exist, counting the albums and tracks the delete cascades to.
+func (c *cascadeDeletes) deleteOldest(ctx context.Context) task {
+	return func() (outcome, error) {
+		result := outcome{name: "cascade_delete"}
+		var duration time.Duration
+		var cascaded int64
+		err := pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+			var artist int64
+			err := tx.QueryRow(ctx, c.label+`SELECT id FROM demo_db_cascade_artist
+				WHERE (SELECT count(*) FROM demo_db_cascade_artist) > $1
+				ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED`, c.keepArtists).Scan(&artist)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = tx.QueryRow(ctx, `SELECT (SELECT count(*) FROM demo_db_cascade_album WHERE artist_id = $1)
+				+ (SELECT count(*) FROM demo_db_cascade_track t JOIN demo_db_cascade_album a ON a.id = t.album_id WHERE a.artist_id = $1)`,
+				artist).Scan(&cascaded)
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			if _, err := tx.Exec(ctx, c.label+`DELETE FROM demo_db_cascade_artist WHERE id = $1`, artist); err != nil {
+				return err
+			}
+			duration = time.Since(start)
+			result.deleted = 1 + cascaded
+			return nil
+		})
+		if err != nil {
+			return outcome{name: result.name}, fmt.Errorf("deleting artist failed: %w", err)
+		}
+		if result.deleted == 0 {
+			// Wait for the inserters rather than counting the artists in a
+			// tight loop.
+			sleep(ctx, time.Second)
+			return result, nil
+		}
+		c.deletes.add(duration)
+		c.mu.Lock()
+		c.deletedArtists++
+		c.cascadedRows += cascaded
+		c.maxCascaded = max(c.maxCascaded, cascaded)
+		c.mu.Unlock()
+		return result, nil
+	}
+}
+
+// startCascadeDeletes starts the tree inserters, the child inserters and
+// the deleter of the cascading delete workload.
+func startCascadeDeletes(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, seed uint64, label string) *cascadeDeletes {
+	settings := cfg.Inserter.CascadeDeletes
+	c := &cascadeDeletes{
+		pool:            pool,
+		label:           label,
+		albumsPerArtist: settings.AlbumsPerArtist,
+		tracksPerAlbum:  settings.TracksPerAlbum,
+		keepArtists:     settings.KeepArtists,
+	}
+	if c.albumsPerArtist <= 0 {
+		c.albumsPerArtist = 10
+	}
+	if c.tracksPerAlbum <= 0 {
+		c.tracksPerAlbum = 100
+	}
+	if c.keepArtists <= 0 {
+		c.keepArtists = 100
+	}
+	e.start(workerSpec{
+		name:        "cascade_insert",
+		description: fmt.Sprintf("cascade insert worker for artists with %d albums of %d tracks", c.albumsPerArtist, c.tracksPerAlbum),
+		concurrency: settings.Writers,
+		limiter:     newRateLimiter(settings.RatePerSecond),
+		newTask: func(i int) task {
+			return c.insertTree(ctx, newRand(workerSeed(seed, i), "cascade_insert"))
+		},
+	})
+	e.start(workerSpec{
+		name:        "cascade_child",
+		description: "cascade child insert worker",
+		concurrency: cmp.Or(settings.ChildWorkers, 2),
+		limiter:     newRateLimiter(settings.ChildRatePerSecond),
+		newTask: func(i int) task {
+			return c.insertChild(ctx, newRand(workerSeed(seed, i), "cascade_child"))
+		},
+	})
+	e.start(workerSpec{
+		name:        "cascade_delete",
+		description: fmt.Sprintf("cascade delete worker keeping %d artists", c.keepArtists),
+		limiter:     newRateLimiter(settings.DeleteRatePerSecond),
+		newTask: func(int) task {
+			return c.deleteOldest(ctx)
+		},
+	})
+	return c
+}
+
+// report prints the durations of the cascading deletes and how the
+// concurrent child inserts fared.
+func (c *cascadeDeletes) report() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Println("Cascading delete report:")
+	fmt.Printf("  artist deletes: %s\n", &c.deletes)
+	if c.deletedArtists > 0 {
+		fmt.Printf("  rows deleted by cascades: %d, avg %d per artist, max %d\n", c.cascadedRows, c.cascadedRows/c.deletedArtists, c.maxCascaded)
+	}
+	fmt.Printf("  concurrent child inserts: %s\n", &c.children)
+	if c.orphanedWaits > 0 {
+		fmt.Printf("  %d child inserts waited for a cascade and failed, their album was deleted\n", c.orphanedWaits)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// checkConstraint is a CHECK constraint of an introspected table. Only
+// constraints on a single column made of comparisons with constants and
+// IN lists are understood, generated values satisfy those.
+type checkConstraint struct {
+	name, def string
+	parsed    bool
+}
+
+// valueCheck restricts the values generated for a column.
+type valueCheck struct {
+	min, max                   float64
+	hasMin, hasMax             bool
+	minExclusive, maxExclusive bool
+	// values are the SQL literals of an IN list.
+	values []string
+}
+
+var (
+	checkAnyPattern        = regexp.MustCompile(`^(.+?) = ANY \((.*)\)$`)
+	checkComparisonPattern = regexp.MustCompile(`^(.+?) (>=|<=|>|<|=) (.+)$`)
+	checkStringPattern     = regexp.MustCompile(`'(?:[^']|'')*'`)
+	checkNumberPattern     = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	checkCastPattern       = regexp.MustCompile(`::[a-z ]+(?:\[\])?(?:\(\d+(?:,\d+)?\))?$`)
+)
+
+// parseCheck adds the conditions of the definition of a CHECK constraint
+// on column to check and reports whether all of them were understood.
+// Definitions are the ones of pg_get_constraintdef, e.g.
+// CHECK (((quantity > 0) AND (quantity <= 100))).
+func parseCheck(def, column string, check *valueCheck) bool {
+	expr := strings.TrimSuffix(def, " NOT VALID")
+	if !strings.HasPrefix(expr, "CHECK ") {
+		return false
+	}
+	for _, term := range splitTopLevel(stripParens(strings.TrimPrefix(expr, "CHECK ")), " AND ") {
+		term = stripParens(term)
+		if strings.HasSuffix(term, " IS NOT NULL") && isColumnRef(strings.TrimSuffix(term, " IS NOT NULL"), column) {
+			continue
+		}
+		if m := checkAnyPattern.FindStringSubmatch(term); m != nil && isColumnRef(m[1], column) {
+			values := checkStringPattern.FindAllString(m[2], -1)
+			if len(values) == 0 {
+				values = checkNumberPattern.FindAllString(m[2], -1)
+			}
+			if len(values) == 0 {
+				return false
+			}
+			check.values = values
+			continue
+		}
+		m := checkComparisonPattern.FindStringSubmatch(term)
+		if m == nil {
+			return false
+		}
+		left, op, right := m[1], m[2], m[3]
+		if !isColumnRef(left, column) {
+			// Constant on the left, e.g. (0 < quantity).
+			left, right = right, left
+			op = map[string]string{">=": "<=", "<=": ">=", ">": "<", "<": ">", "=": "="}[op]
+			if !isColumnRef(left, column) {
+				return false
+			}
+		}
+		if op == "=" && checkStringPattern.MatchString(right) {
+			check.values = checkStringPattern.FindAllString(right, 1)
+			continue
+		}
+		value, ok := checkConstant(right)
+		if !ok {
+			return false
+		}
+		switch op {
+		case ">", ">=":
+			if !check.hasMin || value > check.min {
+				check.min, check.hasMin, check.minExclusive = value, true, op == ">"
+			}
+		case "<", "<=":
+			if !check.hasMax || value < check.max {
+				check.max, check.hasMax, check.maxExclusive = value, true, op == "<"
+			}
+		case "=":
+			check.values = []string{strconv.FormatFloat(value, 'f', -1, 64)}
+		}
+	}
+	return true
+}
+
+// stripParens removes parentheses enclosing all of expr.
+func stripParens(expr string) string {
+	for strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+		depth := 0
+		for i, c := range expr {
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+			if depth == 0 && i < len(expr)-1 {
+				return expr
+			}
+		}
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	return expr
+}
+
+// splitTopLevel splits expr at sep outside of parentheses and quotes.
+func splitTopLevel(expr, sep string) []string {
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(expr[i:], sep):
+			parts = append(parts, expr[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// isColumnRef reports whether expr refers to column, possibly cast.
+func isColumnRef(expr, column string) bool {
+	expr = stripParens(checkCastPattern.ReplaceAllString(stripParens(expr), ""))
+	return expr == column || expr == `"`+column+`"`
+}
+
+// checkConstant parses a numeric constant like 0, (-1) or '1.5'::numeric.
+func checkConstant(expr string) (float64, bool) {
+	expr = stripParens(checkCastPattern.ReplaceAllString(stripParens(expr), ""))
+	expr = strings.ReplaceAll(strings.Trim(stripParens(expr), "'"), " ", "")
+	value, err := strconv.ParseFloat(expr, 64)
+	return value, err == nil
+}
+
+// checkedValueExpr returns the SQL expression generating values satisfying
+// check for column c, or an empty string if check does not restrict the
+// type of c.
+func checkedValueExpr(c tableColumn, check *valueCheck) string {
+	if len(check.values) > 0 {
+		return fmt.Sprintf("(ARRAY[%s])[1 + floor(random() * %d)::int]::%s", strings.Join(check.values, ", "), len(check.values), c.typ)
+	}
+	if !check.hasMin && !check.hasMax {
+		return ""
+	}
+
+	integer := isIntegerType(c.typName)
+	if !integer && c.typName != "numeric" && c.typName != "float4" && c.typName != "float8" {
+		return ""
+	}
+	// Steps are the smallest distance between two values of the type, so
+	// exclusive bounds can be turned into inclusive ones.
+	step := 0.0
+	switch {
+	case integer:
+		step = 1
+	case c.typName == "numeric" && c.typmod > 4:
+		step = math.Pow10(-int((c.typmod - 4) & 0xffff))
+	}
+
+	lo, hi := check.min, check.max
+	switch {
+	case !check.hasMin:
+		lo = min(0, hi-1000)
+	case !check.hasMax:
+		hi = lo + 1000000
+	}
+	if check.hasMin && check.minExclusive {
+		lo += step
+	}
+	if check.hasMax && check.maxExclusive {
+		hi -= step
+	}
+
+	if integer {
+		lo, hi = math.Ceil(lo), math.Floor(hi)
+		return fmt.Sprintf("(%s + floor(random() * %s))::%s", formatConstant(lo), formatConstant(hi-lo+1), c.typ)
+	}
+	if step > 0 {
+		scale := (c.typmod - 4) & 0xffff
+		return fmt.Sprintf("trunc((%s + random() * %s)::numeric, %d)::%s", formatConstant(lo), formatConstant(hi-lo), scale, c.typ)
+	}
+	return fmt.Sprintf("(%s + random() * %s)::%s", formatConstant(lo), formatConstant(hi-lo), c.typ)
+}
+
+func formatConstant(value float64) string {
+	return "(" + strconv.FormatFloat(value, 'f', -1, 64) + ")"
+}
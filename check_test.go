@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCheck(t *testing.T) {
+	tests := []struct {
+		name, def, column string
+		want              valueCheck
+		ok                bool
+	}{
+		{"range", "CHECK (((quantity > 0) AND (quantity <= 100)))", "quantity",
+			valueCheck{min: 0, hasMin: true, minExclusive: true, max: 100, hasMax: true}, true},
+		{"constant on the left", "CHECK ((0 < quantity))", "quantity",
+			valueCheck{min: 0, hasMin: true, minExclusive: true}, true},
+		{"cast constant", "CHECK ((unit_price >= (0)::numeric))", "unit_price",
+			valueCheck{min: 0, hasMin: true}, true},
+		{"quoted negative constant", "CHECK ((discount > '-1.5'::numeric))", "discount",
+			valueCheck{min: -1.5, hasMin: true, minExclusive: true}, true},
+		{"tighter bound wins", "CHECK (((quantity > 0) AND (quantity >= 5)))", "quantity",
+			valueCheck{min: 5, hasMin: true}, true},
+		{"string list", "CHECK ((status = ANY (ARRAY['new'::text, 'paid'::text])))", "status",
+			valueCheck{values: []string{"'new'", "'paid'"}}, true},
+		{"number list", "CHECK ((rating = ANY (ARRAY[1, 2, 3])))", "rating",
+			valueCheck{values: []string{"1", "2", "3"}}, true},
+		{"cast column equals string", "CHECK (((code)::text = 'x'::text))", "code",
+			valueCheck{values: []string{"'x'"}}, true},
+		{"not null not valid", "CHECK ((quantity IS NOT NULL)) NOT VALID", "quantity", valueCheck{}, true},
+		{"function call", "CHECK ((char_length(name) > 3))", "name", valueCheck{}, false},
+		{"other column", "CHECK ((other > 0))", "quantity", valueCheck{}, false},
+		{"not a check", "UNIQUE (quantity)", "quantity", valueCheck{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got valueCheck
+			ok := parseCheck(tt.def, tt.column, &got)
+			if ok != tt.ok {
+				t.Fatalf("parseCheck(%q) = %v, want %v", tt.def, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCheck(%q) check = %+v, want %+v", tt.def, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTopLevel(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"a > 0", []string{"a > 0"}},
+		{"(a > 0) AND (a < 9)", []string{"(a > 0)", "(a < 9)"}},
+		{"((a > 0) AND (a < 9)) AND (b > 1)", []string{"((a > 0) AND (a < 9))", "(b > 1)"}},
+		{"(a = 'x AND y') AND (b > 1)", []string{"(a = 'x AND y')", "(b > 1)"}},
+	}
+	for _, tt := range tests {
+		if got := splitTopLevel(tt.expr, " AND "); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTopLevel(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCheckConstant(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"(-1)", -1, true},
+		{"'1.5'::numeric", 1.5, true},
+		{"(100)::double precision", 100, true},
+		{"'abc'::text", 0, false},
+		{"random()", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := checkConstant(tt.expr)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("checkConstant(%q) = %v, %v, want %v, %v", tt.expr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
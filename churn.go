@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// churnTables lists the tables supported by the churn workload with their
+// key column and the SET clause of the update, whose values are drawn from
+// the generator of the worker. Updates only touch columns without an index
+// so they are eligible for HOT. Deletes are limited to tables no foreign key
+// points to.
+var churnTables = map[string]struct {
+	key       string
+	set       func(r *rand.Rand) string
+	deletable bool
+}{
+	"bigtable": {"bigtable_id", func(r *rand.Rand) string {
+		return fmt.Sprintf("cola = md5('%d')", r.Uint64())
+	}, true},
+	"timestamp": {"id", func(*rand.Rand) string { return "created_at = NOW()" }, true},
+	"invoice_line": {"invoice_line_id", func(r *rand.Rand) string {
+		return fmt.Sprintf("quantity = %d", 1+r.IntN(5))
+	}, true},
+	"artist": {"artist_id", func(r *rand.Rand) string {
+		return fmt.Sprintf("name = md5('%d')", r.Uint64())
+	}, false},
+	"track": {"track_id", func(r *rand.Rand) string {
+		return "unit_price = " + pick(r, []string{"0.99", "1.29", "1.99"})
+	}, false},
+	"customer": {"customer_id", func(r *rand.Rand) string {
+		return fmt.Sprintf("email = md5('%d') || '@example.com'", r.Uint64())
+	}, false},
+	"employee": {"employee_id", func(r *rand.Rand) string {
+		return fmt.Sprintf("phone = md5('%d')::varchar(24)", r.Uint64())
+	}, false},
+}
+
+type churnRates struct {
+	UpdatesPerSecond float64 `json:"updates_per_second"`
+	DeletesPerSecond float64 `json:"deletes_per_second"`
+}
+
+func validateChurnTables(tables map[string]churnRates) error {
+	for table, rates := range tables {
+		t, ok := churnTables[table]
+		if !ok {
+			return fmt.Errorf("table '%s' is not supported by churn", table)
+		}
+		if rates.UpdatesPerSecond < 0 || rates.DeletesPerSecond < 0 {
+			return fmt.Errorf("churn rates of table '%s' cannot be negative", table)
+		}
+		if rates.DeletesPerSecond > 0 && !t.deletable {
+			return fmt.Errorf("table '%s' is referenced by foreign keys and does not support churn deletes", table)
+		}
+	}
+	return nil
+}
+
+// startChurn starts one update and one delete worker per configured table,
+// each touching a random existing row at its configured rate.
+func startChurn(e *workerEngine, ctx context.Context, pool *pgxpool.Pool, schemas []string, seed uint64, tables map[string]churnRates, keys keyDistribution) {
+	for table, rates := range tables {
+		t := churnTables[table]
+		if rates.UpdatesPerSecond > 0 {
+			e.start(churnSpec(ctx, pool, newRateLimiter(rates.UpdatesPerSecond), newRand(seed, "churn-update-"+table), schemas, table, "update", func(r *rand.Rand, schema string) string {
+				return fmt.Sprintf(`UPDATE %s SET %s WHERE %s = %s`, qualifiedTable(schema, table), t.set(r), t.key, sampleIDExpr(r, keys, schema, table, t.key))
+			}))
+		}
+		if rates.DeletesPerSecond > 0 {
+			e.start(churnSpec(ctx, pool, newRateLimiter(rates.DeletesPerSecond), newRand(seed, "churn-delete-"+table), schemas, table, "delete", func(r *rand.Rand, schema string) string {
+				return fmt.Sprintf(`DELETE FROM %s WHERE %s = %s`, qualifiedTable(schema, table), t.key, sampleIDExpr(r, keys, schema, table, t.key))
+			}))
+		}
+	}
+}
+
+func churnSpec(ctx context.Context, pool *pgxpool.Pool, limiter *rateLimiter, r *rand.Rand, schemas []string, table, op string, query func(r *rand.Rand, schema string) string) workerSpec {
+	return workerSpec{
+		name:        table,
+		description: fmt.Sprintf("churn %s worker for table %s", op, table),
+		limiter:     limiter,
+		newTask: func(int) task {
+			return func() (outcome, error) {
+				tag, err := pool.Exec(ctx, query(r, pickSchema(r, schemas)))
+				if op == "update" {
+					return outcome{updated: tag.RowsAffected()}, err
+				}
+				return outcome{deleted: tag.RowsAffected()}, err
+			}
+		},
+	}
+}
+
+// printChurnReport prints the counters autovacuum and HOT updates are
+// judged by for the churned tables.
+func printChurnReport(ctx context.Context, pool *pgxpool.Pool, schemas []string, tables map[string]churnRates) error {
+	fmt.Println("Churn report:")
+	for _, schema := range schemas {
+		for table := range tables {
+			var upd, hot, del, live, dead, autovacuums int64
+			err := pool.QueryRow(ctx, `SELECT n_tup_upd, n_tup_hot_upd, n_tup_del, n_live_tup, n_dead_tup, autovacuum_count
+				FROM pg_stat_user_tables WHERE relid = to_regclass($1)`, qualifiedTable(schema, table)).Scan(&upd, &hot, &del, &live, &dead, &autovacuums)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("reading statistics of %s failed: %w", table, err)
+			}
+			hotRatio := 0.0
+			if upd > 0 {
+				hotRatio = float64(hot) / float64(upd) * 100
+			}
+			fmt.Printf("  %-15s updated=%d hot=%.1f%% deleted=%d live=%d dead=%d autovacuums=%d\n",
+				qualifiedTable(schema, table), upd, hotRatio, del, live, dead, autovacuums)
+		}
+	}
+	return nil
+}
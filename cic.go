@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// indexColumns is the column indexed by the concurrent index workload for
+// each table it supports.
+var indexColumns = map[string]string{
+	"bigtable":  "cola",
+	"timestamp": "created_at",
+	"artist":    "name",
+	"genre":     "name",
+	"playlist":  "name",
+	"employee":  "email",
+	"track":     "name",
+}
+
+// concurrentIndexes is the concurrent index workload, which repeatedly
+// builds an index CONCURRENTLY on its tables while the insert workers keep
+// writing, reports the build duration and whether the index ended up
+// invalid, and drops it again CONCURRENTLY.
+type concurrentIndexes struct {
+	mu      sync.Mutex
+	builds  map[string]int
+	invalid map[string]int
+	total   map[string]time.Duration
+}
+
+// startConcurrentIndexes starts a worker per table, with a goroutine per
+// schema, building an index every interval.
+func startConcurrentIndexes(e *workerEngine, execCtx context.Context, pool *pgxpool.Pool, schemas, tables []string, interval time.Duration) *concurrentIndexes {
+	c := &concurrentIndexes{builds: map[string]int{}, invalid: map[string]int{}, total: map[string]time.Duration{}}
+	for _, table := range tables {
+		if !e.selected(table) {
+			continue
+		}
+		e.start(workerSpec{
+			name:        "concurrent_index_" + table,
+			description: "concurrent index builds on table " + table,
+			concurrency: len(schemas),
+			interval:    interval,
+			newTask: func(i int) task {
+				return c.task(execCtx, pool, schemas[i%len(schemas)], table)
+			},
+		})
+	}
+	return c
+}
+
+// task returns a task building and dropping the index of table in schema
+// once. A failed build is a result of the workload, not an error of it.
+func (c *concurrentIndexes) task(execCtx context.Context, pool *pgxpool.Pool, schema, table string) task {
+	column := indexColumns[table]
+	indexName := "demo_db_cic_" + table + "_idx"
+	qualifiedIndex := qualifiedTable(schema, indexName)
+	// Messages name the schema, since every tenant schema has an indexer.
+	name, index := table, indexName
+	if schema != "" {
+		name, index = schema+"."+table, schema+"."+indexName
+	}
+
+	return func() (outcome, error) {
+		start := time.Now()
+		_, err := pool.Exec(execCtx, fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON %s (%s)",
+			pgx.Identifier{indexName}.Sanitize(), qualifiedTable(schema, table), pgx.Identifier{column}.Sanitize()))
+		elapsed := time.Since(start)
+		if err != nil {
+			fmt.Printf("Concurrent index build on %s failed after %s: %v\n", name, elapsed.Round(time.Millisecond), err)
+		}
+
+		var valid *bool
+		if err := pool.QueryRow(execCtx, `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`, qualifiedIndex).Scan(&valid); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			fmt.Printf("Error checking index %s: %v\n", index, err)
+		}
+
+		c.mu.Lock()
+		switch {
+		case valid == nil:
+			// The build failed before the catalog entry was created.
+		case *valid:
+			c.builds[name]++
+			c.total[name] += elapsed
+			fmt.Printf("Built index %s concurrently in %s\n", index, elapsed.Round(time.Millisecond))
+		default:
+			c.invalid[name]++
+			fmt.Printf("Index %s is INVALID after a failed concurrent build\n", index)
+		}
+		c.mu.Unlock()
+
+		if _, err := pool.Exec(execCtx, "DROP INDEX CONCURRENTLY IF EXISTS "+qualifiedIndex); err != nil {
+			fmt.Printf("Error dropping index %s: %v\n", index, err)
+		}
+		return outcome{}, nil
+	}
+}
+
+// report prints the builds of every table that had a successful one.
+func (c *concurrentIndexes) report() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range slices.Sorted(maps.Keys(c.builds)) {
+		builds := c.builds[name]
+		fmt.Printf("Concurrent index builds on %s: %d built, %d invalid, avg %s\n",
+			name, builds, c.invalid[name], (c.total[name] / time.Duration(builds)).Round(time.Millisecond))
+	}
+}
+
+func validateIndexTables(tables []string) error {
+	for _, t := range tables {
+		if _, ok := indexColumns[t]; !ok {
+			return fmt.Errorf("table '%s' is not supported by concurrent_indexes", t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// preparedTxPrefix is the prefix of the global ids of transactions
+// prepared by the tool. Only those are rolled back by --cleanup.
+const preparedTxPrefix = "demo_db_"
+
+// cleanup rolls back prepared transactions left by crashed runs and lists
+// the sessions of other demo-db processes, recognised by the application_name
+// set in connectPool. The server cannot tell a session left behind by a run
+// from one of a run still going, so they are only terminated, releasing the
+// advisory and row locks they hold, with -all and after a confirmation. The
+// connections of this process are left alone.
+func cleanup(ctx context.Context, pool *pgxpool.Pool, flags *CommandFlags) error {
+	own, err := ownBackendPIDs(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	rows, err := pool.Query(ctx, `SELECT gid FROM pg_prepared_xacts WHERE database = current_database() AND starts_with(gid, $1)`, preparedTxPrefix)
+	if err != nil {
+		return fmt.Errorf("listing prepared transactions failed: %w", err)
+	}
+	gids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("listing prepared transactions failed: %w", err)
+	}
+	for _, gid := range gids {
+		if _, err := pool.Exec(ctx, "ROLLBACK PREPARED "+quoteLiteral(gid)); err != nil {
+			return fmt.Errorf("rolling back prepared transaction %s failed: %w", gid, err)
+		}
+		fmt.Printf("Rolled back prepared transaction %s\n", gid)
+	}
+
+	rows, err = pool.Query(ctx, `SELECT a.pid, a.state, COALESCE(a.backend_start::text, ''),
+			(SELECT count(*) FROM pg_locks l WHERE l.pid = a.pid AND l.locktype = 'advisory')
+		FROM pg_stat_activity a
+		WHERE a.application_name = $1 AND a.datname = current_database() AND NOT a.pid = ANY($2)
+		ORDER BY a.pid`, applicationName, own)
+	if err != nil {
+		return fmt.Errorf("listing leftover sessions failed: %w", err)
+	}
+	type session struct {
+		pid           int32
+		state, start  string
+		advisoryLocks int64
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (session, error) {
+		var s session
+		var state *string
+		err := row.Scan(&s.pid, &state, &s.start, &s.advisoryLocks)
+		if state != nil {
+			s.state = *state
+		}
+		return s, err
+	})
+	if err != nil {
+		return fmt.Errorf("listing leftover sessions failed: %w", err)
+	}
+
+	for _, s := range sessions {
+		fmt.Printf("Session %d (state %s, started %s, %d advisory locks)\n", s.pid, s.state, s.start, s.advisoryLocks)
+	}
+	if len(sessions) > 0 && !flags.All {
+		fmt.Printf("Cleanup completed: %d prepared transactions rolled back, %d demo-db sessions left running, they may belong to a running instance, pass -all to terminate them.\n",
+			len(gids), len(sessions))
+		return nil
+	}
+	if len(sessions) > 0 {
+		ok, err := confirm(flags, fmt.Sprintf("Terminate %d demo-db sessions, including those of instances still running?", len(sessions)))
+		if err != nil {
+			return fmt.Errorf("terminating sessions needs a confirmation: %w", err)
+		}
+		if !ok {
+			sessions = nil
+			fmt.Println("Leaving the sessions running")
+		}
+	}
+
+	var terminatedSessions, locks int64
+	for _, s := range sessions {
+		var terminated bool
+		if err := pool.QueryRow(ctx, `SELECT pg_terminate_backend($1)`, s.pid).Scan(&terminated); err != nil {
+			return fmt.Errorf("terminating session %d failed: %w", s.pid, err)
+		}
+		if terminated {
+			terminatedSessions++
+			locks += s.advisoryLocks
+			fmt.Printf("Terminated session %d (state %s, started %s, %d advisory locks)\n", s.pid, s.state, s.start, s.advisoryLocks)
+		}
+	}
+
+	fmt.Printf("Cleanup completed: %d prepared transactions rolled back, %d sessions terminated, %d advisory locks released.\n",
+		len(gids), terminatedSessions, locks)
+	return nil
+}
+
+// ownBackendPIDs returns the backend pids of the idle connections of pool,
+// which are all of its connections when nothing else is running.
+func ownBackendPIDs(ctx context.Context, pool *pgxpool.Pool) ([]int32, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pids := []int32{int32(conn.Conn().PgConn().PID())}
+	conn.Release()
+
+	for _, c := range pool.AcquireAllIdle(ctx) {
+		if pid := int32(c.Conn().PgConn().PID()); !slices.Contains(pids, pid) {
+			pids = append(pids, pid)
+		}
+		c.Release()
+	}
+	return pids, nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
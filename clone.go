@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cloneChunkRows is the number of rows generated by a single INSERT of the
+// clone, so a large table can be interrupted between statements.
+const cloneChunkRows = 100000
+
+// cloneColumnExpr returns the SQL expression generating the values of a
+// column for row number g, or an empty string for unsupported types.
+// Integer foreign keys to the row number key of a generated table pick one
+// of its rows.
+func cloneColumnExpr(t *tableInfo, c tableColumn, generated map[string]*tableInfo) string {
+	if c.name == t.rowIndexKey() {
+		return "g::" + c.typ
+	}
+	for _, fk := range t.foreignKeys {
+		if len(fk.columns) != 1 || fk.columns[0] != c.name || !isIntegerType(c.typName) {
+			continue
+		}
+		if fk.refTable == t.name && t.rowIndexKey() == fk.refColumns[0] {
+			// Self references point at a row generated before.
+			return fmt.Sprintf("(CASE WHEN g > 1 THEN 1 + floor(random() * (g - 1)) END)::%s", c.typ)
+		}
+		parent, ok := generated[fk.refTable]
+		if !ok || parent.rowIndexKey() != fk.refColumns[0] {
+			break
+		}
+		if parent.rows == 0 {
+			return "NULL"
+		}
+		return fmt.Sprintf("(1 + floor(random() * %d))::%s", parent.rows, c.typ)
+	}
+
+	return valueExpr(c, t.unique(c.name), "g")
+}
+
+// runClone copies the structure and row counts of clone.schema in the
+// database at clone.source_url into the configured database, filling the
+// tables with synthetic values so the copy can be shared.
+func runClone(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	clone := cfg.Clone
+	if clone.SourceURL == "" {
+		return fmt.Errorf("clone.source_url is required")
+	}
+	schema := clone.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	targetSchema := clone.TargetSchema
+	if targetSchema == "" {
+		targetSchema = schema
+	}
+	scale := clone.ScalePercent
+	if scale <= 0 {
+		scale = 100
+	}
+
+	source := *cfg
+	// The source URL carries its own TLS settings.
+	var defaults InserterConfig
+	source.TLS = defaults.TLS
+	if err := setConnectionURL(&source, clone.SourceURL); err != nil {
+		return fmt.Errorf("clone.source_url: %w", err)
+	}
+	if source.Host == cfg.Host && source.Port == cfg.Port && source.Database == cfg.Database && schema == targetSchema {
+		return fmt.Errorf("the clone would overwrite its source, set clone.target_schema or point the config at another database")
+	}
+	sourcePool, err := connectPool(&source)
+	if err != nil {
+		return fmt.Errorf("connecting to the source database failed: %w", err)
+	}
+	defer sourcePool.Close()
+
+	tables, err := introspectSchema(ctx, sourcePool, schema, targetSchema)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("schema %s of the source database has no tables", schema)
+	}
+	fmt.Printf("Cloning %d tables of schema %s into schema %s...\n", len(tables), schema, targetSchema)
+
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{targetSchema}.Sanitize()); err != nil {
+		return fmt.Errorf("creating schema %s failed: %w", targetSchema, err)
+	}
+
+	// generated holds the cloned tables, with rows set to the number of
+	// rows that were generated.
+	generated := map[string]*tableInfo{}
+	var cloned []*tableInfo
+	for _, t := range referenceOrder(tables) {
+		target := qualifiedTable(targetSchema, t.name)
+
+		definitions := make([]string, 0, len(t.columns)+len(t.keyDefs))
+		names := make([]string, 0, len(t.columns))
+		exprs := make([]string, 0, len(t.columns))
+		unsupported := ""
+		for _, c := range t.columns {
+			expr := cloneColumnExpr(t, c, generated)
+			if expr == "" {
+				unsupported = fmt.Sprintf("column %s has unsupported type %s", c.name, c.typ)
+				break
+			}
+			definition := pgx.Identifier{c.name}.Sanitize() + " " + c.typ
+			if c.notNull {
+				definition += " NOT NULL"
+			}
+			definitions = append(definitions, definition)
+			names = append(names, pgx.Identifier{c.name}.Sanitize())
+			exprs = append(exprs, expr)
+		}
+		if unsupported != "" {
+			fmt.Printf("Skipping table %s: %s\n", t.name, unsupported)
+			continue
+		}
+		definitions = append(definitions, t.keyDefs...)
+
+		if _, err := pool.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", target, strings.Join(definitions, ",\n\t"))); err != nil {
+			return fmt.Errorf("creating table %s failed: %w", target, err)
+		}
+		if err := registerObjects(ctx, pool, managedObject{Kind: "table", Schema: targetSchema, Name: t.name}); err != nil {
+			return err
+		}
+
+		rows := int64(math.Ceil(float64(t.rows) * scale / 100))
+		if clone.MaxRowsPerTable > 0 {
+			rows = min(rows, clone.MaxRowsPerTable)
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM generate_series($1::bigint, $2::bigint) AS g ON CONFLICT DO NOTHING",
+			target, strings.Join(names, ", "), strings.Join(exprs, ", "))
+		var inserted int64
+		for start := int64(1); start <= rows; start += cloneChunkRows {
+			tag, err := pool.Exec(ctx, query, start, min(start+cloneChunkRows-1, rows))
+			if err != nil {
+				return fmt.Errorf("generating rows of %s failed: %w", target, err)
+			}
+			inserted += tag.RowsAffected()
+		}
+		t.rows = rows
+		generated[t.name] = t
+		cloned = append(cloned, t)
+		fmt.Printf("Generated %d of %d rows in %s\n", inserted, rows, target)
+	}
+
+	for _, t := range cloned {
+		target := qualifiedTable(targetSchema, t.name)
+		for _, index := range t.indexes {
+			if _, err := pool.Exec(ctx, index); err != nil {
+				fmt.Printf("Error creating index on %s: %v\n", target, err)
+			}
+		}
+		for _, fk := range t.foreignKeys {
+			if _, ok := generated[fk.refTable]; !ok {
+				fmt.Printf("Skipping foreign key %s of %s, table %s was not cloned\n", fk.name, t.name, fk.refTable)
+				continue
+			}
+			constraint := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)%s", target,
+				pgx.Identifier{fk.name}.Sanitize(), joinIdentifiers(fk.columns), qualifiedTable(targetSchema, fk.refTable),
+				joinIdentifiers(fk.refColumns), fk.actions)
+			if _, err := pool.Exec(ctx, constraint); err != nil {
+				// Generated values of composite or non-integer keys rarely
+				// match, keep the constraint for new rows only.
+				if _, err := pool.Exec(ctx, constraint+" NOT VALID"); err != nil {
+					fmt.Printf("Error adding foreign key %s to %s: %v\n", fk.name, target, err)
+					continue
+				}
+				fmt.Printf("Foreign key %s of %s added as NOT VALID, generated rows do not satisfy it\n", fk.name, target)
+			}
+		}
+		for _, check := range t.checks {
+			if !check.parsed {
+				fmt.Printf("Skipping check constraint %s of %s, generated rows would not satisfy it\n", check.name, target)
+				continue
+			}
+			constraint := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", target, pgx.Identifier{check.name}.Sanitize(), strings.TrimSuffix(check.def, " NOT VALID"))
+			if _, err := pool.Exec(ctx, constraint); err != nil {
+				fmt.Printf("Error adding check constraint %s to %s: %v\n", check.name, target, err)
+			}
+		}
+	}
+
+	fmt.Printf("Cloned %d of %d tables.\n", len(cloned), len(tables))
+	return nil
+}
+
+func joinIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pgx.Identifier{name}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
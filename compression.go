@@ -0,0 +1,220 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// compressionSourceTable holds the generated values every variant of the
+// compression experiment is loaded from, so all of them store the same data.
+const compressionSourceTable = "demo_db_compression_source"
+
+// compressionVariant is a way of storing the payload column.
+type compressionVariant struct {
+	name string
+	// compression is the compression method of the column, empty for the
+	// default_toast_compression of the server.
+	compression string
+	// storage is the storage strategy of the column, empty for EXTENDED.
+	storage string
+	// toastTupleTarget is the toast_tuple_target of the table, 0 for the
+	// default of about 2kB.
+	toastTupleTarget int
+}
+
+// compressionVariants are the variants compared by the experiment, in the
+// order they run.
+var compressionVariants = []compressionVariant{
+	{name: "pglz", compression: "pglz"},
+	{name: "lz4", compression: "lz4"},
+	{name: "lz4_main", compression: "lz4", storage: "MAIN"},
+	{name: "lz4_toast_256", compression: "lz4", toastTupleTarget: 256},
+	{name: "uncompressed", storage: "EXTERNAL"},
+}
+
+func compressionVariantNames() []string {
+	names := make([]string, len(compressionVariants))
+	for i, v := range compressionVariants {
+		names[i] = v.name
+	}
+	return names
+}
+
+// table returns the name of the table of the variant.
+func (v compressionVariant) table() string {
+	return "demo_db_compression_" + v.name
+}
+
+// createStatements return the statements creating the table of the
+// variant. The storage is set separately, as CREATE TABLE only takes it
+// since PostgreSQL 16.
+func (v compressionVariant) createStatements() []string {
+	table := qualifiedTable("", v.table())
+	column := "payload TEXT"
+	if v.compression != "" {
+		column += " COMPRESSION " + v.compression
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (id BIGINT PRIMARY KEY, %s)", table, column)
+	if v.toastTupleTarget > 0 {
+		create += fmt.Sprintf(" WITH (toast_tuple_target = %d)", v.toastTupleTarget)
+	}
+	statements := []string{"DROP TABLE IF EXISTS " + table, create}
+	if v.storage != "" {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN payload SET STORAGE %s", table, v.storage))
+	}
+	return statements
+}
+
+// compressionResult is the measurement of one variant.
+type compressionResult struct {
+	variant    string
+	duration   time.Duration
+	heapBytes  int64
+	toastBytes int64
+	totalBytes int64
+	// storedBytes is the space taken by the values as stored, compressed
+	// or not, and rawBytes their uncompressed length.
+	storedBytes int64
+	rawBytes    int64
+}
+
+// loadCompressionSource creates the source table and copies rows values of
+// valueBytes characters into it. Its column is stored uncompressed, so
+// reading it costs every variant the same.
+func loadCompressionSource(ctx context.Context, pool *pgxpool.Pool, seed uint64, rows, valueBytes int, lowEntropy bool) error {
+	table := qualifiedTable("", compressionSourceTable)
+	steps := []string{
+		"DROP TABLE IF EXISTS " + table,
+		fmt.Sprintf("CREATE TABLE %s (id BIGINT PRIMARY KEY, payload TEXT)", table),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN payload SET STORAGE EXTERNAL", table),
+	}
+	for _, step := range steps {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return fmt.Errorf("creating %s failed: %w", compressionSourceTable, err)
+		}
+	}
+	r := newRand(seed, "compression_experiment")
+	i := 0
+	_, err := pool.CopyFrom(ctx, pgx.Identifier{compressionSourceTable}, []string{"id", "payload"}, pgx.CopyFromFunc(func() ([]any, error) {
+		if i >= rows {
+			return nil, nil
+		}
+		i++
+		return []any{i, bigtableValue(r, valueBytes, lowEntropy)}, nil
+	}))
+	if err != nil {
+		return fmt.Errorf("loading %s failed: %w", compressionSourceTable, err)
+	}
+	return nil
+}
+
+// runCompressionVariant loads the source rows into a new table of the
+// variant and measures the load time and the space taken.
+func runCompressionVariant(ctx context.Context, pool *pgxpool.Pool, v compressionVariant) (compressionResult, error) {
+	result := compressionResult{variant: v.name}
+	table := qualifiedTable("", v.table())
+	for _, step := range v.createStatements() {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return result, fmt.Errorf("creating %s failed: %w", v.table(), err)
+		}
+	}
+
+	started := time.Now()
+	_, err := pool.Exec(ctx, fmt.Sprintf("INSERT INTO %s SELECT id, payload FROM %s", table, qualifiedTable("", compressionSourceTable)))
+	result.duration = time.Since(started)
+	if err != nil {
+		return result, fmt.Errorf("loading %s failed: %w", v.table(), err)
+	}
+
+	err = pool.QueryRow(ctx, fmt.Sprintf(`SELECT pg_relation_size($1::regclass),
+			COALESCE((SELECT pg_total_relation_size(reltoastrelid) FROM pg_class WHERE oid = $1::regclass AND reltoastrelid <> 0), 0),
+			pg_total_relation_size($1::regclass),
+			COALESCE(sum(pg_column_size(payload)), 0)::bigint, COALESCE(sum(octet_length(payload)), 0)::bigint
+		FROM %s`, table), table).Scan(&result.heapBytes, &result.toastBytes, &result.totalBytes, &result.storedBytes, &result.rawBytes)
+	if err != nil {
+		return result, fmt.Errorf("reading the size of %s failed: %w", v.table(), err)
+	}
+	return result, nil
+}
+
+// runCompressionExperiment loads the same generated values into a table
+// per compression variant and compares their size and load time.
+func runCompressionExperiment(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	exp := cfg.CompressionExperiment
+	rows := exp.Rows
+	if rows <= 0 {
+		rows = 100_000
+	}
+	valueBytes := exp.ValueBytes
+	if valueBytes <= 0 {
+		valueBytes = 4000
+	}
+	names := exp.Variants
+	if len(names) == 0 {
+		names = compressionVariantNames()
+	}
+
+	// Column compression methods exist since PostgreSQL 14, and lz4 only
+	// when the server was built with it.
+	var methods []string
+	err := pool.QueryRow(ctx, `SELECT COALESCE((SELECT enumvals FROM pg_settings WHERE name = 'default_toast_compression'), '{}')`).Scan(&methods)
+	if err != nil {
+		return err
+	}
+	if len(methods) == 0 {
+		return fmt.Errorf("the server does not support column compression methods, it needs PostgreSQL 14 or later")
+	}
+	var variants []compressionVariant
+	for _, v := range compressionVariants {
+		if !slices.Contains(names, v.name) {
+			continue
+		}
+		if v.compression != "" && !slices.Contains(methods, v.compression) {
+			fmt.Printf("Skipping variant %s, the server does not support %s compression\n", v.name, v.compression)
+			continue
+		}
+		variants = append(variants, v)
+	}
+	if len(variants) == 0 {
+		return fmt.Errorf("no variant of %v can run on this server", names)
+	}
+
+	entropy := cmp.Or(exp.Entropy, "low")
+	fmt.Printf("Loading %d rows of %d characters of %s entropy into %d tables...\n", rows, valueBytes, entropy, len(variants))
+	defer func() {
+		for _, v := range variants {
+			pool.Exec(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS "+qualifiedTable("", v.table()))
+		}
+		pool.Exec(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS "+qualifiedTable("", compressionSourceTable))
+	}()
+	if err := loadCompressionSource(ctx, pool, runSeed(cfg), rows, valueBytes, entropy == "low"); err != nil {
+		return err
+	}
+
+	var results []compressionResult
+	for _, v := range variants {
+		fmt.Printf("Loading variant %s...\n", v.name)
+		result, err := runCompressionVariant(ctx, pool, v)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	fmt.Printf("\n%-14s %12s %10s %10s %10s %10s %8s\n", "VARIANT", "LOAD TIME", "HEAP", "TOAST", "TOTAL", "VALUES", "RATIO")
+	for _, r := range results {
+		ratio := 0.0
+		if r.storedBytes > 0 {
+			ratio = float64(r.rawBytes) / float64(r.storedBytes)
+		}
+		fmt.Printf("%-14s %12s %10s %10s %10s %10s %7.2fx\n", r.variant, r.duration.Round(time.Millisecond),
+			formatBytes(r.heapBytes), formatBytes(r.toastBytes), formatBytes(r.totalBytes), formatBytes(r.storedBytes), ratio)
+	}
+	return nil
+}
@@ -1,19 +1,46 @@
 package main
 
 import (
-	"encoding/json"
+	"cmp"
 	"flag"
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// CommandFlags holds the command to run and the flags given to it.
 type CommandFlags struct {
-	ConfigPath   string
-	Insert       bool
-	DropTables   bool
-	Recreate     bool
-	Validate     bool
-	CreateTables bool
+	Command       string
+	ConfigPath    string
+	ConfigFormat  string
+	PidFile       string
+	Tables        []string
+	RecordFile    string
+	ReplaySpeed   float64
+	Seed          *uint64
+	Duration      time.Duration
+	NoPrompt      bool
+	Yes           bool
+	JSON          bool
+	All           bool
+	SchemaDir     string
+	Inject        []anomalySpec
+	ScenarioFile  string
+	ScenarioName  string
+	ListScenarios bool
+	NoBreakpoints bool
+	ResumeAddress string
+	DumpFormat    string
+	DumpDir       string
+	// ShowEffectiveConfig prints the configuration instead of running the
+	// command.
+	ShowEffectiveConfig bool
 }
 
 // type InserterConfig struct {
@@ -29,105 +56,994 @@ type CommandFlags struct {
 // }
 
 type InserterConfig struct {
-	Host     string `json:"host"`
-	Port     string `json:"port"`
-	Database string `json:"database"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	URL             string `json:"url"`
+	Host            string `json:"host"`
+	Port            string `json:"port"`
+	Database        string `json:"database"`
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	PasswordFile    string `json:"password_file"`
+	PasswordCommand string `json:"password_command"`
+	TLS             struct {
+		SSLMode    string `json:"sslmode"`
+		RootCert   string `json:"root_cert"`
+		ClientCert string `json:"client_cert"`
+		ClientKey  string `json:"client_key"`
+		ServerName string `json:"server_name"`
+	} `json:"tls"`
 	Inserter struct {
+		Tables      []string `json:"tables"`
 		WalSwitcher struct {
 			Enabled       bool `json:"enabled"`
 			EveryNSeconds int  `json:"every_n_seconds"`
 		} `json:"wal_switcher"`
 		TimestampInserts struct {
-			Enabled       bool `json:"enabled"`
-			EveryNSeconds int  `json:"every_n_seconds"`
+			Enabled       bool    `json:"enabled"`
+			EveryNSeconds int     `json:"every_n_seconds"`
+			BatchSize     int     `json:"batch_size"`
+			RatePerSecond float64 `json:"rate_per_second"`
 		} `json:"timestamp_inserts"`
 		BigTableInserts struct {
-			Enabled       bool `json:"enabled"`
-			EveryNSeconds int  `json:"every_n_seconds"`
+			Enabled       bool    `json:"enabled"`
+			EveryNSeconds int     `json:"every_n_seconds"`
+			BatchSize     int     `json:"batch_size"`
+			RatePerSecond float64 `json:"rate_per_second"`
+			// Entropy of the values, high (default) or low.
+			Entropy string `json:"entropy"`
 		} `json:"bigtable_inserts"`
+		BulkInserts struct {
+			Enabled     bool     `json:"enabled"`
+			Tables      []string `json:"tables"`
+			RowsPerCopy int      `json:"rows_per_copy"`
+			TargetRows  int      `json:"target_rows"`
+		} `json:"bulk_inserts"`
+		ConcurrentIndexes struct {
+			Enabled       bool     `json:"enabled"`
+			Tables        []string `json:"tables"`
+			EveryNSeconds int      `json:"every_n_seconds"`
+		} `json:"concurrent_indexes"`
+		SchemaChanges struct {
+			Enabled       bool `json:"enabled"`
+			AfterNSeconds int  `json:"after_n_seconds"`
+			LockTimeoutMs int  `json:"lock_timeout_ms"`
+		} `json:"schema_changes"`
+		Outbox struct {
+			Enabled         bool   `json:"enabled"`
+			Relays          int    `json:"relays"`
+			BatchSize       int    `json:"batch_size"`
+			PollIntervalMs  int    `json:"poll_interval_ms"`
+			DeleteProcessed bool   `json:"delete_processed"`
+			WebhookURL      string `json:"webhook_url"`
+		} `json:"outbox"`
+		LargePayloads struct {
+			Enabled       bool    `json:"enabled"`
+			Workers       int     `json:"workers"`
+			MinBytes      int     `json:"min_bytes"`
+			MaxBytes      int     `json:"max_bytes"`
+			Type          string  `json:"type"`
+			Compressible  bool    `json:"compressible"`
+			RatePerSecond float64 `json:"rate_per_second"`
+		} `json:"large_payloads"`
+		TTL struct {
+			Enabled            bool    `json:"enabled"`
+			Workers            int     `json:"workers"`
+			RatePerSecond      float64 `json:"rate_per_second"`
+			TTLSeconds         int     `json:"ttl_seconds"`
+			GraceSeconds       int     `json:"grace_seconds"`
+			PurgeEveryNSeconds int     `json:"purge_every_n_seconds"`
+			PurgeBatchSize     int     `json:"purge_batch_size"`
+		} `json:"ttl"`
+		ConnectionChurn struct {
+			Enabled       bool    `json:"enabled"`
+			Workers       int     `json:"workers"`
+			RatePerSecond float64 `json:"rate_per_second"`
+			Query         string  `json:"query"`
+			HoldMs        int     `json:"hold_ms"`
+		} `json:"connection_churn"`
+		IdleInTransaction struct {
+			Enabled     bool   `json:"enabled"`
+			Sessions    int    `json:"sessions"`
+			IdleSeconds int    `json:"idle_seconds"`
+			Statement   string `json:"statement"`
+			Rollback    bool   `json:"rollback"`
+		} `json:"idle_in_transaction"`
+		Deadlocks struct {
+			Enabled         bool    `json:"enabled"`
+			Pairs           int     `json:"pairs"`
+			RatePerSecond   float64 `json:"rate_per_second"`
+			LockWaitPercent int     `json:"lock_wait_percent"`
+			HoldMs          int     `json:"hold_ms"`
+			Retry           bool    `json:"retry"`
+		} `json:"deadlocks"`
+		PreparedTransactions struct {
+			Enabled         bool    `json:"enabled"`
+			Workers         int     `json:"workers"`
+			RatePerSecond   float64 `json:"rate_per_second"`
+			HoldMs          int     `json:"hold_ms"`
+			RollbackPercent int     `json:"rollback_percent"`
+			LeakPercent     int     `json:"leak_percent"`
+		} `json:"prepared_transactions"`
+		Orphans struct {
+			Enabled bool     `json:"enabled"`
+			Percent float64  `json:"percent"`
+			Tables  []string `json:"tables"`
+		} `json:"orphans"`
+		DirtyData struct {
+			Enabled bool     `json:"enabled"`
+			Percent float64  `json:"percent"`
+			Kinds   []string `json:"kinds"`
+		} `json:"dirty_data"`
+		CascadeDeletes struct {
+			Enabled              bool    `json:"enabled"`
+			Writers              int     `json:"writers"`
+			RatePerSecond        float64 `json:"rate_per_second"`
+			AlbumsPerArtist      int     `json:"albums_per_artist"`
+			TracksPerAlbum       int     `json:"tracks_per_album"`
+			ChildWorkers         int     `json:"child_workers"`
+			ChildRatePerSecond   float64 `json:"child_rate_per_second"`
+			DeleteRatePerSecond  float64 `json:"delete_rate_per_second"`
+			KeepArtists          int     `json:"keep_artists"`
+			UnindexedForeignKeys bool    `json:"unindexed_foreign_keys"`
+		} `json:"cascade_deletes"`
+		WorkMemStress struct {
+			Enabled       bool     `json:"enabled"`
+			Workers       int      `json:"workers"`
+			RatePerSecond float64  `json:"rate_per_second"`
+			Rows          int      `json:"rows"`
+			RowBytes      int      `json:"row_bytes"`
+			WorkMem       string   `json:"work_mem"`
+			Operations    []string `json:"operations"`
+		} `json:"work_mem_stress"`
+		LongQueries struct {
+			Enabled         bool `json:"enabled"`
+			Workers         int  `json:"workers"`
+			EveryNSeconds   int  `json:"every_n_seconds"`
+			DurationSeconds int  `json:"duration_seconds"`
+		} `json:"long_queries"`
+		History struct {
+			Enabled       bool    `json:"enabled"`
+			Workers       int     `json:"workers"`
+			RatePerSecond float64 `json:"rate_per_second"`
+		} `json:"history"`
+		ReadWorkload struct {
+			Enabled       bool     `json:"enabled"`
+			Workers       int      `json:"workers"`
+			Patterns      []string `json:"patterns"`
+			RangeMinutes  int      `json:"range_minutes"`
+			RatePerSecond float64  `json:"rate_per_second"`
+		} `json:"read_workload"`
+		MixedWorkload struct {
+			Enabled       bool    `json:"enabled"`
+			Workers       int     `json:"workers"`
+			ReadPercent   int     `json:"read_percent"`
+			WritePercent  int     `json:"write_percent"`
+			UpdatePercent int     `json:"update_percent"`
+			RatePerSecond float64 `json:"rate_per_second"`
+		} `json:"mixed_workload"`
+		Churn struct {
+			Enabled bool                  `json:"enabled"`
+			Tables  map[string]churnRates `json:"tables"`
+		} `json:"churn"`
+		TempTableChurn struct {
+			Enabled             bool    `json:"enabled"`
+			Sessions            int     `json:"sessions"`
+			Columns             int     `json:"columns"`
+			RatePerSecond       float64 `json:"rate_per_second"`
+			ReportEveryNSeconds int     `json:"report_every_n_seconds"`
+		} `json:"temp_table_churn"`
 		MainTablesInserts struct {
-			Mode          string `json:"mode"`
-			Enabled       bool   `json:"enabled"`
-			EveryNSeconds int    `json:"every_n_seconds"`
+			Mode          string  `json:"mode"`
+			Enabled       bool    `json:"enabled"`
+			EveryNSeconds int     `json:"every_n_seconds"`
+			BatchSize     int     `json:"batch_size"`
+			RatePerSecond float64 `json:"rate_per_second"`
 		} `json:"main_tables_inserts"`
+		StartAfter map[string]map[string]uint64 `json:"start_after"`
+		// Workers shapes the load per demo table, overriding the single
+		// goroutine inserting in a tight loop.
+		Workers map[string]tableWorkers `json:"workers"`
+		// ThinkTime pauses the workers named by the keys after each
+		// statement. The "default" entry applies to the other workers.
+		ThinkTime map[string]thinkTime `json:"think_time"`
+		// KeyDistribution shapes the foreign key references and the
+		// update targets of the workloads.
+		KeyDistribution keyDistribution `json:"key_distribution"`
+		// AcknowledgeInserts collects the ids returned by the inserts and
+		// looks them up at the end of the run.
+		AcknowledgeInserts bool `json:"acknowledge_inserts"`
+		// IsolateBatchErrors inserts a batch failing because of its data
+		// row by row, rejecting the bad rows instead of the batch.
+		IsolateBatchErrors bool `json:"isolate_batch_errors"`
+		// Cardinality sets the number of distinct values of generated
+		// columns, by table.column.
+		Cardinality map[string]columnCardinality `json:"cardinality"`
 	} `json:"inserter"`
+	MultiTenant struct {
+		Enabled      bool   `json:"enabled"`
+		Tenants      int    `json:"tenants"`
+		SchemaPrefix string `json:"schema_prefix"`
+	} `json:"multi_tenant"`
+	TenantDatabases struct {
+		Databases     int    `json:"databases"`
+		NamePrefix    string `json:"name_prefix"`
+		Template      string `json:"template"`
+		RunWorkload   bool   `json:"run_workload"`
+		EveryNSeconds int    `json:"every_n_seconds"`
+	} `json:"tenant_databases"`
+	Statistics struct {
+		SkipAnalyze   bool           `json:"skip_analyze"`
+		ColumnTargets map[string]int `json:"column_targets"`
+	} `json:"statistics"`
+	SkewDemo struct {
+		Rows             int  `json:"rows"`
+		CreateStatistics bool `json:"create_statistics"`
+	} `json:"skew_demo"`
+	Scheduler struct {
+		PersistState bool `json:"persist_state"`
+	} `json:"scheduler"`
+	Drop struct {
+		Tables                   []string `json:"tables"`
+		IncludeRegisteredObjects bool     `json:"include_registered_objects"`
+	} `json:"drop"`
+	Pool struct {
+		MaxConns                     int `json:"max_conns"`
+		MinConns                     int `json:"min_conns"`
+		HealthCheckPeriodSeconds     int `json:"health_check_period_seconds"`
+		ConnectTimeoutSeconds        int `json:"connect_timeout_seconds"`
+		MaxConnLifetimeSeconds       int `json:"max_conn_lifetime_seconds"`
+		MaxConnLifetimeJitterSeconds int `json:"max_conn_lifetime_jitter_seconds"`
+		MaxConnIdleSeconds           int `json:"max_conn_idle_seconds"`
+		RebalanceEveryNSeconds       int `json:"rebalance_every_n_seconds"`
+	} `json:"pool"`
+	// Pools gives groups of workers, see workloadPoolNames, a pool of their
+	// own, so they cannot take all connections of the others.
+	Pools   map[string]workloadPool `json:"pools"`
+	Metrics struct {
+		ListenAddress string `json:"listen_address"`
+	} `json:"metrics"`
+	// Control serves the API pausing workers and changing their rates
+	// while insert runs.
+	Control struct {
+		ListenAddress string `json:"listen_address"`
+	} `json:"control"`
+	Safety struct {
+		AllowDestructive    bool   `json:"allow_destructive"`
+		DatabaseNamePattern string `json:"database_name_pattern"`
+	} `json:"safety"`
+	// SkipForeignKeys drops the foreign keys of the demo tables after
+	// create-tables and recreate created them.
+	SkipForeignKeys bool `json:"skip_foreign_keys"`
+	// ReadOnly refuses every command and workload writing to the database,
+	// for load against replicas or production-adjacent systems.
+	ReadOnly bool `json:"read_only"`
+	LockDemo struct {
+		HoldSeconds   int `json:"hold_seconds"`
+		LockTimeoutMs int `json:"lock_timeout_ms"`
+		Attempts      int `json:"attempts"`
+	} `json:"lock_demo"`
+	// Seed is nil when unset, so that 0 can be a seed too.
+	Seed            *uint64 `json:"seed"`
+	ActivitySampler struct {
+		Enabled    bool `json:"enabled"`
+		IntervalMs int  `json:"interval_ms"`
+	} `json:"activity_sampler"`
+	ServerLog struct {
+		Enabled bool   `json:"enabled"`
+		File    string `json:"file"`
+	} `json:"server_log"`
+	Stop struct {
+		DurationSeconds int               `json:"duration_seconds"`
+		TargetRows      map[string]uint64 `json:"target_rows"`
+	} `json:"stop"`
+	Autotune struct {
+		Workers            int     `json:"workers"`
+		StartRowsPerSecond float64 `json:"start_rows_per_second"`
+		GrowthFactor       float64 `json:"growth_factor"`
+		StepSeconds        int     `json:"step_seconds"`
+		MaxP95LatencyMs    int     `json:"max_p95_latency_ms"`
+		MaxErrorPercent    float64 `json:"max_error_percent"`
+	} `json:"autotune"`
+	Retry struct {
+		InitialBackoffMs int `json:"initial_backoff_ms"`
+		MaxBackoffMs     int `json:"max_backoff_ms"`
+		MaxAttempts      int `json:"max_attempts"`
+	} `json:"retry"`
+	Progress struct {
+		// EveryNSeconds is the interval of the progress reports, 0 for none.
+		EveryNSeconds int `json:"every_n_seconds"`
+	} `json:"progress"`
+	Soak struct {
+		Enabled             bool    `json:"enabled"`
+		SampleEveryNSeconds int     `json:"sample_every_n_seconds"`
+		WarmupSeconds       int     `json:"warmup_seconds"`
+		DriftPercent        float64 `json:"drift_percent"`
+	} `json:"soak"`
+	Clone struct {
+		SourceURL       string  `json:"source_url"`
+		Schema          string  `json:"schema"`
+		TargetSchema    string  `json:"target_schema"`
+		ScalePercent    float64 `json:"scale_percent"`
+		MaxRowsPerTable int64   `json:"max_rows_per_table"`
+	} `json:"clone"`
+	AnySchema struct {
+		Schema        string   `json:"schema"`
+		Tables        []string `json:"tables"`
+		BatchSize     int      `json:"batch_size"`
+		RatePerSecond float64  `json:"rate_per_second"`
+	} `json:"any_schema"`
+	FDW struct {
+		RemoteURL       string  `json:"remote_url"`
+		RemoteSchema    string  `json:"remote_schema"`
+		ServerName      string  `json:"server_name"`
+		LocalSchema     string  `json:"local_schema"`
+		Workers         int     `json:"workers"`
+		RatePerSecond   float64 `json:"rate_per_second"`
+		DurationSeconds int     `json:"duration_seconds"`
+	} `json:"fdw"`
+	Replication struct {
+		SubscriberURL        string  `json:"subscriber_url"`
+		PublisherConninfo    string  `json:"publisher_conninfo"`
+		Publication          string  `json:"publication"`
+		Subscription         string  `json:"subscription"`
+		RatePerSecond        float64 `json:"rate_per_second"`
+		DurationSeconds      int     `json:"duration_seconds"`
+		VerifyTimeoutSeconds int     `json:"verify_timeout_seconds"`
+	} `json:"replication"`
+	PgCron struct {
+		Enabled bool      `json:"enabled"`
+		Jobs    []cronJob `json:"jobs"`
+	} `json:"pg_cron"`
+	SchemaDir        string `json:"schema_dir"`
+	DeleteExperiment struct {
+		Percent    int      `json:"percent"`
+		BatchSize  int      `json:"batch_size"`
+		Strategies []string `json:"strategies"`
+	} `json:"delete_experiment"`
+	CompressionExperiment struct {
+		Rows       int      `json:"rows"`
+		ValueBytes int      `json:"value_bytes"`
+		Entropy    string   `json:"entropy"`
+		Variants   []string `json:"variants"`
+	} `json:"compression_experiment"`
+	HugeTransaction struct {
+		Rows                  int    `json:"rows"`
+		RowBytes              int    `json:"row_bytes"`
+		BatchSize             int    `json:"batch_size"`
+		Operation             string `json:"operation"`
+		HoldSeconds           int    `json:"hold_seconds"`
+		SkipCheckpoint        bool   `json:"skip_checkpoint"`
+		CatchUpTimeoutSeconds int    `json:"catch_up_timeout_seconds"`
+	} `json:"huge_transaction"`
+	Dump struct {
+		Tables    []string `json:"tables"`
+		Format    string   `json:"format"`
+		Directory string   `json:"directory"`
+	} `json:"dump"`
+	CrashRecovery struct {
+		Tables          []string `json:"tables"`
+		RestartCommand  string   `json:"restart_command"`
+		ProbeIntervalMs int      `json:"probe_interval_ms"`
+		TimeoutSeconds  int      `json:"timeout_seconds"`
+	} `json:"crash_recovery"`
+	IndexOnlyDemo struct {
+		Rows                int     `json:"rows"`
+		DurationSeconds     int     `json:"duration_seconds"`
+		ReportEveryNSeconds int     `json:"report_every_n_seconds"`
+		Readers             int     `json:"readers"`
+		UpdatesPerSecond    float64 `json:"updates_per_second"`
+		VacuumBehind        bool    `json:"vacuum_behind"`
+	} `json:"index_only_demo"`
+	IsolationDemo struct {
+		Rounds    int      `json:"rounds"`
+		Anomalies []string `json:"anomalies"`
+	} `json:"isolation_demo"`
+	Anomalies   []anomalySpec `json:"anomalies"`
+	TimescaleDB struct {
+		Enabled       bool     `json:"enabled"`
+		Tables        []string `json:"tables"`
+		ChunkInterval string   `json:"chunk_interval"`
+		Devices       int      `json:"devices"`
+	} `json:"timescaledb"`
+	Partitioning struct {
+		Enabled       bool `json:"enabled"`
+		PremakeDays   int  `json:"premake_days"`
+		RetentionDays int  `json:"retention_days"`
+		EveryNSeconds int  `json:"every_n_seconds"`
+	} `json:"partitioning"`
+	DrainTimeoutSeconds int                 `json:"drain_timeout_seconds"`
+	StatementLabels     bool                `json:"statement_labels"`
+	Hooks               map[string][]string `json:"hooks"`
+	Notifications       struct {
+		WebhookURL  string `json:"webhook_url"`
+		Format      string `json:"format"`
+		ErrorBudget uint64 `json:"error_budget"`
+		// ReadErrorBudget is the budget of the read errors, which do not
+		// count against ErrorBudget.
+		ReadErrorBudget uint64 `json:"read_error_budget"`
+	} `json:"notifications"`
 }
 
-func parseAndValidateFlags() (*CommandFlags, error) {
-	configPath := flag.String("config", "", "Path to config file")
-	insert := flag.Bool("insert", false, "Insert data")
-	dropTables := flag.Bool("drop-tables", false, "Drop all tables")
-	recreate := flag.Bool("recreate", false, "Drop and recreate all tables and insert data")
-	validate := flag.Bool("validate", false, "Validate database connection and config")
-	createTables := flag.Bool("create-tables", false, "Create tables without inserting data")
+// command is a subcommand of demo-db. Besides the common flags, like
+// -config, it accepts the flags added by its flags function.
+type command struct {
+	name    string
+	summary string
+	flags   func(fs *flag.FlagSet, f *CommandFlags)
+}
+
+func tablesFlag(fs *flag.FlagSet, f *CommandFlags, usage string) {
+	fs.Func("tables", usage, func(value string) error {
+		f.Tables = splitList(value)
+		return nil
+	})
+}
+
+func schemaDirFlag(fs *flag.FlagSet, f *CommandFlags) {
+	fs.StringVar(&f.SchemaDir, "schema-dir", "", "Directory whose *.sql files create the schema instead of the embedded one, run in lexical order, overrides schema_dir")
+}
+
+func recordFileFlag(fs *flag.FlagSet, f *CommandFlags, usage string) {
+	fs.StringVar(&f.RecordFile, "record-file", "", usage)
+}
+
+var commands = []command{
+	{name: "insert", summary: "Insert data", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		fs.DurationVar(&f.Duration, "duration", 0, "Drain and stop after this long, e.g. 10m, overrides stop.duration_seconds")
+		recordFileFlag(fs, f, "File the statements are recorded to, for the replay command")
+		tablesFlag(fs, f, "Comma separated list of tables to insert into, e.g. bigtable, overrides inserter.tables")
+		fs.Func("inject", "Inject an anomaly, e.g. anomaly=lock_storm,after=2m,duration=30s,intensity=20, can be repeated, adds to anomalies", func(value string) error {
+			spec, err := parseAnomalySpec(value)
+			f.Inject = append(f.Inject, spec)
+			return err
+		})
+	}},
+	{name: "drop", summary: "Drop all tables", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		tablesFlag(fs, f, "Comma separated list of tables to drop, e.g. artist,album, overrides drop.tables")
+		fs.BoolVar(&f.Yes, "yes", false, "Drop without asking for confirmation")
+		fs.BoolVar(&f.Yes, "force", false, "Same as -yes")
+	}},
+	{name: "truncate", summary: "Delete all rows of the tables and reset their identity columns", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		tablesFlag(fs, f, "Comma separated list of tables to truncate, e.g. bigtable")
+		fs.BoolVar(&f.Yes, "yes", false, "Truncate without asking for confirmation")
+		fs.BoolVar(&f.Yes, "force", false, "Same as -yes")
+	}},
+	{name: "recreate", summary: "Drop and recreate all tables and insert data", flags: schemaDirFlag},
+	{name: "validate", summary: "Validate database connection and config"},
+	{name: "create-tables", summary: "Create tables without inserting data", flags: schemaDirFlag},
+	{name: "provision-tenant-dbs", summary: "Create one database per tenant and apply the schema to each", flags: schemaDirFlag},
+	{name: "skew-demo", summary: "Run the planner statistics skew demo"},
+	{name: "list-objects", summary: "List database objects created by this tool"},
+	{name: "lock-demo", summary: "Run the lock_timeout and DDL contention demo"},
+	{name: "cleanup", summary: "Roll back prepared transactions and list, or with -all terminate, the sessions of other runs", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		fs.BoolVar(&f.All, "all", false, "Terminate all demo-db sessions of the database, including those of running instances")
+		fs.BoolVar(&f.Yes, "yes", false, "Terminate without asking for confirmation")
+		fs.BoolVar(&f.Yes, "force", false, "Same as -yes")
+	}},
+	{name: "replay", summary: "Replay the statements recorded by insert -record-file against the configured database", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		recordFileFlag(fs, f, "File the statements are read from")
+		fs.Float64Var(&f.ReplaySpeed, "replay-speed", 1, "Speed factor, 0 replays as fast as possible")
+	}},
+	{name: "autotune", summary: "Increase the insert rate step-wise to find the maximum sustainable rows/sec"},
+	{name: "clone", summary: "Generate a synthetic copy of the schema and row counts of clone.source_url"},
+	{name: "any-schema", summary: "Insert generated rows into the user tables of any_schema.schema, read from the catalog"},
+	{name: "fdw-demo", summary: "Set up postgres_fdw to fdw.remote_url and run the read workload across it"},
+	{name: "replication-demo", summary: "Publish the demo tables, subscribe replication.subscriber_url to them and verify inserted rows arrive"},
+	{name: "status", summary: "Print the estimated rows, table and index size and last autovacuum of the demo tables", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		fs.BoolVar(&f.JSON, "json", false, "Print the report as JSON")
+	}},
+	{name: "dump", summary: "Export the rows of the tables to CSV or NDJSON files", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		tablesFlag(fs, f, "Comma separated list of tables to dump, e.g. artist,album, overrides dump.tables")
+		fs.StringVar(&f.DumpFormat, "format", "", "Format of the files, one of csv or ndjson, overrides dump.format")
+		fs.StringVar(&f.DumpDir, "dir", "", "Directory the files are written to, overrides dump.directory")
+	}},
+	{name: "delete-experiment", summary: "Compare strategies for deleting a large part of bigtable by duration, WAL volume and replication lag"},
+	{name: "compression-experiment", summary: "Compare the size and load time of the same data stored with pglz, lz4 and different TOAST settings"},
+	{name: "huge-transaction", summary: "Insert or update millions of rows in one transaction and report its WAL, replication lag and recovery cost"},
+	{name: "crash-recovery", summary: "Count the committed rows, wait for the server to crash and restart and verify that every row survived"},
+	{name: "index-only-demo", summary: "Run the index-only scan and visibility map demo"},
+	{name: "isolation-demo", summary: "Reproduce the lost update and non-repeatable read anomalies of read committed"},
+	{name: "scenario", summary: "Run the phases of a scenario file", flags: func(fs *flag.FlagSet, f *CommandFlags) {
+		fs.StringVar(&f.ScenarioFile, "file", "", "Scenario file (JSON, YAML or TOML) with the phases to run")
+		fs.StringVar(&f.ScenarioName, "name", "", "Name of a scenario of the built-in library, e.g. vacuum-pressure")
+		fs.BoolVar(&f.ListScenarios, "list", false, "List the scenarios of the built-in library and exit")
+		fs.BoolVar(&f.NoBreakpoints, "no-breakpoints", false, "Run through the breakpoints of the scenario without pausing")
+		fs.StringVar(&f.ResumeAddress, "resume-address", "", "Address serving POST /resume to continue after a breakpoint, e.g. localhost:8091")
+	}},
+}
+
+// legacyCommands maps the action flags used before subcommands existed to
+// their command, for the flags named differently.
+var legacyCommands = map[string]string{"drop-tables": "drop"}
 
-	flag.Parse()
+func findCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		return command{}, false
+	}
+	return commands[i], true
+}
 
-	if *configPath == "" {
-		return nil, fmt.Errorf("--config is required")
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: demo-db <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-22s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintf(w, "\nRun 'demo-db <command> -h' to list the flags of a command.\n")
+}
 
-	actionCount := 0
-	if *insert {
-		actionCount++
+// legacyCommand returns the command selected by an action flag of the old
+// command line, e.g. --config config.json --insert, and the arguments
+// without it, so existing service definitions keep working.
+func legacyCommand(args []string) (string, []string, error) {
+	name, rest := "", make([]string, 0, len(args))
+	for _, arg := range args {
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if legacy, ok := legacyCommands[flagName]; ok {
+			flagName = legacy
+		}
+		if _, ok := findCommand(flagName); !ok || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		if hasValue && value != "true" {
+			continue
+		}
+		if name != "" {
+			return "", nil, fmt.Errorf("only one command can be given")
+		}
+		name = flagName
 	}
-	if *dropTables {
-		actionCount++
+	if name == "" {
+		return "", nil, fmt.Errorf("a command is required, run with -h to list the available commands")
 	}
-	if *recreate {
-		actionCount++
+	return name, rest, nil
+}
+
+func parseAndValidateFlags() (*CommandFlags, error) {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		return nil, fmt.Errorf("a command is required")
 	}
-	if *validate {
-		actionCount++
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		usage()
+		os.Exit(0)
 	}
 
-	if *createTables {
-		actionCount++
+	name, args := args[0], args[1:]
+	if strings.HasPrefix(name, "-") {
+		var err error
+		if name, args, err = legacyCommand(os.Args[1:]); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Warning: action flags are deprecated, run 'demo-db %s' instead\n", name)
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		usage()
+		return nil, fmt.Errorf("unknown command '%s'", name)
 	}
 
-	if actionCount == 0 {
-		return nil, fmt.Errorf("one action is required: --insert, --create-tables, --drop-tables, --validate or --recreate")
+	flags := &CommandFlags{Command: cmd.name}
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: demo-db %s [flags]\n\n%s.\n\nFlags:\n", cmd.name, cmd.summary)
+		fs.PrintDefaults()
 	}
-	if actionCount > 1 {
-		return nil, fmt.Errorf("only one action can be specified at a time")
+	fs.StringVar(&flags.ConfigPath, "config", "", "Path to config file, fields can be overridden with DEMODB_* environment variables")
+	fs.StringVar(&flags.ConfigFormat, "config-format", "", "Format of the config file, one of json, yaml or toml, defaults to its extension")
+	fs.StringVar(&flags.PidFile, "pidfile", "", "Path to a pidfile used to refuse starting a second instance")
+	fs.Func("seed", "Seed for generated data, overrides the seed config field", func(value string) error {
+		seed, err := strconv.ParseUint(value, 10, 64)
+		flags.Seed = &seed
+		return err
+	})
+	fs.BoolVar(&flags.ShowEffectiveConfig, "show-effective-config", false, "Print the configuration after applying the environment, the flags and the defaults, with secrets redacted, and exit")
+	if cmd.flags != nil {
+		cmd.flags(fs, flags)
 	}
+	fs.Parse(args)
 
-	return &CommandFlags{
-		ConfigPath:   *configPath,
-		Insert:       *insert,
-		DropTables:   *dropTables,
-		Recreate:     *recreate,
-		Validate:     *validate,
-		CreateTables: *createTables,
-	}, nil
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument '%s', run 'demo-db %s -h' to list its flags", fs.Arg(0), cmd.name)
+	}
+	if flags.ConfigPath == "" && os.Getenv("DATABASE_URL") == "" && os.Getenv(envPrefix+"_HOST") == "" && !flags.ListScenarios {
+		return nil, fmt.Errorf("-config is required unless the connection is set with DATABASE_URL or DEMODB_* variables")
+	}
+	if cmd.name == "replay" && flags.RecordFile == "" {
+		return nil, fmt.Errorf("replay needs -record-file")
+	}
+	if flags.Duration < 0 {
+		return nil, fmt.Errorf("-duration cannot be negative")
+	}
+	if flags.Duration > 0 && flags.Duration < time.Second {
+		// stop.duration_seconds has whole seconds, so less would not stop.
+		return nil, fmt.Errorf("-duration must be at least 1s")
+	}
+	if flags.DumpFormat != "" && !slices.Contains(dumpFormats, flags.DumpFormat) {
+		return nil, fmt.Errorf("invalid -format '%s', must be one of %v", flags.DumpFormat, dumpFormats)
+	}
+	if flags.ReplaySpeed < 0 {
+		return nil, fmt.Errorf("-replay-speed cannot be negative")
+	}
+	return flags, nil
 }
 
-func loadConfig(path string) (*InserterConfig, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("cannot open config file: %w", err)
+// maxBatchSize keeps multi-row inserts below the 65535 bind parameter limit
+// of the protocol for the widest generated table.
+const maxBatchSize = 5000
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	defer file.Close()
+	return items
+}
 
+// loadConfig reads the config file at path, if any, and applies the
+// environment variable overrides on top of it. The file is decoded as
+// format, or according to its extension when format is empty.
+func loadConfig(path, format string) (*InserterConfig, error) {
 	var cfg InserterConfig
-	if err := json.NewDecoder(file).Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("cannot parse config file: %w", err)
+	if path != "" {
+		format, err := configFormat(path, format)
+		if err != nil {
+			return nil, err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open config file: %w", err)
+		}
+		defer file.Close()
+
+		if err := decodeConfig(file, format, &cfg); err != nil {
+			return nil, fmt.Errorf("cannot parse %s config file: %w", format, err)
+		}
 	}
 
-	// validModes := []string{"timestamp-only", "realistic-data", "gibberish-data"}
-	// modeValid := false
-	// for _, m := range validModes {
-	// 	if strings.ToLower(cfg.Inserter.Mode) == m {
-	// 		modeValid = true
-	// 		break
-	// 	}
-	// }
+	if err := applyEnvOverrides(&cfg); err != nil {
+		return nil, err
+	}
 
-	// if !modeValid {
-	// 	return nil, fmt.Errorf("invalid inserter.mode '%s', must be one of %v", cfg.Inserter.Mode, validModes)
-	// }
+	if err := resolvePassword(&cfg); err != nil {
+		return nil, err
+	}
 
+	if err := validateConfig(&cfg); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// validateConfig checks cfg and fills in the defaults that depend on other
+// settings.
+func validateConfig(cfg *InserterConfig) error {
+	if err := validateTLS(cfg); err != nil {
+		return err
+	}
+
+	if err := validateHooks(cfg.Hooks); err != nil {
+		return err
+	}
+
+	if cfg.MultiTenant.Enabled && cfg.MultiTenant.Tenants < 1 {
+		return fmt.Errorf("multi_tenant.tenants must be at least 1 when multi_tenant is enabled")
+	}
+
+	if cfg.TenantDatabases.Databases < 0 {
+		return fmt.Errorf("tenant_databases.databases cannot be negative")
+	}
+
+	for name, size := range map[string]int{
+		"timestamp_inserts":   cfg.Inserter.TimestampInserts.BatchSize,
+		"bigtable_inserts":    cfg.Inserter.BigTableInserts.BatchSize,
+		"main_tables_inserts": cfg.Inserter.MainTablesInserts.BatchSize,
+	} {
+		if size < 0 || size > maxBatchSize {
+			return fmt.Errorf("inserter.%s.batch_size must be between 0 and %d, 0 meaning 1", name, maxBatchSize)
+		}
+	}
+
+	if cfg.AnySchema.BatchSize < 0 {
+		return fmt.Errorf("any_schema.batch_size cannot be negative")
+	}
+
+	if len(cfg.Inserter.BulkInserts.Tables) == 0 {
+		cfg.Inserter.BulkInserts.Tables = []string{"bigtable"}
+	}
+	if err := validateBulkTables(cfg.Inserter.BulkInserts.Tables); err != nil {
+		return err
+	}
+
+	if len(cfg.Inserter.ConcurrentIndexes.Tables) == 0 {
+		cfg.Inserter.ConcurrentIndexes.Tables = []string{"bigtable"}
+	}
+	if err := validateIndexTables(cfg.Inserter.ConcurrentIndexes.Tables); err != nil {
+		return err
+	}
+
+	if len(cfg.Inserter.ReadWorkload.Patterns) == 0 {
+		cfg.Inserter.ReadWorkload.Patterns = defaultReadPatterns(cfg.Inserter.History.Enabled)
+	}
+	if err := validateReadPatterns(cfg.Inserter.ReadWorkload.Patterns); err != nil {
+		return err
+	}
+	for _, pattern := range cfg.Inserter.ReadWorkload.Patterns {
+		if slices.Contains(historyReadPatterns, pattern) && !cfg.Inserter.History.Enabled {
+			return fmt.Errorf("read pattern %s needs inserter.history.enabled", pattern)
+		}
+	}
+
+	payloads := &cfg.Inserter.LargePayloads
+	if payloads.MinBytes == 0 {
+		payloads.MinBytes = 100 << 10
+	}
+	if payloads.MaxBytes == 0 {
+		payloads.MaxBytes = max(payloads.MinBytes, 1<<20)
+	}
+	if payloads.MinBytes < 0 || payloads.MinBytes > payloads.MaxBytes || payloads.MaxBytes > maxPayloadBytes {
+		return fmt.Errorf("inserter.large_payloads needs 0 < min_bytes <= max_bytes <= %d", maxPayloadBytes)
+	}
+	switch payloads.Type {
+	case "":
+		payloads.Type = "text"
+	case "text", "bytea":
+	default:
+		return fmt.Errorf("invalid inserter.large_payloads.type '%s', must be one of [text bytea]", payloads.Type)
+	}
+
+	if cfg.Inserter.Outbox.Enabled && !cfg.Inserter.MixedWorkload.Enabled {
+		return fmt.Errorf("inserter.outbox needs inserter.mixed_workload, whose invoices write the outbox events")
+	}
+
+	if cfg.Inserter.Churn.Enabled && len(cfg.Inserter.Churn.Tables) == 0 {
+		return fmt.Errorf("inserter.churn.tables must list at least one table when churn is enabled")
+	}
+	if err := validateChurnTables(cfg.Inserter.Churn.Tables); err != nil {
+		return err
+	}
+
+	mixed := &cfg.Inserter.MixedWorkload
+	if mixed.ReadPercent == 0 && mixed.WritePercent == 0 && mixed.UpdatePercent == 0 {
+		mixed.ReadPercent, mixed.WritePercent, mixed.UpdatePercent = 70, 20, 10
+	}
+	if mixed.ReadPercent < 0 || mixed.WritePercent < 0 || mixed.UpdatePercent < 0 ||
+		mixed.ReadPercent+mixed.WritePercent+mixed.UpdatePercent != 100 {
+		return fmt.Errorf("inserter.mixed_workload read_percent, write_percent and update_percent must add up to 100")
+	}
+
+	for table, rows := range cfg.Stop.TargetRows {
+		if !slices.Contains(demoTables, table) {
+			return fmt.Errorf("stop.target_rows: unknown table '%s'", table)
+		}
+		if rows == 0 {
+			delete(cfg.Stop.TargetRows, table)
+		}
+	}
+
+	for i, job := range cfg.PgCron.Jobs {
+		if job.Name == "" || job.Schedule == "" || job.Command == "" {
+			return fmt.Errorf("pg_cron.jobs[%d] needs a name, schedule and command", i)
+		}
+	}
+	for _, strategy := range cfg.DeleteExperiment.Strategies {
+		if _, ok := deleteStrategies[strategy]; !ok {
+			return fmt.Errorf("delete_experiment strategy %s is not supported, must be one of %v", strategy, deleteStrategyNames())
+		}
+	}
+	if p := cfg.DeleteExperiment.Percent; p < 0 || p > 100 {
+		return fmt.Errorf("delete_experiment.percent must be between 0 and 100")
+	}
+	for _, variant := range cfg.CompressionExperiment.Variants {
+		if !slices.Contains(compressionVariantNames(), variant) {
+			return fmt.Errorf("compression_experiment variant %s is not supported, must be one of %v", variant, compressionVariantNames())
+		}
+	}
+	if op := cfg.HugeTransaction.Operation; op != "" && !slices.Contains(hugeTxOperations, op) {
+		return fmt.Errorf("invalid huge_transaction.operation '%s', must be one of %v", op, hugeTxOperations)
+	}
+	if err := checkTableNames(cfg.Dump.Tables); err != nil {
+		return fmt.Errorf("invalid dump.tables: %w", err)
+	}
+	if format := cfg.Dump.Format; format != "" && !slices.Contains(dumpFormats, format) {
+		return fmt.Errorf("invalid dump.format '%s', must be one of %v", format, dumpFormats)
+	}
+	if err := checkTableNames(cfg.CrashRecovery.Tables); err != nil {
+		return fmt.Errorf("invalid crash_recovery.tables: %w", err)
+	}
+	switch cfg.CompressionExperiment.Entropy {
+	case "", "high", "low":
+	default:
+		return fmt.Errorf("invalid compression_experiment.entropy '%s', must be one of [high low]", cfg.CompressionExperiment.Entropy)
+	}
+	if len(cfg.TimescaleDB.Tables) == 0 {
+		cfg.TimescaleDB.Tables = hypertableNames()
+	}
+	if err := validateHypertables(cfg.TimescaleDB.Tables); err != nil {
+		return err
+	}
+	if cfg.Partitioning.Enabled && cfg.TimescaleDB.Enabled && slices.Contains(cfg.TimescaleDB.Tables, "timestamp") {
+		return fmt.Errorf("partitioning and timescaledb cannot both manage the timestamp table")
+	}
+	if cfg.Partitioning.PremakeDays < 0 || cfg.Partitioning.RetentionDays < 0 {
+		return fmt.Errorf("partitioning.premake_days and retention_days cannot be negative")
+	}
+	for name, t := range cfg.Inserter.ThinkTime {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("inserter.think_time.%s: %w", name, err)
+		}
+	}
+	pool := cfg.Pool
+	for _, value := range []int{pool.MaxConns, pool.MinConns, pool.HealthCheckPeriodSeconds, pool.ConnectTimeoutSeconds,
+		pool.MaxConnLifetimeSeconds, pool.MaxConnLifetimeJitterSeconds, pool.MaxConnIdleSeconds, pool.RebalanceEveryNSeconds} {
+		if value < 0 {
+			return fmt.Errorf("pool settings must not be negative")
+		}
+	}
+	if pool.MaxConns > math.MaxInt32 {
+		return fmt.Errorf("pool.max_conns must not exceed %d", math.MaxInt32)
+	}
+	if maxConns := cmp.Or(pool.MaxConns, 5); pool.MinConns > maxConns {
+		return fmt.Errorf("pool.min_conns (%d) must not exceed pool.max_conns (%d)", pool.MinConns, maxConns)
+	}
+	switch cfg.Inserter.BigTableInserts.Entropy {
+	case "", "high", "low":
+	default:
+		return fmt.Errorf("invalid inserter.bigtable_inserts.entropy '%s', must be one of [high low]", cfg.Inserter.BigTableInserts.Entropy)
+	}
+	switch cfg.Inserter.IdleInTransaction.Statement {
+	case "", "select", "insert":
+	default:
+		return fmt.Errorf("invalid inserter.idle_in_transaction.statement '%s', must be one of [select insert]", cfg.Inserter.IdleInTransaction.Statement)
+	}
+	if p := cfg.Inserter.Deadlocks.LockWaitPercent; p < 0 || p > 100 {
+		return fmt.Errorf("inserter.deadlocks.lock_wait_percent must be between 0 and 100")
+	}
+	for _, p := range []int{cfg.Inserter.PreparedTransactions.RollbackPercent, cfg.Inserter.PreparedTransactions.LeakPercent} {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("inserter.prepared_transactions.rollback_percent and leak_percent must be between 0 and 100")
+		}
+	}
+	if p := cfg.Inserter.Orphans.Percent; p < 0 || p > 100 {
+		return fmt.Errorf("inserter.orphans.percent must be between 0 and 100")
+	}
+	for _, table := range cfg.Inserter.Orphans.Tables {
+		if _, ok := orphanReferences[table]; !ok {
+			return fmt.Errorf("invalid inserter.orphans.tables entry '%s', must be one of [album customer playlist_track track]", table)
+		}
+	}
+	if p := cfg.Inserter.DirtyData.Percent; p < 0 || p > 100 {
+		return fmt.Errorf("inserter.dirty_data.percent must be between 0 and 100")
+	}
+	for _, kind := range cfg.Inserter.DirtyData.Kinds {
+		if !slices.Contains(dirtKinds, kind) {
+			return fmt.Errorf("invalid inserter.dirty_data.kinds entry '%s', must be one of %v", kind, dirtKinds)
+		}
+	}
+	for _, operation := range cfg.Inserter.WorkMemStress.Operations {
+		if !slices.Contains(workMemOperations, operation) {
+			return fmt.Errorf("invalid inserter.work_mem_stress.operations entry '%s', must be one of %v", operation, workMemOperations)
+		}
+	}
+	for name, p := range cfg.Pools {
+		if !slices.Contains(workloadPoolNames, name) {
+			return fmt.Errorf("invalid pools entry '%s', must be one of %v", name, workloadPoolNames)
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("pools.%s: %w", name, err)
+		}
+	}
+	for column, c := range cfg.Inserter.Cardinality {
+		if err := c.validate(column); err != nil {
+			return fmt.Errorf("inserter.cardinality.%s: %w", column, err)
+		}
+	}
+	if err := cfg.Inserter.KeyDistribution.validate(); err != nil {
+		return fmt.Errorf("inserter.key_distribution: %w", err)
+	}
+	for _, anomaly := range cfg.IsolationDemo.Anomalies {
+		if !slices.Contains(isolationAnomalies, anomaly) {
+			return fmt.Errorf("invalid isolation_demo.anomalies entry '%s', must be one of %v", anomaly, isolationAnomalies)
+		}
+	}
+	for i, spec := range cfg.Anomalies {
+		if err := spec.validate(); err != nil {
+			return fmt.Errorf("anomalies[%d]: %w", i, err)
+		}
+	}
+	if err := validateStartAfter(cfg.Inserter.StartAfter); err != nil {
+		return err
+	}
+	for table, w := range cfg.Inserter.Workers {
+		if !slices.Contains(demoTables, table) {
+			return fmt.Errorf("inserter.workers: unknown table '%s'", table)
+		}
+		if w.Workers < 0 || w.IntervalMs < 0 {
+			return fmt.Errorf("inserter.workers.%s: workers and interval_ms must not be negative", table)
+		}
+	}
+
+	if err := validateColumnTargets(cfg.Statistics.ColumnTargets); err != nil {
+		return err
+	}
+
+	if _, err := regexp.Compile(cfg.Safety.DatabaseNamePattern); err != nil {
+		return fmt.Errorf("invalid safety.database_name_pattern: %w", err)
+	}
+
+	switch cfg.Notifications.Format {
+	case "", "json", "slack":
+	default:
+		return fmt.Errorf("invalid notifications.format '%s', must be one of [json slack]", cfg.Notifications.Format)
+	}
+
+	validModes := []string{"gibberish-data", "realistic-data"}
+	mode := strings.ToLower(cfg.Inserter.MainTablesInserts.Mode)
+	if mode == "" {
+		mode = "gibberish-data"
+	}
+	if !slices.Contains(validModes, mode) {
+		return fmt.Errorf("invalid inserter.main_tables_inserts.mode '%s', must be one of %v", cfg.Inserter.MainTablesInserts.Mode, validModes)
+	}
+	cfg.Inserter.MainTablesInserts.Mode = mode
+	if mode == "realistic-data" {
+		for _, table := range []string{"album", "track", "customer"} {
+			if cfg.Inserter.Workers[table].Workers > 1 {
+				return fmt.Errorf("inserter.workers.%s: realistic-data mode inserts the next id after MAX(id) and supports a single worker", table)
+			}
+		}
+	}
+
+	return nil
+}
+
+// tableWorkers sets the number of goroutines inserting into a demo table and
+// the pause of each goroutine between two inserts. Zero keeps the default of
+// one goroutine without pause.
+type tableWorkers struct {
+	Workers    int `json:"workers"`
+	IntervalMs int `json:"interval_ms"`
+}
+
+// validateStartAfter checks that worker dependencies name known tables and
+// contain no cycle, which would make the workers wait for each other.
+func validateStartAfter(startAfter map[string]map[string]uint64) error {
+	for table, deps := range startAfter {
+		for _, name := range append([]string{table}, slices.Collect(maps.Keys(deps))...) {
+			if !slices.Contains(demoTables, name) {
+				return fmt.Errorf("inserter.start_after: unknown table '%s'", name)
+			}
+		}
+	}
+
+	visiting := map[string]bool{}
+	done := map[string]bool{}
+	var visit func(table string) error
+	visit = func(table string) error {
+		if done[table] {
+			return nil
+		}
+		if visiting[table] {
+			return fmt.Errorf("inserter.start_after: dependency cycle through table '%s'", table)
+		}
+		visiting[table] = true
+		for dep := range startAfter[table] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		done[table] = true
+		return nil
+	}
+	for table := range startAfter {
+		if err := visit(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestValidateConfigMixedWorkloadDefaults(t *testing.T) {
+	cfg := &InserterConfig{}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	mixed := cfg.Inserter.MixedWorkload
+	if mixed.ReadPercent != 70 || mixed.WritePercent != 20 || mixed.UpdatePercent != 10 {
+		t.Errorf("mixed workload split = %d/%d/%d, want 70/20/10", mixed.ReadPercent, mixed.WritePercent, mixed.UpdatePercent)
+	}
+}
+
+func TestValidateConfigMixedWorkloadKeepsSplit(t *testing.T) {
+	cfg := &InserterConfig{}
+	cfg.Inserter.MixedWorkload.ReadPercent = 50
+	cfg.Inserter.MixedWorkload.WritePercent = 50
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	if got := cfg.Inserter.MixedWorkload.UpdatePercent; got != 0 {
+		t.Errorf("update_percent = %d, want 0", got)
+	}
+}
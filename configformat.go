@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var configFormats = []string{"json", "yaml", "toml"}
+
+// configFormat returns the format of the config file at path, taken from
+// format when set and from the file extension otherwise. Files with other
+// extensions are read as JSON, as they always were.
+func configFormat(path, format string) (string, error) {
+	explicit := format != ""
+	if !explicit {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	switch format {
+	case "json":
+		return "json", nil
+	case "yaml", "yml":
+		return "yaml", nil
+	case "toml":
+		return "toml", nil
+	}
+	if explicit {
+		return "", fmt.Errorf("unsupported config format '%s', must be one of %v", format, configFormats)
+	}
+	return "json", nil
+}
+
+// decodeConfig decodes a config or scenario file into v. YAML and TOML
+// documents are converted to JSON first, so all formats share the json
+// field names, with unquoted ports turned into the strings they are in
+// JSON.
+func decodeConfig(r io.Reader, format string, v any) error {
+	if format == "json" {
+		return json.NewDecoder(r).Decode(v)
+	}
+
+	var doc map[string]any
+	switch format {
+	case "yaml":
+		if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+			return err
+		}
+	case "toml":
+		if _, err := toml.NewDecoder(r).Decode(&doc); err != nil {
+			return err
+		}
+	}
+	quotePorts(doc)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// quotePorts replaces the numbers under port keys of a decoded YAML or TOML
+// document with strings, since port: 5432 is a number in both formats.
+func quotePorts(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if key == "port" {
+				switch port := item.(type) {
+				case int:
+					v[key] = strconv.Itoa(port)
+				case int64:
+					v[key] = strconv.FormatInt(port, 10)
+				}
+				continue
+			}
+			quotePorts(item)
+		}
+	case []any:
+		for _, item := range v {
+			quotePorts(item)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeConfigPort(t *testing.T) {
+	tests := []struct {
+		name, format, doc string
+	}{
+		{"yaml number", "yaml", "host: db\nport: 5433\n"},
+		{"yaml string", "yaml", "host: db\nport: \"5433\"\n"},
+		{"toml number", "toml", "host = \"db\"\nport = 5433\n"},
+		{"toml string", "toml", "host = \"db\"\nport = \"5433\"\n"},
+		{"json string", "json", `{"host": "db", "port": "5433"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg InserterConfig
+			if err := decodeConfig(strings.NewReader(tt.doc), tt.format, &cfg); err != nil {
+				t.Fatalf("decodeConfig: %v", err)
+			}
+			if cfg.Host != "db" || cfg.Port != "5433" {
+				t.Errorf("host %q port %q, want db 5433", cfg.Host, cfg.Port)
+			}
+		})
+	}
+}
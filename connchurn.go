@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// connectionChurn opens a new connection for every statement and closes it
+// right after, bypassing the pool like an application without one. Every
+// connection costs the server a backend process, which is what PgBouncer
+// sizing and max_connections alarms have to cope with.
+type connectionChurn struct {
+	pool  *pgxpool.Pool
+	query string
+	hold  time.Duration
+
+	mu          sync.Mutex
+	opened      int64
+	failed      int64
+	connectTime time.Duration
+	maxConnect  time.Duration
+}
+
+func (c *connectionChurn) recordConnect(d time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.failed++
+		return
+	}
+	c.opened++
+	c.connectTime += d
+	c.maxConnect = max(c.maxConnect, d)
+}
+
+// task returns a task connecting, running the query, holding the
+// connection for the hold time and disconnecting.
+func (c *connectionChurn) task(ctx context.Context) task {
+	return func() (outcome, error) {
+		result := outcome{name: "connection_churn", read: true}
+		started := time.Now()
+		conn, err := dedicatedConn(ctx, c.pool)
+		c.recordConnect(time.Since(started), err)
+		if err != nil {
+			return result, err
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(ctx, c.query); err != nil {
+			return result, err
+		}
+		if c.hold > 0 {
+			sleep(ctx, c.hold)
+		}
+		return result, nil
+	}
+}
+
+// startConnectionChurn starts the workers of the connection churn workload.
+func startConnectionChurn(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, label string) *connectionChurn {
+	settings := cfg.Inserter.ConnectionChurn
+	c := &connectionChurn{
+		pool:  pool,
+		query: label + settings.Query,
+		hold:  time.Duration(settings.HoldMs) * time.Millisecond,
+	}
+	if settings.Query == "" {
+		c.query = label + "SELECT 1"
+	}
+	e.start(workerSpec{
+		name:        "connection_churn",
+		description: "connection churn worker",
+		concurrency: settings.Workers,
+		limiter:     newRateLimiter(settings.RatePerSecond),
+		newTask:     func(int) task { return c.task(ctx) },
+	})
+	return c
+}
+
+// report prints the connections opened and how long opening them took.
+// Slow or failing connects show the server or the pooler in front of it
+// running out of connections.
+func (c *connectionChurn) report() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Println("Connection churn report:")
+	if c.opened == 0 {
+		fmt.Printf("  no connections opened, %d failed\n", c.failed)
+		return
+	}
+	fmt.Printf("  %d connections opened, %d failed, avg connect %s, max %s\n", c.opened, c.failed,
+		(c.connectTime / time.Duration(c.opened)).Round(time.Microsecond), c.maxConnect.Round(time.Microsecond))
+}
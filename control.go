@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// workerControl pauses the workers sharing a name and overrides their rate
+// at run time, for the control API.
+type workerControl struct {
+	mu       sync.Mutex
+	paused   bool
+	resumed  chan struct{}
+	limiter  *rateLimiter
+	override bool
+	rate     *rateLimiter
+}
+
+func newWorkerControl(limiter *rateLimiter) *workerControl {
+	return &workerControl{limiter: limiter}
+}
+
+func (c *workerControl) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *workerControl) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+// wait blocks while the workers are paused and reports false if ctx is
+// done first.
+func (c *workerControl) wait(ctx context.Context) bool {
+	c.mu.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.mu.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// setRate overrides the rate of the workers, zero does not limit them. The
+// workers get a limiter of their own, so other workers sharing the
+// configured one keep their rate.
+func (c *workerControl) setRate(rate float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.override && c.rate != nil && rate > 0 {
+		c.rate.setRate(rate)
+		return
+	}
+	c.override = true
+	c.rate = newRateLimiter(rate)
+}
+
+// setLimiter replaces the configured limiter of the workers, dropping a
+// rate set through the control API.
+func (c *workerControl) setLimiter(limiter *rateLimiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limiter = limiter
+	c.override = false
+	c.rate = nil
+}
+
+// currentLimiter returns the limiter the workers wait for.
+func (c *workerControl) currentLimiter() *rateLimiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.override {
+		return c.rate
+	}
+	return c.limiter
+}
+
+// workerState is a worker in the responses of the control API.
+type workerState struct {
+	Name          string  `json:"name"`
+	Goroutines    int     `json:"goroutines"`
+	Paused        bool    `json:"paused"`
+	RatePerSecond float64 `json:"rate_per_second"`
+	Inserts       uint64  `json:"inserts"`
+	Updates       uint64  `json:"updates"`
+	Deletes       uint64  `json:"deletes"`
+	Reads         uint64  `json:"reads"`
+	Errors        uint64  `json:"errors"`
+}
+
+// workerStates returns the state of the workers started so far, by name.
+func (e *workerEngine) workerStates() []workerState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var states []workerState
+	for _, name := range slices.Sorted(maps.Keys(e.controls)) {
+		c := e.controls[name]
+		t := e.stats.table(name)
+		reads, readErrors := e.stats.readCounts(name)
+		c.mu.Lock()
+		limiter := c.limiter
+		if c.override {
+			limiter = c.rate
+		}
+		states = append(states, workerState{
+			Name:          name,
+			Goroutines:    e.running[name],
+			Paused:        c.paused,
+			RatePerSecond: limiter.currentRate(),
+			Inserts:       t.inserts.Load(),
+			Updates:       t.updates.Load(),
+			Deletes:       t.deletes.Load(),
+			Reads:         reads,
+			Errors:        t.errors.Load() + readErrors,
+		})
+		c.mu.Unlock()
+	}
+	return states
+}
+
+// serveControl serves the control API and the dashboard using it on addr
+// until ctx is done:
+//
+//	GET  /                             the dashboard
+//	GET  /pool                         the connections of the pool
+//	GET  /workers                      the workers with their state and counters
+//	POST /workers/{name}/pause         stops the workers before their next statement
+//	POST /workers/{name}/resume        resumes them
+//	POST /workers/{name}/rate?rate_per_second=N  changes their rate, 0 does not limit
+//
+// The name "all" applies pause and resume to every worker.
+func serveControl(ctx context.Context, addr string, e *workerEngine, pool *pgxpool.Pool) {
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	controls := func(name string) []*workerControl {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if name == "all" {
+			return slices.Collect(maps.Values(e.controls))
+		}
+		if c, ok := e.controls[name]; ok {
+			return []*workerControl{c}
+		}
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardHTML)
+	})
+	mux.HandleFunc("GET /pool", func(w http.ResponseWriter, r *http.Request) {
+		ps := pool.Stat()
+		writeJSON(w, map[string]int32{
+			"total_conns":    ps.TotalConns(),
+			"acquired_conns": ps.AcquiredConns(),
+			"idle_conns":     ps.IdleConns(),
+			"max_conns":      ps.MaxConns(),
+		})
+	})
+	mux.HandleFunc("GET /workers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, e.workerStates())
+	})
+	for action, apply := range map[string]func(*workerControl){
+		"pause":  (*workerControl).pause,
+		"resume": (*workerControl).resume,
+	} {
+		mux.HandleFunc("POST /workers/{name}/"+action, func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			found := controls(name)
+			if len(found) == 0 {
+				http.Error(w, fmt.Sprintf("no workers named %s", name), http.StatusNotFound)
+				return
+			}
+			for _, c := range found {
+				apply(c)
+			}
+			fmt.Printf("Control API: %s %s\n", action, name)
+			writeJSON(w, e.workerStates())
+		})
+	}
+	mux.HandleFunc("POST /workers/{name}/rate", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		rate, err := strconv.ParseFloat(r.URL.Query().Get("rate_per_second"), 64)
+		if err != nil || rate < 0 {
+			http.Error(w, "rate_per_second must be a number of at least 0", http.StatusBadRequest)
+			return
+		}
+		if name == "all" {
+			http.Error(w, "the rate is set per worker", http.StatusBadRequest)
+			return
+		}
+		found := controls(name)
+		if len(found) == 0 {
+			http.Error(w, fmt.Sprintf("no workers named %s", name), http.StatusNotFound)
+			return
+		}
+		found[0].setRate(rate)
+		fmt.Printf("Control API: rate of %s set to %g per second\n", name, rate)
+		writeJSON(w, e.workerStates())
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Serving the dashboard on http://%s/\n", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error serving the control API:", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// countCommittedRows counts the rows of tables in one repeatable read
+// transaction, so all counts come from the same snapshot.
+func countCommittedRows(ctx context.Context, conn *pgx.Conn, tables []string) (map[string]int64, error) {
+	counts := map[string]int64{}
+	err := pgx.BeginTxFunc(ctx, conn, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		for _, table := range tables {
+			var n int64
+			if err := tx.QueryRow(ctx, "SELECT count(*) FROM "+qualifiedTable("", table)).Scan(&n); err != nil {
+				return fmt.Errorf("counting the rows of %s failed: %w", table, err)
+			}
+			counts[table] = n
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// probeServer opens a new connection and returns the start time of the
+// server, which changes when it restarts.
+func probeServer(ctx context.Context, connCfg *pgx.ConnConfig) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := pgx.ConnectConfig(ctx, connCfg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	var started time.Time
+	err = conn.QueryRow(ctx, "SELECT pg_postmaster_start_time()").Scan(&started)
+	return started, err
+}
+
+// serverRestart is what the probes saw while the server restarted.
+type serverRestart struct {
+	// down is the first probe that failed, or the first one that found the
+	// server restarted when it came back between two probes.
+	down time.Time
+	// recovering is the first probe refused because the server was starting
+	// up or recovering, zero if no probe hit that window.
+	recovering time.Time
+	up         time.Time
+	// started is the new start time of the server.
+	started time.Time
+}
+
+// waitForRestart probes the server every interval until it runs with a
+// start time other than previous, i.e. it went down and came back. hook,
+// when not nil, reports the end of the command restarting the server.
+func waitForRestart(ctx context.Context, connCfg *pgx.ConnConfig, previous time.Time, interval, timeout time.Duration, hook <-chan error) (serverRestart, error) {
+	var r serverRestart
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-hook:
+			if err != nil {
+				return r, fmt.Errorf("restart command failed: %w", err)
+			}
+			hook = nil
+		default:
+		}
+		started, err := probeServer(ctx, connCfg)
+		now := time.Now()
+		// 57P03 is returned while the server starts up, recovers or shuts
+		// down.
+		var pgErr *pgconn.PgError
+		switch {
+		case ctx.Err() != nil:
+			return r, ctx.Err()
+		case err == nil && !started.Equal(previous):
+			if r.down.IsZero() {
+				r.down = now
+			}
+			r.up, r.started = now, started
+			return r, nil
+		case err == nil:
+			// Still the server that ran before the count.
+		case errors.As(err, &pgErr) && pgErr.Code == "57P03":
+			if r.down.IsZero() {
+				r.down = now
+			}
+			if r.recovering.IsZero() && pgErr.Message != "the database system is shutting down" {
+				r.recovering = now
+				fmt.Printf("  %s: %s\n", now.Format(time.TimeOnly), pgErr.Message)
+			}
+		default:
+			if r.down.IsZero() {
+				r.down = now
+				fmt.Printf("  %s: server down: %v\n", now.Format(time.TimeOnly), err)
+			}
+		}
+		if now.After(deadline) {
+			if r.down.IsZero() {
+				return r, fmt.Errorf("the server did not restart within %s", timeout)
+			}
+			return r, fmt.Errorf("the server did not come back within %s", timeout)
+		}
+		if !sleep(ctx, interval) {
+			return r, ctx.Err()
+		}
+	}
+}
+
+// runCrashRecovery rehearses crash recovery: it records the committed row
+// count of the demo tables, has the server crashed or restarted, by the
+// operator or by crash_recovery.restart_command, and measures from probing
+// connections how long the server was unavailable. It then counts the rows
+// again and reports any committed row that did not survive.
+func runCrashRecovery(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	settings := cfg.CrashRecovery
+	interval := time.Duration(settings.ProbeIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	tables := settings.Tables
+	if len(tables) == 0 {
+		rows, err := pool.Query(ctx, `SELECT tablename FROM pg_tables
+			WHERE tablename = ANY($1) AND schemaname = current_schema() ORDER BY tablename`, demoTables)
+		if err != nil {
+			return err
+		}
+		if tables, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			return err
+		}
+		if len(tables) == 0 {
+			return fmt.Errorf("no demo tables found, run create-tables and insert first")
+		}
+	}
+
+	var previous time.Time
+	if err := pool.QueryRow(ctx, "SELECT pg_postmaster_start_time()").Scan(&previous); err != nil {
+		return err
+	}
+	// Only rows committed before the count must survive: the repeatable read
+	// snapshot leaves out the ones still in flight.
+	fmt.Printf("Counting the committed rows of %d tables...\n", len(tables))
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	before, err := countCommittedRows(ctx, conn.Conn(), tables)
+	conn.Release()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, table := range tables {
+		total += before[table]
+	}
+	fmt.Printf("Recorded %d committed rows, server started at %s\n", total, previous.Format(time.DateTime))
+
+	// The connections of the pool do not survive the restart, so the probes
+	// and the second count use their own.
+	connCfg := pool.Config().ConnConfig.Copy()
+	var hook chan error
+	if settings.RestartCommand != "" {
+		fmt.Printf("Running restart command: %s\n", settings.RestartCommand)
+		hook = make(chan error, 1)
+		go func() {
+			// Closing the channel lets it be read again once waitForRestart
+			// took the result of a command that finished early.
+			hook <- runHookCommand(ctx, cfg, "crash_recovery", settings.RestartCommand)
+			close(hook)
+		}()
+	} else {
+		fmt.Println("Crash or restart the server now, e.g. with pg_ctl stop -m immediate and pg_ctl start, or kill -9 of the postmaster")
+	}
+	fmt.Printf("Probing the server every %s for up to %s...\n", interval, timeout)
+	restart, err := waitForRestart(ctx, connCfg, previous, interval, timeout, hook)
+	if err != nil {
+		return err
+	}
+	if hook != nil {
+		// Report a failure of the command even if the server came back.
+		if err := <-hook; err != nil {
+			fmt.Println("Restart command failed after the server came back:", err)
+		}
+	}
+
+	countCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	after, err := func() (map[string]int64, error) {
+		c, err := pgx.ConnectConfig(countCtx, connCfg)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close(context.WithoutCancel(ctx))
+		return countCommittedRows(countCtx, c, tables)
+	}()
+	if err != nil {
+		return fmt.Errorf("counting the rows after the restart failed: %w", err)
+	}
+
+	fmt.Println("\nCrash recovery report:")
+	fmt.Printf("  server restarted at %s\n", restart.started.Format(time.DateTime))
+	fmt.Printf("  unavailable for %s, from the first failed probe to the first connection, +/- %s\n",
+		restart.up.Sub(restart.down).Round(time.Millisecond), interval)
+	// The start time comes from the clock of the server, so this is only
+	// shown when it is plausible on the local one.
+	if restart.started.After(restart.down) {
+		fmt.Printf("  ready %s after the server started, recovery included\n", restart.up.Sub(restart.started).Round(time.Millisecond))
+	}
+	if !restart.recovering.IsZero() {
+		fmt.Printf("  refused connections while starting up or recovering for %s\n", restart.up.Sub(restart.recovering).Round(time.Millisecond))
+	}
+	fmt.Printf("  %-15s %12s %12s %12s\n", "TABLE", "BEFORE", "AFTER", "DIFF")
+	var lost, added int64
+	for _, table := range tables {
+		diff := after[table] - before[table]
+		fmt.Printf("  %-15s %12d %12d %+12d\n", table, before[table], after[table], diff)
+		if diff < 0 {
+			lost -= diff
+		} else {
+			added += diff
+		}
+	}
+	if added > 0 {
+		fmt.Printf("  %d rows were added after the count, by workloads still running\n", added)
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d committed rows did not survive the crash, check fsync and full_page_writes, or whether a workload deletes rows", lost)
+	}
+	fmt.Printf("  all %d committed rows survived\n", total)
+	return nil
+}
@@ -1,34 +1,125 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func connectPool(cfg *InserterConfig) (*pgxpool.Pool, error) {
-	connStr := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?connect_timeout=3",
-		cfg.Username,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.Database,
-	)
+// applicationName identifies the sessions of the tool in pg_stat_activity.
+const applicationName = "demo-db"
+
+// applyConnectionFields copies the connection fields of cfg over the ones
+// parsed from its URL.
+func applyConnectionFields(poolCfg *pgxpool.Config, cfg *InserterConfig) error {
+	port, err := strconv.ParseUint(cfg.Port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port '%s': %w", cfg.Port, err)
+	}
+	conn := poolCfg.ConnConfig
+	if conn.TLSConfig != nil && conn.TLSConfig.ServerName == conn.Host {
+		conn.TLSConfig.ServerName = cfg.Host
+	}
+	conn.Host, conn.Port, conn.Database, conn.User, conn.Password = cfg.Host, uint16(port), cfg.Database, cfg.Username, cfg.Password
+	if conn.ConnectTimeout == 0 {
+		conn.ConnectTimeout = 3 * time.Second
+	}
+	return nil
+}
+
+// connectionURL builds the URL of the connection fields of cfg, escaping
+// characters of the credentials and database that are special in URLs.
+func connectionURL(cfg *InserterConfig) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.Username, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.Database,
+		RawQuery: "connect_timeout=3",
+	}
+	return u.String()
+}
+
+// connectPool opens the pool described by cfg. Options can adjust the pool
+// configuration before it is opened.
+func connectPool(cfg *InserterConfig, options ...func(*pgxpool.Config)) (*pgxpool.Pool, error) {
+	connStr := connectionURL(cfg)
+	if cfg.URL != "" {
+		connStr = cfg.URL
+	}
+	connStr, err := withTLSParams(connStr, cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	poolCfg, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.URL != "" {
+		// Fields overridden after the URL was parsed, e.g. the database of
+		// a tenant, take precedence over it.
+		if err := applyConnectionFields(poolCfg, cfg); err != nil {
+			return nil, err
+		}
+	}
 
-	poolCfg.MaxConns = 5
-	poolCfg.MinConns = 1
-	poolCfg.HealthCheckPeriod = 5 * time.Second
+	if cfg.TLS.ServerName != "" {
+		setServerName(poolCfg, cfg.TLS.ServerName)
+	}
+
+	poolCfg.ConnConfig.RuntimeParams["application_name"] = applicationName
+	if cfg.ReadOnly {
+		poolCfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+	settings := cfg.Pool
+	poolCfg.MaxConns = int32(cmp.Or(settings.MaxConns, 5))
+	poolCfg.MinConns = int32(cmp.Or(settings.MinConns, 1))
+	poolCfg.HealthCheckPeriod = time.Duration(cmp.Or(settings.HealthCheckPeriodSeconds, 5)) * time.Second
+	if settings.ConnectTimeoutSeconds > 0 {
+		poolCfg.ConnConfig.ConnectTimeout = time.Duration(settings.ConnectTimeoutSeconds) * time.Second
+	}
+	// Without a lifetime, connections stay on the backend they were opened
+	// to, e.g. the old primary behind a load balancer after a failover.
+	poolCfg.MaxConnLifetime = time.Duration(settings.MaxConnLifetimeSeconds) * time.Second
+	poolCfg.MaxConnLifetimeJitter = time.Duration(settings.MaxConnLifetimeJitterSeconds) * time.Second
+	poolCfg.MaxConnIdleTime = time.Duration(settings.MaxConnIdleSeconds) * time.Second
+	for _, option := range options {
+		option(poolCfg)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	return pgxpool.NewWithConfig(ctx, poolCfg)
 }
+
+// startPoolRebalancer closes all connections of pool every interval until
+// ctx is done: idle ones right away, the others when they are released.
+// New connections are opened through the load balancer again, so the
+// sessions spread over the backends available at that time. It maintains
+// the pool rather than loading the database, so it stays off the worker
+// engine.
+func startPoolRebalancer(ctx context.Context, pool *pgxpool.Pool, name string, interval time.Duration) {
+	go func() {
+		for sleep(ctx, interval) {
+			recycled := pool.Stat().TotalConns()
+			pool.Reset()
+			var backend string
+			err := pool.QueryRow(ctx, `SELECT COALESCE(host(inet_server_addr()) || ':' || inet_server_port(), 'local socket')`).Scan(&backend)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Printf("Error reading the backend after rebalancing the %s pool: %v\n", name, err)
+				}
+				continue
+			}
+			fmt.Printf("Rebalanced the %s pool, recycled %d connections, new connections go to %s\n", name, recycled, backend)
+		}
+	}()
+}
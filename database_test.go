@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestConnectionURLEscapesFields(t *testing.T) {
+	cfg := &InserterConfig{}
+	cfg.Username = "demo user"
+	cfg.Password = "p@ss:w/rd#?%"
+	cfg.Host = "db"
+	cfg.Port = "5433"
+	cfg.Database = "demo db"
+
+	poolCfg, err := pgxpool.ParseConfig(connectionURL(cfg))
+	if err != nil {
+		t.Fatalf("parsing %q failed: %v", connectionURL(cfg), err)
+	}
+	conn := poolCfg.ConnConfig
+	if conn.User != cfg.Username || conn.Password != cfg.Password || conn.Host != cfg.Host || conn.Port != 5433 || conn.Database != cfg.Database {
+		t.Errorf("got user %q password %q host %q port %d database %q", conn.User, conn.Password, conn.Host, conn.Port, conn.Database)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// deadlockTable holds two rows per pair of transactions of the deadlock
+// workload.
+const deadlockTable = "demo_db_deadlocks"
+
+// setupDeadlocks creates the rows the pairs of the deadlock workload fight
+// over.
+func setupDeadlocks(ctx context.Context, pool *pgxpool.Pool, pairs int) error {
+	steps := []string{
+		`CREATE TABLE IF NOT EXISTS demo_db_deadlocks (id INT PRIMARY KEY, counter BIGINT NOT NULL DEFAULT 0)`,
+		fmt.Sprintf(`INSERT INTO demo_db_deadlocks (id) SELECT g FROM generate_series(1, %d) g ON CONFLICT DO NOTHING`, 2*pairs),
+	}
+	for _, step := range steps {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return fmt.Errorf("creating deadlock table failed: %w", err)
+		}
+	}
+	return registerObjects(ctx, pool, managedObject{Kind: "table", Name: deadlockTable})
+}
+
+// deadlockWorkload runs pairs of transactions updating the same two rows.
+// In opposite orders they deadlock, and the server aborts one of them after
+// deadlock_timeout. In the same order the second waits for the first,
+// which log_lock_waits reports once the wait exceeds deadlock_timeout.
+type deadlockWorkload struct {
+	pool            *pgxpool.Pool
+	label           string
+	hold            time.Duration
+	lockWaitPercent int
+	retry           bool
+
+	deadlockAttempts atomic.Int64
+	deadlocks        atomic.Int64
+	retried          atomic.Int64
+	lockWaits        atomic.Int64
+	waited           atomic.Int64
+}
+
+func (d *deadlockWorkload) update(ctx context.Context, tx pgx.Tx, id int) error {
+	_, err := tx.Exec(ctx, d.label+`UPDATE demo_db_deadlocks SET counter = counter + 1 WHERE id = $1`, id)
+	return err
+}
+
+func isDeadlock(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40P01"
+}
+
+// task returns the task of pair i, deciding for every run whether its two
+// transactions deadlock or only wait for each other.
+func (d *deadlockWorkload) task(ctx context.Context, pair int, r *rand.Rand) task {
+	a, b := 2*pair+1, 2*pair+2
+	return func() (outcome, error) {
+		result := outcome{name: "deadlock"}
+		deadlock := r.IntN(100) >= d.lockWaitPercent
+
+		first, err := d.pool.Begin(ctx)
+		if err != nil {
+			return result, err
+		}
+		defer first.Rollback(context.Background())
+		second, err := d.pool.Begin(ctx)
+		if err != nil {
+			return result, err
+		}
+		defer second.Rollback(context.Background())
+
+		if err := d.update(ctx, first, a); err != nil {
+			return result, err
+		}
+		if deadlock {
+			if err := d.update(ctx, second, b); err != nil {
+				return result, err
+			}
+		}
+
+		// The second transaction waits for the row lock of the first on a.
+		waits := make(chan error, 1)
+		started := time.Now()
+		go func() {
+			err := d.update(ctx, second, a)
+			if err != nil {
+				second.Rollback(context.Background())
+			}
+			waits <- err
+		}()
+		if !sleep(ctx, d.hold) {
+			// Release the waiting transaction before rolling it back.
+			first.Rollback(context.Background())
+			<-waits
+			return result, nil
+		}
+
+		if !deadlock {
+			if err := first.Commit(ctx); err != nil {
+				return result, err
+			}
+			if err := <-waits; err != nil {
+				return result, err
+			}
+			d.lockWaits.Add(1)
+			d.waited.Add(int64(time.Since(started)))
+			result.updated = 2
+			return result, second.Commit(ctx)
+		}
+
+		// The first transaction now needs b, held by the second, which is
+		// waiting for a: one of them is aborted.
+		d.deadlockAttempts.Add(1)
+		firstErr := d.update(ctx, first, b)
+		if firstErr != nil {
+			first.Rollback(context.Background())
+		}
+		secondErr := <-waits
+		var victims [][]int
+		for _, t := range []struct {
+			tx    pgx.Tx
+			err   error
+			order []int
+		}{{first, firstErr, []int{a, b}}, {second, secondErr, []int{b, a}}} {
+			switch {
+			case t.err == nil:
+				if err := t.tx.Commit(ctx); err != nil {
+					return result, err
+				}
+				result.updated += 2
+			case isDeadlock(t.err):
+				d.deadlocks.Add(1)
+				victims = append(victims, t.order)
+			default:
+				return result, t.err
+			}
+		}
+
+		if !d.retry {
+			return result, nil
+		}
+		// Like an application would, run the aborted transaction again.
+		for _, order := range victims {
+			err := pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+				for _, id := range order {
+					if err := d.update(ctx, tx, id); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return result, err
+			}
+			d.retried.Add(1)
+			result.updated += 2
+		}
+		return result, nil
+	}
+}
+
+// startDeadlocks starts one worker per pair of transactions.
+func startDeadlocks(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, seed uint64, label string) *deadlockWorkload {
+	settings := cfg.Inserter.Deadlocks
+	d := &deadlockWorkload{
+		pool:            pool,
+		label:           label,
+		hold:            time.Duration(settings.HoldMs) * time.Millisecond,
+		lockWaitPercent: settings.LockWaitPercent,
+		retry:           settings.Retry,
+	}
+	if d.hold <= 0 {
+		d.hold = 100 * time.Millisecond
+	}
+	e.start(workerSpec{
+		name:        "deadlock",
+		description: fmt.Sprintf("deadlock worker, %d%% lock waits, deadlocks otherwise", d.lockWaitPercent),
+		concurrency: max(settings.Pairs, 1),
+		limiter:     newRateLimiter(settings.RatePerSecond),
+		newTask: func(i int) task {
+			return d.task(ctx, i, newRand(seed, fmt.Sprintf("deadlock-pair-%d", i+1)))
+		},
+	})
+	return d
+}
+
+// report prints the deadlocks the server detected and the lock waits.
+func (d *deadlockWorkload) report() {
+	fmt.Println("Deadlock report:")
+	fmt.Printf("  deadlocks: %d attempts, %d transactions aborted by the server, %d retried\n",
+		d.deadlockAttempts.Load(), d.deadlocks.Load(), d.retried.Load())
+	if waits := d.lockWaits.Load(); waits > 0 {
+		fmt.Printf("  lock waits: %d, avg wait %s\n", waits, (time.Duration(d.waited.Load()) / time.Duration(waits)).Round(time.Millisecond))
+	} else {
+		fmt.Println("  lock waits: 0")
+	}
+}
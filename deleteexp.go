@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// deleteCopyTable is the copy of bigtable each strategy deletes from, so all
+// of them start from the same data and bigtable itself is left alone.
+const deleteCopyTable = "demo_db_delete_experiment"
+
+// deleteStrategies delete the rows matching pred from table, returning the
+// number of rows deleted. Batches are separate statements and transactions.
+var deleteStrategies = map[string]func(ctx context.Context, pool *pgxpool.Pool, table, pred string, batchSize int) (int64, error){
+	"single": func(ctx context.Context, pool *pgxpool.Pool, table, pred string, batchSize int) (int64, error) {
+		tag, err := pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", table, pred))
+		return tag.RowsAffected(), err
+	},
+	"pk_ranges": func(ctx context.Context, pool *pgxpool.Pool, table, pred string, batchSize int) (int64, error) {
+		var lo, hi int64
+		if err := pool.QueryRow(ctx, fmt.Sprintf("SELECT COALESCE(MIN(bigtable_id), 0), COALESCE(MAX(bigtable_id), -1) FROM %s", table)).Scan(&lo, &hi); err != nil {
+			return 0, err
+		}
+		var deleted int64
+		for start := lo; start <= hi; start += int64(batchSize) {
+			tag, err := pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE bigtable_id >= $1 AND bigtable_id < $2 AND %s", table, pred),
+				start, start+int64(batchSize))
+			if err != nil {
+				return deleted, err
+			}
+			deleted += tag.RowsAffected()
+		}
+		return deleted, nil
+	},
+	// ctid_ranges walks the heap by page ranges holding about batchSize
+	// rows, which TID range scans read without touching the index.
+	"ctid_ranges": func(ctx context.Context, pool *pgxpool.Pool, table, pred string, batchSize int) (int64, error) {
+		var pages int64
+		var tuples float64
+		if err := pool.QueryRow(ctx, "SELECT relpages, reltuples FROM pg_class WHERE oid = to_regclass($1)", table).Scan(&pages, &tuples); err != nil {
+			return 0, err
+		}
+		pagesPerBatch := int64(1)
+		if pages > 0 && tuples > 0 {
+			pagesPerBatch = max(int64(float64(batchSize)/(tuples/float64(pages))), 1)
+		}
+		var deleted int64
+		for start := int64(0); start < pages; start += pagesPerBatch {
+			tag, err := pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE ctid >= $1::tid AND ctid < $2::tid AND %s", table, pred),
+				fmt.Sprintf("(%d,0)", start), fmt.Sprintf("(%d,0)", start+pagesPerBatch))
+			if err != nil {
+				return deleted, err
+			}
+			deleted += tag.RowsAffected()
+		}
+		return deleted, nil
+	},
+}
+
+func deleteStrategyNames() []string {
+	names := make([]string, 0, len(deleteStrategies))
+	for name := range deleteStrategies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// deleteResult is the measurement of one strategy.
+type deleteResult struct {
+	strategy string
+	deleted  int64
+	duration time.Duration
+	walBytes int64
+	// maxLagBytes is the largest replay lag of a standby seen while the
+	// strategy ran, -1 without standbys.
+	maxLagBytes int64
+}
+
+// sampleReplicationLag records the largest replay lag of the standbys in
+// bytes every 250ms until ctx is done.
+func sampleReplicationLag(ctx context.Context, pool *pgxpool.Pool, maxLag *int64, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var lag *int64
+		err := pool.QueryRow(ctx, `SELECT MAX(pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn))::bigint FROM pg_stat_replication`).Scan(&lag)
+		if err == nil && lag != nil {
+			*maxLag = max(*maxLag, *lag)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDeleteStrategy copies bigtable, deletes the matching rows of the copy
+// with strategy and measures the duration, the WAL written and the
+// replication lag.
+func runDeleteStrategy(ctx context.Context, pool *pgxpool.Pool, strategy, pred string, batchSize int) (deleteResult, error) {
+	result := deleteResult{strategy: strategy, maxLagBytes: -1}
+	table := qualifiedTable("", deleteCopyTable)
+	steps := []string{
+		"DROP TABLE IF EXISTS " + table,
+		fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s", table, qualifiedTable("", "bigtable")),
+		fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (bigtable_id)", table),
+		"ANALYZE " + table,
+	}
+	for _, step := range steps {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return result, fmt.Errorf("preparing the copy of bigtable failed: %s: %w", step, err)
+		}
+	}
+	// Starting every strategy right after a checkpoint makes their full
+	// page images comparable.
+	if _, err := pool.Exec(ctx, "CHECKPOINT"); err != nil {
+		fmt.Printf("Could not run CHECKPOINT, WAL volumes depend on checkpoint timing: %v\n", err)
+	}
+
+	var startLSN string
+	if err := pool.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&startLSN); err != nil {
+		return result, err
+	}
+	var standbys bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_stat_replication)").Scan(&standbys); err != nil {
+		return result, err
+	}
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if standbys {
+		result.maxLagBytes = 0
+		wg.Add(1)
+		go sampleReplicationLag(sampleCtx, pool, &result.maxLagBytes, &wg)
+	}
+
+	started := time.Now()
+	deleted, err := deleteStrategies[strategy](ctx, pool, table, pred, batchSize)
+	result.duration = time.Since(started)
+	result.deleted = deleted
+	stopSampling()
+	wg.Wait()
+	if err != nil {
+		return result, fmt.Errorf("deleting with strategy %s failed: %w", strategy, err)
+	}
+
+	err = pool.QueryRow(ctx, "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), $1::pg_lsn)::bigint", startLSN).Scan(&result.walBytes)
+	return result, err
+}
+
+// runDeleteExperiment deletes delete_experiment.percent of the rows of a
+// copy of bigtable with each strategy in turn and compares them.
+func runDeleteExperiment(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	exp := cfg.DeleteExperiment
+	percent := exp.Percent
+	if percent <= 0 {
+		percent = 30
+	}
+	batchSize := exp.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+	strategies := exp.Strategies
+	if len(strategies) == 0 {
+		strategies = deleteStrategyNames()
+	}
+	// Spread the deleted rows over the whole table, like a purge by a
+	// condition would.
+	pred := fmt.Sprintf("bigtable_id %% 100 < %d", percent)
+
+	var rows int64
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM bigtable").Scan(&rows); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("bigtable is empty, load it first, e.g. with insert -tables bigtable")
+	}
+	fmt.Printf("Deleting %d%% of a copy of bigtable (%d rows) with %d strategies, batches of %d rows...\n",
+		percent, rows, len(strategies), batchSize)
+
+	var results []deleteResult
+	defer pool.Exec(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS "+qualifiedTable("", deleteCopyTable))
+	for _, strategy := range strategies {
+		fmt.Printf("Running strategy %s...\n", strategy)
+		result, err := runDeleteStrategy(ctx, pool, strategy, pred, batchSize)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	fmt.Printf("\n%-12s %12s %12s %12s %16s\n", "STRATEGY", "DELETED", "DURATION", "WAL", "MAX REPLAY LAG")
+	for _, r := range results {
+		lag := "no standby"
+		if r.maxLagBytes >= 0 {
+			lag = formatBytes(r.maxLagBytes)
+		}
+		fmt.Printf("%-12s %12d %12s %12s %16s\n", r.strategy, r.deleted, r.duration.Round(time.Millisecond), formatBytes(r.walBytes), lag)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// dirtKinds are the kinds of dirt the dirty data mode injects.
+var dirtKinds = []string{"typo", "case", "whitespace", "mojibake"}
+
+// mojibake maps letters to their accented variant encoded as UTF-8 and
+// decoded as Latin-1, as left behind by a wrong client encoding.
+var mojibake = map[rune]string{'a': "Ã¡", 'e': "Ã©", 'i': "Ã¯", 'o': "Ã¶", 'u': "Ã¼", 'n': "Ã±", 'c': "Ã§"}
+
+// dirtyData injects the dirt of manually entered and badly imported data
+// into a share of the generated text values, for demos of cleaning
+// pipelines and of citext or trim based indexes. A nil dirtyData keeps the
+// values clean.
+type dirtyData struct {
+	percent float64
+	kinds   []string
+}
+
+func newDirtyData(percent float64, kinds []string) *dirtyData {
+	if len(kinds) == 0 {
+		kinds = dirtKinds
+	}
+	return &dirtyData{percent: cmp.Or(percent, 5), kinds: kinds}
+}
+
+// apply returns value with dirt for percent of the values, limited to
+// length characters.
+func (d *dirtyData) apply(r *rand.Rand, value string, length int) string {
+	if d == nil || value == "" || r.Float64()*100 >= d.percent {
+		return value
+	}
+	runes := []rune(value)
+	switch d.kinds[r.IntN(len(d.kinds))] {
+	case "typo":
+		i := r.IntN(len(runes))
+		switch r.IntN(3) {
+		case 0:
+			// Swapped letters.
+			if i+1 < len(runes) {
+				runes[i], runes[i+1] = runes[i+1], runes[i]
+			}
+		case 1:
+			// A missing letter.
+			runes = slices.Delete(runes, i, i+1)
+		default:
+			// A doubled letter.
+			runes = slices.Insert(runes, i, runes[i])
+		}
+	case "case":
+		switch r.IntN(3) {
+		case 0:
+			runes = []rune(strings.ToUpper(value))
+		case 1:
+			runes = []rune(strings.ToLower(value))
+		default:
+			for i, c := range runes {
+				switch {
+				case r.IntN(2) == 0:
+				case unicode.IsUpper(c):
+					runes[i] = unicode.ToLower(c)
+				default:
+					runes[i] = unicode.ToUpper(c)
+				}
+			}
+		}
+	case "whitespace":
+		switch r.IntN(3) {
+		case 0:
+			runes = append(runes, ' ')
+		case 1:
+			runes = append([]rune{' '}, runes...)
+		default:
+			if i := strings.IndexByte(value, ' '); i >= 0 {
+				runes = []rune(value[:i] + "  " + value[i+1:])
+			} else {
+				runes = append(runes, ' ', ' ')
+			}
+		}
+	case "mojibake":
+		var positions []int
+		for i, c := range runes {
+			if _, ok := mojibake[unicode.ToLower(c)]; ok {
+				positions = append(positions, i)
+			}
+		}
+		if len(positions) > 0 {
+			i := positions[r.IntN(len(positions))]
+			runes = slices.Replace(runes, i, i+1, []rune(mojibake[unicode.ToLower(runes[i])])...)
+		}
+	}
+	if length > 0 && len(runes) > length {
+		runes = runes[:length]
+	}
+	return string(runes)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// dumpFormats are the file formats the dump command writes.
+var dumpFormats = []string{"csv", "ndjson"}
+
+// primaryKeyOrder returns the ORDER BY clause sorting table by its primary
+// key, empty when it has none, so dumps of the same data are identical.
+func primaryKeyOrder(ctx context.Context, pool *pgxpool.Pool, table string) (string, error) {
+	var columns string
+	err := pool.QueryRow(ctx, `SELECT COALESCE(string_agg(quote_ident(a.attname), ', ' ORDER BY array_position(i.indkey::int2[], a.attnum)), '')
+		FROM pg_index i JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = $1::regclass AND i.indisprimary`, table).Scan(&columns)
+	if err != nil || columns == "" {
+		return "", err
+	}
+	return " ORDER BY " + columns, nil
+}
+
+// dumpTable writes the rows of table to w and returns how many it wrote.
+// CSV is written by COPY TO, with a header line. NDJSON has one object per
+// row from row_to_json, read with a query: the text format of COPY would
+// escape the backslashes of the JSON.
+func dumpTable(ctx context.Context, pool *pgxpool.Pool, table, format string, w *bufio.Writer) (int64, error) {
+	order, err := primaryKeyOrder(ctx, pool, table)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("SELECT * FROM %s%s", table, order)
+	if format == "csv" {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Release()
+		tag, err := conn.Conn().PgConn().CopyTo(ctx, w, fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT csv, HEADER)", query))
+		return tag.RowsAffected(), err
+	}
+	rows, err := pool.Query(ctx, fmt.Sprintf("SELECT row_to_json(t)::text FROM (%s) t", query))
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	var line string
+	_, err = pgx.ForEachRow(rows, []any{&line}, func() error {
+		n++
+		w.WriteString(line)
+		return w.WriteByte('\n')
+	})
+	return n, err
+}
+
+// dumpFile writes table to path, removing the file again when the dump
+// fails.
+func dumpFile(ctx context.Context, pool *pgxpool.Pool, table, format, path string) (rows, bytes int64, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	rows, err = dumpTable(ctx, pool, table, format, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return rows, info.Size(), nil
+}
+
+// runDump exports the demo tables, or the selected ones, to one file per
+// table in dump.directory. Tables that do not exist are skipped. In
+// multi-tenant mode the files of each tenant schema are prefixed with it.
+func runDump(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, selected []string) error {
+	settings := cfg.Dump
+	tables := demoTables
+	if len(selected) > 0 {
+		tables = selected
+	} else if len(settings.Tables) > 0 {
+		tables = settings.Tables
+	}
+	if err := checkTableNames(tables); err != nil {
+		return err
+	}
+	format := cmp.Or(settings.Format, "csv")
+	dir := cmp.Or(settings.Directory, "dump")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	fmt.Printf("Dumping tables as %s into %s...\n", format, dir)
+	var files int
+	var totalRows, totalBytes int64
+	for _, schema := range workloadSchemas(cfg) {
+		for _, t := range tables {
+			table := qualifiedTable(schema, t)
+			var exists bool
+			if err := pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				continue
+			}
+			name := t + "." + format
+			if schema != "" {
+				name = schema + "." + name
+			}
+			path := filepath.Join(dir, name)
+			started := time.Now()
+			rows, bytes, err := dumpFile(ctx, pool, table, format, path)
+			if err != nil {
+				return fmt.Errorf("dumping %s failed: %w", table, err)
+			}
+			fmt.Printf("  %-30s %10d rows %10s in %s\n", path, rows, formatBytes(bytes), time.Since(started).Round(time.Millisecond))
+			files++
+			totalRows += rows
+			totalBytes += bytes
+		}
+	}
+	if files == 0 {
+		return fmt.Errorf("none of the tables %v exist, run create-tables and insert first", tables)
+	}
+	fmt.Printf("Dumped %d rows, %s, into %d files\n", totalRows, formatBytes(totalBytes), files)
+	return nil
+}
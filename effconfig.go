@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secrets in the effective configuration.
+const redacted = "REDACTED"
+
+// effectiveConfig returns cfg as indented JSON, as a run uses it after
+// merging the file, the environment variables, the flags and the defaults.
+// The secrets in secretFields are redacted.
+func effectiveConfig(cfg *InserterConfig) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	redactSecrets(doc)
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// secretFields are the fields of the configuration holding secrets, by
+// path, with the function redacting them: passwords and webhook URLs, which
+// often embed a token, entirely, connection strings only their password.
+var secretFields = map[string]func(string) string{
+	"password":                       redactAll,
+	"url":                            redactURL,
+	"inserter.outbox.webhook_url":    redactAll,
+	"clone.source_url":               redactURL,
+	"fdw.remote_url":                 redactURL,
+	"replication.subscriber_url":     redactURL,
+	"replication.publisher_conninfo": redactURL,
+	"notifications.webhook_url":      redactAll,
+}
+
+func redactAll(string) string { return redacted }
+
+// secretRedactor returns the function redacting the field at path, nil for
+// fields that are not secret. Fields missing from secretFields are redacted
+// by their name too, so a connection string added later is not leaked.
+func secretRedactor(path, key string) func(string) string {
+	if redact, ok := secretFields[path]; ok {
+		return redact
+	}
+	switch {
+	case strings.HasSuffix(key, "password"), strings.HasSuffix(key, "webhook_url"):
+		return redactAll
+	case key == "url", strings.HasSuffix(key, "_url"), strings.HasSuffix(key, "conninfo"):
+		return redactURL
+	}
+	return nil
+}
+
+// redactSecrets redacts the secrets of a decoded configuration in place.
+func redactSecrets(value any) {
+	redactSecretsAt("", value)
+}
+
+func redactSecretsAt(path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			s, isString := field.(string)
+			if !isString {
+				redactSecretsAt(fieldPath, field)
+				continue
+			}
+			if redact := secretRedactor(fieldPath, key); redact != nil && s != "" {
+				v[key] = redact(s)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			redactSecretsAt(path, item)
+		}
+	}
+}
+
+// conninfoPassword matches the password of a keyword/value connection
+// string, quoted or not.
+var conninfoPassword = regexp.MustCompile(`\bpassword\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// urlCredentials matches the user and password of a URL. The password
+// ends at the last @, so one containing reserved characters like @ / # ?
+// is redacted entirely, even where url.Parse would split it.
+var urlCredentials = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@]*):.*@`)
+
+// urlPassword matches the password parameter of a URL.
+var urlPassword = regexp.MustCompile(`([?&]password=)[^&]*`)
+
+// redactURL redacts the password of a connection URL, in URL or keyword
+// value form.
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return conninfoPassword.ReplaceAllString(s, "password="+redacted)
+	}
+	s = urlCredentials.ReplaceAllString(s, "${1}:"+redacted+"@")
+	return urlPassword.ReplaceAllString(s, "${1}"+redacted)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"url with password", "postgres://demo:s3cret@db:5432/demo", "postgres://demo:REDACTED@db:5432/demo"},
+		{"url without password", "postgres://demo@db/demo", "postgres://demo@db/demo"},
+		{"url password parameter", "postgres://db/demo?password=s3cret&sslmode=require", "postgres://db/demo?password=REDACTED&sslmode=require"},
+		{"url with reserved characters", "postgres://demo:p@ss/w#rd@db/demo", "postgres://demo:REDACTED@db/demo"},
+		{"conninfo", "host=db-a port=5432 user=demo password=s3cret", "host=db-a port=5432 user=demo password=REDACTED"},
+		{"conninfo with spaces", "host=db-a password = s3cret dbname=demo", "host=db-a password=REDACTED dbname=demo"},
+		{"conninfo quoted", `host=db-a password='s3 cr\'et' dbname=demo`, "host=db-a password=REDACTED dbname=demo"},
+		{"conninfo without password", "host=db-a dbname=demo", "host=db-a dbname=demo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactURL(tt.in); got != tt.want {
+				t.Errorf("redactURL(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveConfigRedactsSecrets(t *testing.T) {
+	const secret = "s3cret"
+	cfg := &InserterConfig{}
+	cfg.Password = secret
+	cfg.URL = "postgres://demo:" + secret + "@db/demo"
+	cfg.Inserter.Outbox.WebhookURL = "https://hooks.example.com/" + secret
+	cfg.Clone.SourceURL = "postgres://demo:" + secret + "@source/demo"
+	cfg.FDW.RemoteURL = "postgres://demo:" + secret + "@remote/demo"
+	cfg.Replication.SubscriberURL = "host=subscriber password=" + secret
+	cfg.Replication.PublisherConninfo = "host=db-a port=5432 dbname=demo user=demo password=" + secret
+	cfg.Notifications.WebhookURL = "https://hooks.example.com/" + secret
+
+	data, err := effectiveConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Errorf("effective config contains the secret:\n%s", data)
+	}
+	if !strings.Contains(string(data), "host=db-a port=5432 dbname=demo user=demo password=REDACTED") {
+		t.Errorf("publisher_conninfo not redacted to its password only:\n%s", data)
+	}
+}
+
+// TestSecretFieldsExist catches paths in secretFields that no longer match a
+// field of the configuration, which would silently stop redacting them.
+func TestSecretFieldsExist(t *testing.T) {
+	data, err := json.Marshal(&InserterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for path := range secretFields {
+		var value any = doc
+		for _, key := range strings.Split(path, ".") {
+			m, ok := value.(map[string]any)
+			if !ok {
+				value = nil
+				break
+			}
+			value = m[key]
+		}
+		if _, ok := value.(string); !ok {
+			t.Errorf("secretFields has %s, which is not a string field of the config", path)
+		}
+	}
+}
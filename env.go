@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// envPrefix is the prefix of the environment variables overriding config
+// fields, e.g. DEMODB_PASSWORD or DEMODB_INSERTER_TIMESTAMP_INSERTS_ENABLED.
+const envPrefix = "DEMODB"
+
+// applyEnvOverrides sets the fields of cfg that have an environment
+// variable named after their JSON path. Strings are taken as is, string
+// lists may be comma separated and everything else is parsed as JSON, so
+// maps are passed as objects. A connection URL, from DATABASE_URL,
+// DEMODB_URL or the url field, replaces the connection fields of the
+// config file, while DEMODB_HOST and friends still win over the URL.
+func applyEnvOverrides(cfg *InserterConfig) error {
+	for _, name := range []string{"DATABASE_URL", envPrefix + "_URL"} {
+		if url := os.Getenv(name); url != "" {
+			cfg.URL = url
+		}
+	}
+	if cfg.URL != "" {
+		if err := setConnectionURL(cfg, cfg.URL); err != nil {
+			return err
+		}
+	}
+	return applyEnvFields(reflect.ValueOf(cfg).Elem(), envPrefix)
+}
+
+// setConnectionURL points cfg at the database of a postgres:// URL.
+func setConnectionURL(cfg *InserterConfig, url string) error {
+	connCfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		return fmt.Errorf("invalid database url: %w", err)
+	}
+	cfg.URL = url
+	cfg.Host = connCfg.Host
+	cfg.Port = strconv.Itoa(int(connCfg.Port))
+	cfg.Database = connCfg.Database
+	cfg.Username = connCfg.User
+	cfg.Password = connCfg.Password
+	return nil
+}
+
+func applyEnvFields(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvFields(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvField(field, value); err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setEnvField(field reflect.Value, value string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(value, "["):
+		field.Set(reflect.ValueOf(splitList(value)))
+		return nil
+	}
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// setupFDW connects the configured database to the one at fdw.remote_url
+// with postgres_fdw and imports the demo tables of the remote schema as
+// foreign tables into the local schema, replacing earlier imports.
+// Existing servers and user mappings of the same name are kept.
+func setupFDW(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, server, localSchema string) error {
+	remote := *cfg
+	if err := setConnectionURL(&remote, cfg.FDW.RemoteURL); err != nil {
+		return fmt.Errorf("fdw.remote_url: %w", err)
+	}
+	remoteSchema := cfg.FDW.RemoteSchema
+	if remoteSchema == "" {
+		remoteSchema = "public"
+	}
+
+	var schemaExists bool
+	if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)`, localSchema).Scan(&schemaExists); err != nil {
+		return err
+	}
+
+	serverName, schemaName := pgx.Identifier{server}.Sanitize(), pgx.Identifier{localSchema}.Sanitize()
+	limitTo := make([]string, len(demoTables))
+	var dropImported []string
+	for i, table := range demoTables {
+		limitTo[i] = pgx.Identifier{table}.Sanitize()
+		// Fails on regular tables, which are never replaced.
+		dropImported = append(dropImported, fmt.Sprintf(`DROP FOREIGN TABLE IF EXISTS %s`, qualifiedTable(localSchema, table)))
+	}
+	steps := []string{
+		`CREATE EXTENSION IF NOT EXISTS postgres_fdw`,
+		fmt.Sprintf(`CREATE SERVER IF NOT EXISTS %s FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host %s, port %s, dbname %s)`,
+			serverName, quoteLiteral(remote.Host), quoteLiteral(remote.Port), quoteLiteral(remote.Database)),
+		fmt.Sprintf(`CREATE USER MAPPING IF NOT EXISTS FOR CURRENT_USER SERVER %s OPTIONS (user %s, password %s)`,
+			serverName, quoteLiteral(remote.Username), quoteLiteral(remote.Password)),
+		fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s`, schemaName),
+	}
+	steps = append(steps, dropImported...)
+	steps = append(steps,
+		fmt.Sprintf(`IMPORT FOREIGN SCHEMA %s LIMIT TO (%s) FROM SERVER %s INTO %s`,
+			pgx.Identifier{remoteSchema}.Sanitize(), strings.Join(limitTo, ", "), serverName, schemaName))
+	for _, step := range steps {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return fmt.Errorf("setting up postgres_fdw failed: %s: %w", strings.SplitN(step, " (", 2)[0], err)
+		}
+	}
+
+	var imported []string
+	err := pool.QueryRow(ctx, `SELECT COALESCE(array_agg(c.relname ORDER BY c.relname), '{}') FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind = 'f'`, localSchema).Scan(&imported)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d foreign tables from %s/%s into schema %s: %s\n",
+		len(imported), remote.Host, remote.Database, localSchema, strings.Join(imported, ", "))
+
+	objects := []managedObject{
+		{Kind: "extension", Name: "postgres_fdw"},
+		{Kind: "server", Name: server},
+	}
+	if !schemaExists {
+		objects = append(objects, managedObject{Kind: "schema", Name: localSchema})
+	}
+	for _, table := range imported {
+		objects = append(objects, managedObject{Kind: "foreign table", Schema: localSchema, Name: table})
+	}
+	return registerObjects(ctx, pool, objects...)
+}
+
+// runFDWDemo sets up postgres_fdw and runs the read workload against the
+// foreign tables, showing the remote SQL postgres_fdw pushes down.
+func runFDWDemo(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	if cfg.FDW.RemoteURL == "" {
+		return fmt.Errorf("fdw.remote_url is required")
+	}
+	server := cfg.FDW.ServerName
+	if server == "" {
+		server = "demo_db_remote"
+	}
+	localSchema := cfg.FDW.LocalSchema
+	if localSchema == "" {
+		localSchema = "remote"
+	}
+
+	if err := setupFDW(ctx, cfg, pool, server, localSchema); err != nil {
+		return err
+	}
+
+	join := readPatterns["join"](localSchema)
+	if plan, err := explainWith(ctx, pool, "ANALYZE, VERBOSE", join); err == nil {
+		fmt.Printf("\n=== Join across the foreign data wrapper ===\n%s\n%s\n\n", join, plan)
+	} else {
+		fmt.Println("Error explaining the join:", err)
+	}
+
+	duration := time.Duration(cfg.FDW.DurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	execCtx, cancelExec := statementContext(ctx, drainTimeout(cfg))
+	defer cancelExec()
+
+	fmt.Printf("Running the read workload across the foreign data wrapper for %s...\n", duration)
+	stats := newRunStats()
+	engine := newWorkerEngine(ctx, stats, newRetryPolicy(cfg), nil)
+	seed := runSeed(cfg)
+	engine.start(workerSpec{
+		name:        "fdw-read",
+		description: "read worker across the foreign data wrapper",
+		concurrency: cfg.FDW.Workers,
+		limiter:     newRateLimiter(cfg.FDW.RatePerSecond),
+		newTask: func(i int) task {
+			label := statementLabel(cfg, stats.runID, fmt.Sprintf("fdw-read-worker-%d", i+1))
+			return readTask(execCtx, pool, newRand(seed, fmt.Sprintf("fdw-read-worker-%d", i+1)), label, []string{localSchema}, defaultReadPatterns(false), 5)
+		},
+	})
+	engine.started()
+	engine.wait()
+
+	fmt.Println(stats.summary())
+	return nil
+}
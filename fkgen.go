@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxTrackedIDs bounds how many ids per table are kept for picking foreign
+// key references. Older ids are overwritten once the limit is reached.
+const maxTrackedIDs = 10000
+
+// idTracker remembers ids of parent rows so child rows can be inserted with
+// valid foreign keys, and hands out ids for tables without an identity
+// column. Keys are "schema.table".
+type idTracker struct {
+	mu   sync.Mutex
+	ids  map[string][]int64
+	pos  map[string]int
+	next map[string]int64
+	// keys is the distribution of the ids returned by random.
+	keys keyDistribution
+}
+
+func newIDTracker(keys keyDistribution) *idTracker {
+	return &idTracker{
+		keys: keys,
+		ids:  map[string][]int64{},
+		pos:  map[string]int{},
+		next: map[string]int64{},
+	}
+}
+
+func trackerKey(schema, table string) string {
+	return schema + "." + table
+}
+
+func (t *idTracker) add(schema, table string, id int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := trackerKey(schema, table)
+	if len(t.ids[key]) < maxTrackedIDs {
+		t.ids[key] = append(t.ids[key], id)
+		return
+	}
+	t.ids[key][t.pos[key]] = id
+	t.pos[key] = (t.pos[key] + 1) % maxTrackedIDs
+}
+
+// addRows adds the ids returned by an INSERT ... RETURNING, closes rows and
+// returns the ids.
+func (t *idTracker) addRows(schema, table string, rows pgx.Rows) []int64 {
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return ids
+		}
+		t.add(schema, table, id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// random returns a known id of table picked following the key
+// distribution, or an error when no parent rows are known yet.
+func (t *idTracker) random(r *rand.Rand, schema, table string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := t.ids[trackerKey(schema, table)]
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("no %s rows available yet to reference", table)
+	}
+	return ids[t.keys.index(r, len(ids))], nil
+}
+
+// load samples the most recent existing ids of table from the database.
+func (t *idTracker) load(ctx context.Context, pool *pgxpool.Pool, schema, table string) error {
+	column := table + "_id"
+	rows, err := pool.Query(ctx, fmt.Sprintf(`SELECT %s FROM %s ORDER BY %[1]s DESC LIMIT %[3]d`,
+		column, qualifiedTable(schema, table), maxTrackedIDs))
+	if err != nil {
+		return fmt.Errorf("loading %s ids failed: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		t.add(schema, table, id)
+	}
+	return rows.Err()
+}
+
+// nextID returns the next id for a table without an identity column. The
+// counter starts after the current MAX(id) and is shared by all workers of
+// this process.
+func (t *idTracker) nextID(ctx context.Context, pool *pgxpool.Pool, schema, table string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := trackerKey(schema, table)
+	if _, ok := t.next[key]; !ok {
+		var maxID int64
+		err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(%s), 0) FROM %s`, table+"_id", qualifiedTable(schema, table))).Scan(&maxID)
+		if err != nil {
+			return 0, fmt.Errorf("reading max %s id failed: %w", table, err)
+		}
+		t.next[key] = maxID
+	}
+	t.next[key]++
+	return t.next[key], nil
+}
+
+// resetNextIDs makes nextID read MAX(id) again, after other writers
+// inserted ids past the counters.
+func (t *idTracker) resetNextIDs() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.next)
+}
+
+// relationalTasks returns gibberish insert tasks for the child tables album,
+// track and playlist_track, referencing parent ids known to the tracker.
+// Each task draws from its own stream of seed.
+func relationalTasks(ctx context.Context, pool *pgxpool.Pool, ids *idTracker, acks *ackTracker, columns *columnValues, orphans *orphanInjector, schemas []string, seed uint64, label func(string) string) map[string]func() error {
+	return map[string]func() error{
+		"album": withRand(seed, "album", func(r *rand.Rand) error {
+			schema := pickSchema(r, schemas)
+			artistID, err := ids.random(r, schema, "artist")
+			if err != nil {
+				return err
+			}
+			albumID, err := ids.nextID(ctx, pool, schema, "album")
+			if err != nil {
+				return err
+			}
+			table := qualifiedTable(schema, "album")
+			err = acks.exec(ctx, pool, table, "album_id", label("album")+fmt.Sprintf(`INSERT INTO %s (album_id, title, artist_id) VALUES ($1, $2, $3)`, table),
+				albumID, columns.shape(r, "album", "title", GenerateRandomString(r, 160)), orphans.id(r, "album", artistID))
+			if err == nil {
+				ids.add(schema, "album", albumID)
+			}
+			return err
+		}),
+		"track": withRand(seed, "track", func(r *rand.Rand) error {
+			schema := pickSchema(r, schemas)
+			albumID, err := ids.random(r, schema, "album")
+			if err != nil {
+				return err
+			}
+			mediaTypeID, err := ids.random(r, schema, "media_type")
+			if err != nil {
+				return err
+			}
+			genreID, err := ids.random(r, schema, "genre")
+			if err != nil {
+				return err
+			}
+			trackID, err := ids.nextID(ctx, pool, schema, "track")
+			if err != nil {
+				return err
+			}
+			table := qualifiedTable(schema, "track")
+			err = acks.exec(ctx, pool, table, "track_id", label("track")+fmt.Sprintf(`INSERT INTO %s (track_id, name, album_id, media_type_id, genre_id, composer, milliseconds, bytes, unit_price)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, table),
+				trackID, columns.shape(r, "track", "name", GenerateRandomString(r, 200)), orphans.id(r, "track", albumID), mediaTypeID, genreID,
+				columns.shape(r, "track", "composer", GenerateRandomString(r, 220)),
+				r.IntN(600000), r.IntN(20000000), 0.99)
+			if err == nil {
+				ids.add(schema, "track", trackID)
+			}
+			return err
+		}),
+		"playlist_track": withRand(seed, "playlist_track", func(r *rand.Rand) error {
+			schema := pickSchema(r, schemas)
+			playlistID, err := ids.random(r, schema, "playlist")
+			if err != nil {
+				return err
+			}
+			trackID, err := ids.random(r, schema, "track")
+			if err != nil {
+				return err
+			}
+			_, err = pool.Exec(ctx, label("playlist_track")+fmt.Sprintf(`INSERT INTO %s (playlist_id, track_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, qualifiedTable(schema, "playlist_track")),
+				playlistID, orphans.id(r, "playlist_track", trackID))
+			return err
+		}),
+	}
+}
@@ -2,7 +2,12 @@ module github.com/defilippomattia/demo-db
 
 go 1.25.5
 
-require github.com/jackc/pgx/v5 v5.8.0
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/jackc/pgx/v5 v5.8.0
+	golang.org/x/sys v0.38.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
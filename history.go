@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// historyTables are the tables whose changes are kept in a history table
+// named after them, e.g. customer_history.
+var historyTables = []string{"customer", "employee"}
+
+// historyReadPatterns are the read patterns querying the history tables,
+// usable only with inserter.history enabled.
+var historyReadPatterns = []string{"customer_as_of"}
+
+// historyUpdates are the updates of the history workload, with the widths
+// of the random values they set.
+var historyUpdates = map[string]struct {
+	query  string
+	widths []int
+}{
+	"customer": {`UPDATE %[1]s SET email = $1, phone = $2
+		WHERE customer_id = (SELECT floor(random() * MAX(customer_id))::int + 1 FROM %[1]s)`, []int{60, 24}},
+	"employee": {`UPDATE %[1]s SET title = $1, city = $2
+		WHERE employee_id = (SELECT floor(random() * MAX(employee_id))::int + 1 FROM %[1]s)`, []int{30, 40}},
+}
+
+// setupHistory versions the history tables system-versioned style: each
+// row gets a valid_from column and a trigger copies the old version of
+// updated and deleted rows into the history table with its valid_to.
+// Running it again keeps the existing history.
+func setupHistory(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	for _, schema := range schemas {
+		function := qualifiedTable(schema, "demo_db_history")
+		steps := []string{fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger LANGUAGE plpgsql AS $$
+			BEGIN
+				EXECUTE format('INSERT INTO %%I.%%I SELECT ($1).*, now(), $2', TG_TABLE_SCHEMA, TG_TABLE_NAME || '_history')
+					USING OLD, TG_OP;
+				IF TG_OP = 'DELETE' THEN
+					RETURN OLD;
+				END IF;
+				NEW.valid_from := now();
+				RETURN NEW;
+			END
+			$$`, function)}
+		objects := []managedObject{{Kind: "function", Schema: schema, Name: "demo_db_history"}}
+
+		for _, table := range historyTables {
+			target, history := qualifiedTable(schema, table), qualifiedTable(schema, table+"_history")
+			steps = append(steps,
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS valid_from timestamptz NOT NULL DEFAULT now()`, target),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE %s, valid_to timestamptz NOT NULL, operation text NOT NULL)`, history, target),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (%s, valid_to)`,
+					pgx.Identifier{table + "_history_as_of_idx"}.Sanitize(), history, pgx.Identifier{table + "_id"}.Sanitize()),
+				fmt.Sprintf(`DROP TRIGGER IF EXISTS demo_db_history ON %s`, target),
+				fmt.Sprintf(`CREATE TRIGGER demo_db_history BEFORE UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s()`, target, function),
+			)
+			objects = append(objects, managedObject{Kind: "table", Schema: schema, Name: table + "_history"})
+		}
+
+		for _, step := range steps {
+			if _, err := pool.Exec(ctx, step); err != nil {
+				return fmt.Errorf("setting up history tables failed: %w", err)
+			}
+		}
+		if err := registerObjects(ctx, pool, objects...); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("History tables maintained for %v\n", historyTables)
+	return nil
+}
+
+// historyTask returns a task updating a random row of a random history
+// table, so the history tables fill up.
+func historyTask(ctx context.Context, pool *pgxpool.Pool, r *rand.Rand, label string, schemas []string) task {
+	return func() (outcome, error) {
+		table := historyTables[r.IntN(len(historyTables))]
+		update := historyUpdates[table]
+		args := make([]any, len(update.widths))
+		for i, width := range update.widths {
+			args[i] = GenerateRandomString(r, width)
+		}
+		tag, err := pool.Exec(ctx, label+fmt.Sprintf(update.query, qualifiedTable(pickSchema(r, schemas), table)), args...)
+		return outcome{name: table + "_update", updated: tag.RowsAffected()}, err
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+)
+
+// Lifecycle phases that hooks can be attached to.
+const (
+	PhaseCreateTables = "create_tables"
+	PhaseSeed         = "seed"
+	PhaseRun          = "run"
+)
+
+func validHookNames() []string {
+	var names []string
+	for _, phase := range []string{PhaseCreateTables, PhaseSeed, PhaseRun} {
+		names = append(names, "before_"+phase, "after_"+phase)
+	}
+	return names
+}
+
+func validateHooks(hooks map[string][]string) error {
+	valid := validHookNames()
+	for name := range hooks {
+		if !slices.Contains(valid, name) {
+			return fmt.Errorf("unknown hook '%s', must be one of %v", name, valid)
+		}
+	}
+	return nil
+}
+
+// runHooks runs the configured external commands for the given phase. The
+// first failing hook stops the chain.
+func runHooks(ctx context.Context, cfg *InserterConfig, when, phase string) error {
+	name := when + "_" + phase
+	for _, command := range cfg.Hooks[name] {
+		fmt.Printf("Running hook %s: %s\n", name, command)
+		if err := runHookCommand(ctx, cfg, name, command); err != nil {
+			return fmt.Errorf("hook %s (%s) failed: %w", name, command, err)
+		}
+	}
+	return nil
+}
+
+// shellCommand runs command through the shell of the platform.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+func runHookCommand(ctx context.Context, cfg *InserterConfig, name, command string) error {
+	cmd := shellCommand(ctx, command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"DEMODB_HOOK="+name,
+		"DEMODB_HOST="+cfg.Host,
+		"DEMODB_PORT="+cfg.Port,
+		"DEMODB_DATABASE="+cfg.Database,
+		"DEMODB_USERNAME="+cfg.Username,
+	)
+	return cmd.Run()
+}
+
+// withHooks wraps a phase with its before and after hooks. The after hooks
+// only run when the phase itself succeeded.
+func withHooks(ctx context.Context, cfg *InserterConfig, phase string, fn func() error) error {
+	if err := runHooks(ctx, cfg, "before", phase); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return runHooks(ctx, cfg, "after", phase)
+}
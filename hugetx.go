@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// hugeTxTable holds the rows written by the huge transaction.
+const hugeTxTable = "demo_db_huge_transaction"
+
+// hugeTxOperations are the operations the huge transaction can run.
+var hugeTxOperations = []string{"insert", "update"}
+
+// walToReplay returns the WAL written since the redo point of the last
+// checkpoint, which crash recovery would replay. pg_control_checkpoint
+// needs superuser or an explicit grant, so errors are left to the caller.
+func walToReplay(ctx context.Context, pool *pgxpool.Pool) (int64, error) {
+	var bytes int64
+	err := pool.QueryRow(ctx, `SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), redo_lsn)::bigint FROM pg_control_checkpoint()`).Scan(&bytes)
+	return bytes, err
+}
+
+// waitForStandbys waits until every standby replayed the WAL up to lsn and
+// prints how long each of them took after the commit.
+func waitForStandbys(ctx context.Context, pool *pgxpool.Pool, lsn string, committed time.Time, timeout time.Duration) error {
+	reported := map[string]bool{}
+	deadline := time.Now().Add(timeout)
+	for {
+		rows, err := pool.Query(ctx, `SELECT application_name || ' (' || COALESCE(client_addr::text, 'local') || ')',
+			COALESCE(replay_lsn >= $1::pg_lsn, false) FROM pg_stat_replication`, lsn)
+		if err != nil {
+			return err
+		}
+		waiting := 0
+		for rows.Next() {
+			var standby string
+			var replayed bool
+			if err := rows.Scan(&standby, &replayed); err != nil {
+				rows.Close()
+				return err
+			}
+			if !replayed {
+				waiting++
+			} else if !reported[standby] {
+				reported[standby] = true
+				fmt.Printf("  standby %s replayed the transaction %s after the commit\n", standby, time.Since(committed).Round(time.Millisecond))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if waiting == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d standbys did not replay the transaction within %s", waiting, timeout)
+		}
+		if !sleep(ctx, 250*time.Millisecond) {
+			return ctx.Err()
+		}
+	}
+}
+
+// runHugeTransaction inserts or updates huge_transaction.rows rows in one
+// transaction, committed at once, and reports the WAL it wrote, the
+// replication lag it caused and the WAL crash recovery would replay.
+func runHugeTransaction(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	settings := cfg.HugeTransaction
+	rows := settings.Rows
+	if rows <= 0 {
+		rows = 5_000_000
+	}
+	rowBytes := settings.RowBytes
+	if rowBytes <= 0 {
+		rowBytes = 100
+	}
+	batchSize := settings.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100_000
+	}
+	operation := settings.Operation
+	if operation == "" {
+		operation = "insert"
+	}
+	timeout := time.Duration(settings.CatchUpTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	table := qualifiedTable("", hugeTxTable)
+	insert := fmt.Sprintf(`INSERT INTO %s (id, payload)
+		SELECT g, left(repeat(md5(g::text), $3::int / 32 + 1), $3::int) FROM generate_series($1::bigint, $2::bigint) g`, table)
+	steps := []string{
+		"DROP TABLE IF EXISTS " + table,
+		fmt.Sprintf("CREATE TABLE %s (id BIGINT PRIMARY KEY, payload TEXT NOT NULL, updated_at TIMESTAMPTZ)", table),
+	}
+	for _, step := range steps {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return fmt.Errorf("creating %s failed: %w", hugeTxTable, err)
+		}
+	}
+	defer pool.Exec(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS "+table)
+	if operation == "update" {
+		fmt.Printf("Loading %d rows to update...\n", rows)
+		for start := 1; start <= rows; start += batchSize {
+			if _, err := pool.Exec(ctx, insert, start, min(start+batchSize-1, rows), rowBytes); err != nil {
+				return fmt.Errorf("loading %s failed: %w", hugeTxTable, err)
+			}
+		}
+	}
+	if !settings.SkipCheckpoint {
+		// Starting right after a checkpoint leaves only the transaction to
+		// replay after a crash.
+		if _, err := pool.Exec(ctx, "CHECKPOINT"); err != nil {
+			fmt.Printf("Could not run CHECKPOINT, the WAL to replay includes what was written before: %v\n", err)
+		}
+	}
+
+	var startLSN string
+	if err := pool.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&startLSN); err != nil {
+		return err
+	}
+	var standbys bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_stat_replication)").Scan(&standbys); err != nil {
+		return err
+	}
+	maxLag := int64(-1)
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		stopSampling()
+		wg.Wait()
+	}()
+	if standbys {
+		maxLag = 0
+		wg.Add(1)
+		go sampleReplicationLag(sampleCtx, pool, &maxLag, &wg)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+	fmt.Printf("Running one transaction that %ss %d rows of %d bytes in batches of %d...\n", operation, rows, rowBytes, batchSize)
+	started := time.Now()
+	for start := 1; start <= rows; start += batchSize {
+		end := min(start+batchSize-1, rows)
+		if operation == "update" {
+			_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET payload = md5(payload) || payload, updated_at = now() WHERE id BETWEEN $1 AND $2`, table), start, end)
+		} else {
+			_, err = tx.Exec(ctx, insert, start, end, rowBytes)
+		}
+		if err != nil {
+			return fmt.Errorf("%s of rows %d to %d failed: %w", operation, start, end, err)
+		}
+		fmt.Printf("  %d/%d rows, %s\n", end, rows, time.Since(started).Round(time.Millisecond))
+	}
+	written := time.Since(started)
+
+	if settings.HoldSeconds > 0 {
+		fmt.Printf("Holding the transaction open for %ds before the commit\n", settings.HoldSeconds)
+		if !sleep(ctx, time.Duration(settings.HoldSeconds)*time.Second) {
+			return ctx.Err()
+		}
+	}
+	commitStart := time.Now()
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing failed: %w", err)
+	}
+	committed := time.Now()
+
+	var commitLSN string
+	var walBytes int64
+	err = pool.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text, pg_wal_lsn_diff(pg_current_wal_lsn(), $1::pg_lsn)::bigint", startLSN).Scan(&commitLSN, &walBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Huge transaction report:")
+	fmt.Printf("  %d rows, written in %s, committed in %s\n", rows, written.Round(time.Millisecond), committed.Sub(commitStart).Round(time.Millisecond))
+	fmt.Printf("  WAL written: %s, %s per row\n", formatBytes(walBytes), formatBytes(walBytes/int64(rows)))
+	if replay, err := walToReplay(ctx, pool); err != nil {
+		fmt.Printf("  WAL crash recovery would replay: unknown, %v\n", err)
+	} else {
+		fmt.Printf("  WAL crash recovery would replay: %s\n", formatBytes(replay))
+	}
+	if !standbys {
+		fmt.Println("  no standby connected")
+		return nil
+	}
+	if err := waitForStandbys(ctx, pool, commitLSN, committed, timeout); err != nil {
+		return err
+	}
+	stopSampling()
+	wg.Wait()
+	fmt.Printf("  largest replay lag of a standby: %s\n", formatBytes(maxLag))
+	return nil
+}
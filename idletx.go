@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// idleInTransaction keeps sessions idle in transaction, like an application
+// that begins a transaction and then waits on a remote call or a user
+// before finishing it. The open transactions hold their locks and snapshot
+// meanwhile, which holds back vacuum.
+type idleInTransaction struct {
+	pool     *pgxpool.Pool
+	label    string
+	idle     time.Duration
+	insert   bool
+	rollback bool
+
+	transactions atomic.Int64
+	terminated   atomic.Int64
+}
+
+// terminatedByServer reports whether err ended the session, e.g. because
+// idle_in_transaction_session_timeout expired.
+func terminatedByServer(conn *pgx.Conn, err error) bool {
+	var pgErr *pgconn.PgError
+	return conn.IsClosed() || errors.As(err, &pgErr) && pgErr.Code == "25P03"
+}
+
+// task returns a task running one transaction on a connection of its own,
+// outside the pool, and reconnecting when the server terminated it. The
+// statements run in execCtx, while the idle time ends early when ctx is
+// done, so draining rolls the open transactions back.
+func (w *idleInTransaction) task(ctx, execCtx context.Context) task {
+	var conn *pgx.Conn
+	return func() (outcome, error) {
+		result := outcome{name: "idle_in_transaction"}
+		if conn == nil {
+			c, err := dedicatedConn(execCtx, w.pool)
+			if err != nil {
+				return result, err
+			}
+			conn = c
+		}
+
+		tx, err := conn.Begin(execCtx)
+		if err != nil {
+			return result, w.closeOnError(&conn, err)
+		}
+		if w.insert {
+			_, err = tx.Exec(execCtx, w.label+`INSERT INTO timestamp (created_at) VALUES (NOW())`)
+		} else {
+			_, err = tx.Exec(execCtx, w.label+`SELECT count(*) FROM artist`)
+		}
+		if err != nil {
+			tx.Rollback(context.Background())
+			return result, w.closeOnError(&conn, err)
+		}
+
+		if !sleep(ctx, w.idle) {
+			tx.Rollback(context.Background())
+			conn.Close(context.Background())
+			conn = nil
+			return result, nil
+		}
+		if w.rollback {
+			err = tx.Rollback(execCtx)
+		} else {
+			err = tx.Commit(execCtx)
+		}
+		if err != nil {
+			if terminatedByServer(conn, err) {
+				w.terminated.Add(1)
+				fmt.Printf("Session idle in transaction for %s was terminated by the server: %v\n", w.idle, err)
+				conn.Close(context.Background())
+				conn = nil
+				return result, nil
+			}
+			return result, w.closeOnError(&conn, err)
+		}
+
+		w.transactions.Add(1)
+		if w.insert && !w.rollback {
+			result.inserted = 1
+		} else {
+			result.read = true
+		}
+		return result, nil
+	}
+}
+
+// closeOnError drops the connection of a task when err ended its session,
+// so the next run reconnects, and returns err.
+func (w *idleInTransaction) closeOnError(conn **pgx.Conn, err error) error {
+	if terminatedByServer(*conn, err) {
+		(*conn).Close(context.Background())
+		*conn = nil
+	}
+	return err
+}
+
+// startIdleInTransaction starts the sessions of the idle in transaction
+// workload.
+func startIdleInTransaction(e *workerEngine, ctx, execCtx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, label string) *idleInTransaction {
+	settings := cfg.Inserter.IdleInTransaction
+	w := &idleInTransaction{
+		pool:     pool,
+		label:    label,
+		idle:     time.Duration(settings.IdleSeconds) * time.Second,
+		insert:   settings.Statement == "insert",
+		rollback: settings.Rollback,
+	}
+	if w.idle <= 0 {
+		w.idle = 30 * time.Second
+	}
+	end := "commit"
+	if w.rollback {
+		end = "rollback"
+	}
+	e.start(workerSpec{
+		name:        "idle_in_transaction",
+		description: fmt.Sprintf("idle in transaction session, idle for %s before %s", w.idle, end),
+		concurrency: settings.Sessions,
+		newTask:     func(int) task { return w.task(ctx, execCtx) },
+	})
+	return w
+}
+
+// report prints the transactions finished and the sessions terminated by
+// the server before they could finish theirs.
+func (w *idleInTransaction) report() {
+	fmt.Println("Idle in transaction report:")
+	fmt.Printf("  %d transactions finished, %d sessions terminated by the server\n", w.transactions.Load(), w.terminated.Load())
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// indexOnlyQuery is answered from index_only_demo_account_idx alone as long as the
+// visibility map marks the pages of the matching rows all-visible.
+const indexOnlyQuery = `SELECT count(*), sum(amount) FROM index_only_demo WHERE account_id = $1`
+
+// indexOnlyAccounts is the number of distinct account_id values.
+const indexOnlyAccounts = 10000
+
+// indexScanCounters reads the tuples read from index_only_demo_account_idx and the
+// heap fetches it needed, which index-only scans count as idx_tup_fetch.
+func indexScanCounters(ctx context.Context, pool *pgxpool.Pool) (read, fetched int64, err error) {
+	err = pool.QueryRow(ctx, `SELECT idx_tup_read, idx_tup_fetch FROM pg_stat_user_indexes
+		WHERE indexrelid = to_regclass('index_only_demo_account_idx')`).Scan(&read, &fetched)
+	return read, fetched, err
+}
+
+// runIndexOnlyDemo builds the index_only_demo table with a covering index and runs
+// readers hitting index-only scans while a writer updates random rows.
+// Updates clear the all-visible bits of their pages, so unless vacuum sets
+// them again, the scans fetch more and more rows from the heap. With
+// index_only_demo.vacuum_behind autovacuum is disabled on the table,
+// otherwise the demo vacuums it after every report.
+func runIndexOnlyDemo(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	demo := cfg.IndexOnlyDemo
+	rows := demo.Rows
+	if rows <= 0 {
+		rows = 1000000
+	}
+	duration := time.Duration(demo.DurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = 5 * time.Minute
+	}
+	interval := time.Duration(demo.ReportEveryNSeconds) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	updates := demo.UpdatesPerSecond
+	if updates <= 0 {
+		updates = 200
+	}
+
+	setup := []string{
+		`DROP TABLE IF EXISTS index_only_demo`,
+		fmt.Sprintf(`CREATE TABLE index_only_demo (
+			id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+			account_id INT NOT NULL,
+			amount NUMERIC(10,2) NOT NULL,
+			note TEXT
+		) WITH (autovacuum_enabled = %t)`, !demo.VacuumBehind),
+		fmt.Sprintf(`INSERT INTO index_only_demo (account_id, amount, note)
+			SELECT g %% %d, (g %% 10000) / 100.0, md5(g::text)
+			FROM generate_series(1, %d) AS g`, indexOnlyAccounts, rows),
+		`CREATE INDEX index_only_demo_account_idx ON index_only_demo (account_id) INCLUDE (amount)`,
+		`VACUUM (ANALYZE) index_only_demo`,
+	}
+	fmt.Printf("Creating index_only_demo table with %d rows and a covering index...\n", rows)
+	for _, query := range setup {
+		if _, err := pool.Exec(ctx, query); err != nil {
+			return fmt.Errorf("setting up index-only scan demo failed: %w", err)
+		}
+	}
+	if err := registerObjects(ctx, pool, managedObject{Kind: "table", Name: "index_only_demo"}); err != nil {
+		return err
+	}
+
+	sample := fmt.Sprintf("SELECT count(*), sum(amount) FROM index_only_demo WHERE account_id = %d", indexOnlyAccounts/2)
+	if err := printPlan(ctx, pool, "Index-only scan right after VACUUM", sample); err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	execCtx, cancelExec := statementContext(runCtx, drainTimeout(cfg))
+	defer cancelExec()
+
+	if demo.VacuumBehind {
+		fmt.Printf("\nAutovacuum is disabled on index_only_demo, updating %.0f rows/sec for %s...\n", updates, duration)
+	} else {
+		fmt.Printf("\nVacuuming index_only_demo every %s, updating %.0f rows/sec for %s...\n", interval, updates, duration)
+	}
+	stats := newRunStats()
+	stats.quiet = true
+	engine := newWorkerEngine(runCtx, stats, newRetryPolicy(cfg), nil)
+	seed := runSeed(cfg)
+	engine.start(workerSpec{
+		name:        "ios_read",
+		description: "index-only scan reader",
+		concurrency: max(demo.Readers, 1),
+		newTask: func(i int) task {
+			r := newRand(seed, fmt.Sprintf("ios-reader-%d", i+1))
+			return func() (outcome, error) {
+				_, err := pool.Exec(execCtx, indexOnlyQuery, r.IntN(indexOnlyAccounts))
+				return outcome{read: true}, err
+			}
+		},
+	})
+	engine.start(workerSpec{
+		name:        "ios_update",
+		description: "index_only_demo update worker",
+		limiter:     newRateLimiter(updates),
+		newTask: func(int) task {
+			r := newRand(seed, "ios-updater")
+			return func() (outcome, error) {
+				tag, err := pool.Exec(execCtx, `UPDATE index_only_demo SET note = md5(random()::text) WHERE id = $1`, 1+r.Int64N(int64(rows)))
+				return outcome{updated: tag.RowsAffected()}, err
+			}
+		},
+	})
+	engine.started()
+
+	lastRead, lastFetched, err := indexScanCounters(ctx, pool)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-10s %14s %14s %12s\n", "ELAPSED", "INDEX TUPLES", "HEAP FETCHES", "FETCH RATIO")
+	started := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for runCtx.Err() == nil {
+		select {
+		case <-runCtx.Done():
+			continue
+		case <-ticker.C:
+		}
+		// The statistics are flushed by the backends at most once a second.
+		read, fetched, err := indexScanCounters(ctx, pool)
+		if err != nil {
+			return err
+		}
+		ratio := 0.0
+		if read > lastRead {
+			ratio = float64(fetched-lastFetched) / float64(read-lastRead) * 100
+		}
+		fmt.Printf("%-10s %14d %14d %11.1f%%\n", time.Since(started).Round(time.Second), read-lastRead, fetched-lastFetched, ratio)
+		lastRead, lastFetched = read, fetched
+
+		if !demo.VacuumBehind {
+			if _, err := pool.Exec(execCtx, "VACUUM index_only_demo"); err != nil {
+				fmt.Println("Error vacuuming index_only_demo:", err)
+			}
+		}
+	}
+	engine.wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	title := "Index-only scan after vacuuming along"
+	if demo.VacuumBehind {
+		title = "Index-only scan with vacuum behind, see Heap Fetches"
+	}
+	return printPlan(ctx, pool, title, sample)
+}
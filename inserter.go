@@ -1,13 +1,15 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"math/rand/v2"
 	"os"
-	"os/signal"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -16,145 +18,929 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func dropTables(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
-	tables := []string{
-		"timestamp", "album", "artist", "customer", "employee",
-		"playlist", "playlist_track", "track", "genre", "media_type", "invoice", "invoice_line", "bigtable",
-	}
+var demoTables = []string{
+	"timestamp", "album", "artist", "customer", "employee",
+	"playlist", "playlist_track", "track", "genre", "media_type", "invoice", "invoice_line", "bigtable",
+}
 
-	batch := &pgx.Batch{}
+// checkTableNames returns an error for names that are not demo tables.
+func checkTableNames(tables []string) error {
 	for _, t := range tables {
-		query := fmt.Sprintf(`DROP TABLE IF EXISTS "%s" CASCADE`, t)
-		batch.Queue(query)
+		if !slices.Contains(demoTables, t) {
+			return fmt.Errorf("unknown table '%s', must be one of %v", t, demoTables)
+		}
+	}
+	return nil
+}
+
+func dropTables(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, selected []string) error {
+	if cfg.MultiTenant.Enabled && len(selected) == 0 {
+		return dropTenantSchemas(ctx, cfg, pool)
 	}
-	results := pool.SendBatch(ctx, batch)
-	defer results.Close()
 
-	for _, t := range tables {
-		_, err := results.Exec()
+	tables := demoTables
+	if len(selected) > 0 {
+		if err := checkTableNames(selected); err != nil {
+			return err
+		}
+		tables = selected
+	}
+
+	for _, schema := range workloadSchemas(cfg) {
+		batch := &pgx.Batch{}
+		for _, t := range tables {
+			query := fmt.Sprintf(`DROP TABLE IF EXISTS %s CASCADE`, qualifiedTable(schema, t))
+			batch.Queue(query)
+		}
+		results := pool.SendBatch(ctx, batch)
+
+		for _, t := range tables {
+			_, err := results.Exec()
+			if err != nil {
+				results.Close()
+				return fmt.Errorf("dropping table %s failed: %w", t, err)
+			}
+			fmt.Printf("Dropped table %s (if existed)\n", qualifiedTable(schema, t))
+		}
+		if err := results.Close(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Drop.IncludeRegisteredObjects {
+		return dropRegisteredObjects(ctx, pool)
+	}
+	return nil
+}
+
+// truncateNames returns the qualified names of the tables truncate empties
+// in every schema, the selected demo tables or all of them when none are
+// selected.
+func truncateNames(cfg *InserterConfig, selected []string) ([][]string, error) {
+	tables := demoTables
+	if len(selected) > 0 {
+		if err := checkTableNames(selected); err != nil {
+			return nil, err
+		}
+		tables = selected
+	}
+	var names [][]string
+	for _, schema := range workloadSchemas(cfg) {
+		schemaNames := make([]string, len(tables))
+		for i, t := range tables {
+			schemaNames[i] = qualifiedTable(schema, t)
+		}
+		names = append(names, schemaNames)
+	}
+	return names, nil
+}
+
+// cascadedTables returns the tables TRUNCATE ... CASCADE of the selected
+// tables empties besides them: the tables referencing them through foreign
+// keys, directly or through other tables, user tables included.
+func cascadedTables(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, selected []string) ([]string, error) {
+	names, err := truncateNames(cfg, selected)
+	if err != nil {
+		return nil, err
+	}
+	var cascaded []string
+	for _, schemaNames := range names {
+		rows, err := pool.Query(ctx, `WITH RECURSIVE truncated AS (
+				SELECT array_agg(to_regclass(n)) FILTER (WHERE to_regclass(n) IS NOT NULL) AS oids FROM unnest($1::text[]) n
+			), refs(oid) AS (
+				SELECT c.conrelid FROM pg_constraint c, truncated t WHERE c.contype = 'f' AND c.confrelid = ANY(t.oids)
+				UNION
+				SELECT c.conrelid FROM pg_constraint c JOIN refs r ON c.confrelid = r.oid WHERE c.contype = 'f'
+			)
+			SELECT r.oid::regclass::text FROM refs r, truncated t WHERE NOT r.oid = ANY(t.oids) ORDER BY 1`, schemaNames)
+		if err != nil {
+			return nil, fmt.Errorf("reading the tables referencing %s failed: %w", strings.Join(schemaNames, ", "), err)
+		}
+		tables, err := pgx.CollectRows(rows, pgx.RowTo[string])
 		if err != nil {
-			return fmt.Errorf("dropping table %s failed: %w", t, err)
+			return nil, err
 		}
-		fmt.Printf("Dropped table %s (if existed)\n", t)
+		cascaded = append(cascaded, tables...)
 	}
+	return cascaded, nil
+}
 
+// truncateTables empties the selected demo tables, all of them when none
+// are selected, and resets their identity columns. Tables referencing
+// them are emptied too, see cascadedTables. Grants and publications are
+// kept, unlike with a drop and recreate.
+func truncateTables(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, selected []string) error {
+	all, err := truncateNames(cfg, selected)
+	if err != nil {
+		return err
+	}
+	for _, names := range all {
+		if _, err := pool.Exec(ctx, fmt.Sprintf("TRUNCATE %s RESTART IDENTITY CASCADE", strings.Join(names, ", "))); err != nil {
+			return fmt.Errorf("truncating tables failed: %w", err)
+		}
+		fmt.Printf("Truncated %s\n", strings.Join(names, ", "))
+	}
 	return nil
 }
 
 const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-func GenerateRandomString(length int) string {
+// valuesPlaceholders returns the placeholder list of a multi-row VALUES
+// clause, e.g. "($1, $2), ($3, $4)" for two rows of two columns.
+func valuesPlaceholders(rows, columns int) string {
+	var b strings.Builder
+	n := 1
+	for r := range rows {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := range columns {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", n)
+			n++
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func GenerateRandomString(r *rand.Rand, length int) string {
 	result := make([]byte, length)
 	for i := range result {
-		result[i] = alphabet[rand.Uint64N(uint64(len(alphabet)))]
+		result[i] = alphabet[r.Uint64N(uint64(len(alphabet)))]
 	}
 	return string(result)
 }
 
-func startInsertWorker(wg *sync.WaitGroup, ctx context.Context, tableName string, interval time.Duration, task func() error) {
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		fmt.Printf("Starting insert worker for table %s ...\n", tableName)
+// lowEntropyWords make up the low entropy values of bigtable.
+var lowEntropyWords = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliett", "kilo", "lima", "mike", "november", "oscar", "papa"}
 
-		var numOfInserts uint64 = 0
+// bigtableValue returns a value of length characters for a column of
+// bigtable. High entropy values are random characters, low entropy ones
+// random words of a small vocabulary, which compress well while still
+// being distinct.
+func bigtableValue(r *rand.Rand, length int, lowEntropy bool) string {
+	if !lowEntropy {
+		return GenerateRandomString(r, length)
+	}
+	var b strings.Builder
+	for b.Len() < length {
+		b.WriteString(lowEntropyWords[r.IntN(len(lowEntropyWords))])
+		b.WriteByte(' ')
+	}
+	return b.String()[:length]
+}
 
-		for {
-			err := task()
-			if err != nil {
-				fmt.Printf("Error inserting into table %s: %v\n", tableName, err)
-				select {
-				case <-time.After(5 * time.Second):
-				case <-ctx.Done():
-					fmt.Printf("Shutting down worker for %s (Ctrl+C received)\n", tableName)
-					return
-				}
-			}
+// runInsert runs the insert workload configured by cfg until it is stopped
+// or drained. With reload, SIGHUP reloads the config and applies it to the
+// running workers, see configReloader.
+func runInsert(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, reload func() (*InserterConfig, error)) {
+	// Checked again here, since -inject and scenario phases add anomalies.
+	if err := checkReadOnly(cfg, "insert"); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	var wg sync.WaitGroup
 
-			numOfInserts++
-			if numOfInserts%1000 == 0 {
-				fmt.Printf("Inserted %d rows into table %s\n", numOfInserts, tableName)
-			}
+	// Stop conditions drain the run the same way SIGTERM does.
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	if cfg.Stop.DurationSeconds > 0 {
+		duration := time.Duration(cfg.Stop.DurationSeconds) * time.Second
+		timer := time.AfterFunc(duration, func() {
+			fmt.Printf("Duration of %s reached, draining...\n", duration)
+			stop(errDrain)
+		})
+		defer timer.Stop()
+	}
 
-			if interval > 0 {
-				select {
-				case <-time.After(interval):
-				case <-ctx.Done():
-					fmt.Printf("Shutting down worker for %s (Ctrl+C received)\n", tableName)
-					return
-				}
-			} else {
-				select {
-				case <-ctx.Done():
-					fmt.Printf("Shutting down worker for %s (Ctrl+C received)\n", tableName)
-					return
-				default:
-				}
-			}
+	execCtx, cancelExec := statementContext(ctx, drainTimeout(cfg))
+	defer cancelExec()
+
+	pools, err := openWorkloadPools(cfg, pool)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer pools.close()
+	if cfg.Pool.RebalanceEveryNSeconds > 0 {
+		// The rebalancers stop before the dedicated pools are closed.
+		rebalanceCtx, stopRebalancing := context.WithCancel(ctx)
+		defer stopRebalancing()
+		for name, p := range pools.dedicated {
+			startPoolRebalancer(rebalanceCtx, p, name, time.Duration(cfg.Pool.RebalanceEveryNSeconds)*time.Second)
 		}
-	}()
+	}
 
-}
+	webhook := newNotifier(cfg)
+	stats := newRunStats()
+	stats.targets = cfg.Stop.TargetRows
+	stats.errorBudget = cfg.Notifications.ErrorBudget
+	stats.onBudget = func(errors uint64) {
+		go webhook.notify(EventErrorBudgetExceeded, fmt.Sprintf("%d insert errors, budget is %d", errors, stats.errorBudget))
+	}
+	stats.readErrorBudget = cfg.Notifications.ReadErrorBudget
+	stats.onReadBudget = func(errors uint64) {
+		go webhook.notify(EventErrorBudgetExceeded, fmt.Sprintf("%d read errors, read budget is %d", errors, stats.readErrorBudget))
+	}
+	webhook.notify(EventRunStarted, fmt.Sprintf("run %s: insert workers starting", stats.runID))
 
-func runInsert(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) {
-	//todo: refactor, try db subcontext
-	var wg sync.WaitGroup
+	if cfg.Metrics.ListenAddress != "" {
+		go serveMetrics(ctx, cfg, stats, pool)
+	}
+
+	if !cfg.ReadOnly {
+		if err := recordRunStart(ctx, cfg, pool, stats, "insert"); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	store, err := newSchedulerStore(ctx, cfg, pool)
+	if err != nil {
+		fmt.Printf("Error: %v, continuing without scheduler persistence\n", err)
+	}
+
+	var sampler *activitySampler
+	if cfg.ActivitySampler.Enabled {
+		interval := time.Duration(cfg.ActivitySampler.IntervalMs) * time.Millisecond
+		if interval <= 0 {
+			interval = time.Second
+		}
+		sampler = startActivitySampler(&wg, ctx, pool, stats, interval)
+	}
+
+	var soak *soakMonitor
+	if cfg.Soak.Enabled {
+		interval := time.Duration(cfg.Soak.SampleEveryNSeconds) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		warmup := time.Duration(cfg.Soak.WarmupSeconds) * time.Second
+		if warmup <= 0 {
+			warmup = 5 * time.Minute
+		}
+		drift := cfg.Soak.DriftPercent
+		if drift <= 0 {
+			drift = 50
+		}
+		stats.quiet = true
+		soak = startSoakMonitor(&wg, ctx, pool, interval, warmup, drift)
+	}
+
+	if cfg.Progress.EveryNSeconds > 0 {
+		startProgressReporter(&wg, ctx, stats, time.Duration(cfg.Progress.EveryNSeconds)*time.Second)
+	}
+
+	var serverLog *serverLogTail
+	if cfg.ServerLog.Enabled {
+		if serverLog, err = startServerLogTail(ctx, cfg, pool); err != nil {
+			fmt.Printf("Error: %v, server log correlation disabled\n", err)
+		}
+	}
+
+	retry := newRetryPolicy(cfg)
+	seed := runSeed(cfg)
+	fmt.Printf("Using seed %d\n", seed)
+
+	engine := newWorkerEngine(ctx, stats, retry, store)
+	engine.startAfter = cfg.Inserter.StartAfter
+	engine.tables = cfg.Inserter.Tables
+	engine.workers = cfg.Inserter.Workers
+	engine.thinkTimes = cfg.Inserter.ThinkTime
+	if cfg.Control.ListenAddress != "" {
+		go serveControl(ctx, cfg.Control.ListenAddress, engine, pool)
+	}
+	if len(engine.tables) > 0 {
+		fmt.Printf("Inserting into tables %s only\n", strings.Join(engine.tables, ", "))
+	}
+	for _, name := range slices.Sorted(maps.Keys(engine.thinkTimes)) {
+		fmt.Printf("Think time of %s workers: %s\n", name, engine.thinkTimes[name])
+	}
+	schemas := workloadSchemas(cfg)
+	if len(schemas) > 1 {
+		fmt.Printf("Spreading workload across %d tenant schemas\n", len(schemas))
+	}
+	var acks *ackTracker
+	if cfg.Inserter.AcknowledgeInserts {
+		acks = newAckTracker()
+		fmt.Println("Acknowledging inserts with RETURNING")
+	}
+	columns := newColumnValues(cfg.Inserter.Cardinality, stats.runID)
+	var dirt *dirtyData
+	if cfg.Inserter.DirtyData.Enabled {
+		dirt = newDirtyData(cfg.Inserter.DirtyData.Percent, cfg.Inserter.DirtyData.Kinds)
+	}
+	var isolation *batchIsolation
+	if cfg.Inserter.IsolateBatchErrors {
+		isolation = newBatchIsolation()
+	}
+
+	// Monitoring and run bookkeeping above use the main pool, the workers
+	// below the pool of their group.
+	pool = pools.writes
+
+	if cfg.Inserter.WalSwitcher.Enabled {
+		if err := checkWalSwitchPermissions(ctx, pools.maintenance); err != nil {
+			fmt.Printf("Error: %v, WAL switcher disabled\n", err)
+		} else {
+			interval := time.Duration(cfg.Inserter.WalSwitcher.EveryNSeconds) * time.Second
+			startWalSwitcher(engine, execCtx, pools.maintenance, interval)
+		}
+	}
+
+	if cfg.Partitioning.Enabled {
+		if err := startPartitionManager(engine, execCtx, cfg, pools.maintenance, schemas); err != nil {
+			fmt.Printf("Error: %v, partitions are not managed\n", err)
+		}
+	}
 
 	if cfg.Inserter.TimestampInserts.Enabled {
 		interval := time.Duration(cfg.Inserter.TimestampInserts.EveryNSeconds) * time.Second
-		startInsertWorker(&wg, ctx, "timestamp", interval, func() error {
-			_, err := pool.Exec(ctx, `INSERT INTO "timestamp"(created_at) VALUES (NOW())`)
-			return err
+		batchSize := max(cfg.Inserter.TimestampInserts.BatchSize, 1)
+		limiter := newRateLimiter(cfg.Inserter.TimestampInserts.RatePerSecond)
+		engine.start(workerSpec{
+			name:        "timestamp",
+			description: "insert worker for table timestamp",
+			interval:    interval,
+			limiter:     limiter,
+			newTask: func(i int) task {
+				label := statementLabel(cfg, stats.runID, fmt.Sprintf("timestamp-worker-%d", i+1))
+				r := newRand(workerSeed(seed, i), "timestamp")
+				if cfg.TimescaleDB.Enabled && slices.Contains(cfg.TimescaleDB.Tables, "timestamp") {
+					// Readings of devices give compression and continuous
+					// aggregates something to work with.
+					devices := cfg.TimescaleDB.Devices
+					if devices <= 0 {
+						devices = 100
+					}
+					return batchTask(func() (int, error) {
+						args := make([]any, 0, batchSize*2)
+						for range batchSize {
+							args = append(args, 1+r.IntN(devices), r.NormFloat64()*10+20)
+						}
+						table := qualifiedTable(pickSchema(r, schemas), "timestamp")
+						return isolation.insert("timestamp", batchSize, 2, args, func(rows int, args []any) error {
+							return acks.exec(execCtx, pool, table, "id", label+fmt.Sprintf(`INSERT INTO %s(created_at, device_id, value) VALUES %s`,
+								table, strings.ReplaceAll(valuesPlaceholders(rows, 2), "(", "(NOW(), ")), args...)
+						})
+					})
+				}
+				return batchTask(func() (int, error) {
+					table := qualifiedTable(pickSchema(r, schemas), "timestamp")
+					return isolation.insert("timestamp", batchSize, 0, nil, func(rows int, _ []any) error {
+						return acks.exec(execCtx, pool, table, "id", label+fmt.Sprintf(`INSERT INTO %s(created_at) VALUES %s`,
+							table, strings.TrimSuffix(strings.Repeat("(NOW()), ", rows), ", ")))
+					})
+				})
+			},
 		})
 	}
 
 	if cfg.Inserter.BigTableInserts.Enabled {
-		startInsertWorker(&wg, ctx, "bigtable", 0, func() error {
-			randStr := GenerateRandomString(120)
-			_, err := pool.Exec(ctx, `INSERT INTO "bigtable"(cola, colb, colc, cold, cole) VALUES ($1, $2, $3, $4, $5)`,
-				randStr,
-				randStr,
-				randStr,
-				randStr,
-				randStr,
-			)
-			return err
+		batchSize := max(cfg.Inserter.BigTableInserts.BatchSize, 1)
+		lowEntropy := cfg.Inserter.BigTableInserts.Entropy == "low"
+		limiter := newRateLimiter(cfg.Inserter.BigTableInserts.RatePerSecond)
+		engine.start(workerSpec{
+			name:        "bigtable",
+			description: "insert worker for table bigtable",
+			limiter:     limiter,
+			newTask: func(i int) task {
+				label := statementLabel(cfg, stats.runID, fmt.Sprintf("bigtable-worker-%d", i+1))
+				r := newRand(workerSeed(seed, i), "bigtable")
+				return batchTask(func() (int, error) {
+					args := make([]any, 0, batchSize*5)
+					for range batchSize * 5 {
+						args = append(args, bigtableValue(r, 120, lowEntropy))
+					}
+					table := qualifiedTable(pickSchema(r, schemas), "bigtable")
+					return isolation.insert("bigtable", batchSize, 5, args, func(rows int, args []any) error {
+						return acks.exec(execCtx, pool, table, "bigtable_id", label+fmt.Sprintf(`INSERT INTO %s(cola, colb, colc, cold, cole) VALUES %s`,
+							table, valuesPlaceholders(rows, 5)), args...)
+					})
+				})
+			},
+		})
+	}
+
+	if cfg.Inserter.BulkInserts.Enabled {
+		bulk := cfg.Inserter.BulkInserts
+		for _, table := range bulk.Tables {
+			startBulkLoader(engine, execCtx, pool, schemas, seed, table, bulk.RowsPerCopy, bulk.TargetRows)
+		}
+	}
+
+	var indexes *concurrentIndexes
+	if cfg.Inserter.ConcurrentIndexes.Enabled {
+		interval := time.Duration(cfg.Inserter.ConcurrentIndexes.EveryNSeconds) * time.Second
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		indexes = startConcurrentIndexes(engine, execCtx, pools.maintenance, schemas, cfg.Inserter.ConcurrentIndexes.Tables, interval)
+	}
+
+	if cfg.Inserter.SchemaChanges.Enabled {
+		sc := cfg.Inserter.SchemaChanges
+		startSchemaChanges(&wg, ctx, execCtx, pools.maintenance, stats, schemas,
+			time.Duration(sc.AfterNSeconds)*time.Second, time.Duration(sc.LockTimeoutMs)*time.Millisecond)
+	}
+
+	if cfg.Inserter.History.Enabled {
+		if err := setupHistory(ctx, pool, schemas); err != nil {
+			fmt.Printf("Error: %v, history workload disabled\n", err)
+		} else {
+			history := cfg.Inserter.History
+			engine.start(workerSpec{
+				name:        "history",
+				description: fmt.Sprintf("update worker for history tables %v", historyTables),
+				concurrency: history.Workers,
+				limiter:     newRateLimiter(history.RatePerSecond),
+				newTask: func(i int) task {
+					worker := fmt.Sprintf("history-worker-%d", i+1)
+					return historyTask(execCtx, pool, newRand(seed, worker), statementLabel(cfg, stats.runID, worker), schemas)
+				},
+			})
+		}
+	}
+
+	if cfg.Inserter.LargePayloads.Enabled {
+		if err := setupLargePayloads(ctx, pool, schemas); err != nil {
+			fmt.Printf("Error: %v, large payloads disabled\n", err)
+		} else {
+			payloads := cfg.Inserter.LargePayloads
+			engine.start(workerSpec{
+				name: "large_payloads",
+				description: fmt.Sprintf("insert worker for %s (%s to %s %s values)", largePayloadTable,
+					formatBytes(int64(payloads.MinBytes)), formatBytes(int64(payloads.MaxBytes)), payloads.Type),
+				concurrency: payloads.Workers,
+				limiter:     newRateLimiter(payloads.RatePerSecond),
+				newTask: func(i int) task {
+					worker := fmt.Sprintf("large-payload-worker-%d", i+1)
+					return largePayloadTask(execCtx, pool, newRand(seed, worker), statementLabel(cfg, stats.runID, worker), schemas,
+						payloads.MinBytes, payloads.MaxBytes, payloads.Compressible, payloads.Type == "bytea")
+				},
+			})
+		}
+	}
+
+	var ttl *ttlWorkload
+	if cfg.Inserter.TTL.Enabled {
+		if err := setupTTL(ctx, pool, schemas); err != nil {
+			fmt.Printf("Error: %v, TTL workload disabled\n", err)
+		} else {
+			ttl = startTTLWorkload(engine, execCtx, cfg, pool, schemas, seed, statementLabel(cfg, stats.runID, "ttl-worker"))
+		}
+	}
+
+	var connChurn *connectionChurn
+	if cfg.Inserter.ConnectionChurn.Enabled {
+		connChurn = startConnectionChurn(engine, execCtx, cfg, pool, statementLabel(cfg, stats.runID, "connection-churn-worker"))
+	}
+
+	var idleTx *idleInTransaction
+	if cfg.Inserter.IdleInTransaction.Enabled {
+		idleTx = startIdleInTransaction(engine, ctx, execCtx, cfg, pool, statementLabel(cfg, stats.runID, "idle-in-transaction"))
+	}
+
+	var deadlocks *deadlockWorkload
+	if cfg.Inserter.Deadlocks.Enabled {
+		if err := setupDeadlocks(ctx, pool, max(cfg.Inserter.Deadlocks.Pairs, 1)); err != nil {
+			fmt.Printf("Error: %v, deadlock workload disabled\n", err)
+		} else {
+			deadlocks = startDeadlocks(engine, execCtx, cfg, pool, seed, statementLabel(cfg, stats.runID, "deadlock-worker"))
+		}
+	}
+
+	var prepared *preparedTransactions
+	if cfg.Inserter.PreparedTransactions.Enabled {
+		if err := setupPreparedTransactions(ctx, pool); err != nil {
+			fmt.Printf("Error: %v, prepared transaction workload disabled\n", err)
+		} else {
+			prepared = startPreparedTransactions(engine, execCtx, cfg, pool, stats.runID, seed, statementLabel(cfg, stats.runID, "prepared-transaction-worker"))
+		}
+	}
+
+	var cascade *cascadeDeletes
+	if cfg.Inserter.CascadeDeletes.Enabled {
+		if err := setupCascadeDeletes(ctx, pool, !cfg.Inserter.CascadeDeletes.UnindexedForeignKeys); err != nil {
+			fmt.Printf("Error: %v, cascading delete workload disabled\n", err)
+		} else {
+			cascade = startCascadeDeletes(engine, execCtx, cfg, pool, seed, statementLabel(cfg, stats.runID, "cascade-worker"))
+		}
+	}
+
+	var workMem *workMemStress
+	if cfg.Inserter.WorkMemStress.Enabled {
+		workMem = startWorkMemStress(engine, execCtx, cfg, pool, seed, statementLabel(cfg, stats.runID, "work-mem-worker"))
+	}
+
+	var longQueries *longQueryWorkload
+	if cfg.Inserter.LongQueries.Enabled {
+		longQueries = startLongQueries(engine, ctx, cfg, pools.reads, schemas, seed, statementLabel(cfg, stats.runID, "long-query-worker"))
+	}
+
+	if cfg.Inserter.ReadWorkload.Enabled {
+		reads := cfg.Inserter.ReadWorkload
+		rangeMinutes := reads.RangeMinutes
+		if rangeMinutes <= 0 {
+			rangeMinutes = 5
+		}
+		engine.start(workerSpec{
+			name:        "read",
+			description: fmt.Sprintf("read worker for patterns %v", reads.Patterns),
+			concurrency: reads.Workers,
+			limiter:     newRateLimiter(reads.RatePerSecond),
+			newTask: func(i int) task {
+				worker := fmt.Sprintf("read-worker-%d", i+1)
+				return readTask(execCtx, pools.reads, newRand(seed, worker), statementLabel(cfg, stats.runID, worker), schemas, reads.Patterns, rangeMinutes)
+			},
 		})
 	}
 
+	if cfg.Inserter.MixedWorkload.Enabled {
+		mixed := cfg.Inserter.MixedWorkload
+		workload := &mixedWorkload{
+			pool:         pool,
+			ids:          newIDTracker(cfg.Inserter.KeyDistribution),
+			schemas:      schemas,
+			label:        statementLabel(cfg, stats.runID, "mixed-worker"),
+			readPercent:  mixed.ReadPercent,
+			writePercent: mixed.WritePercent,
+		}
+		if cfg.Inserter.Outbox.Enabled {
+			if err := setupOutbox(ctx, pool, schemas); err != nil {
+				fmt.Printf("Error: %v, outbox disabled\n", err)
+			} else {
+				workload.outbox = true
+				startOutboxRelay(engine, execCtx, cfg, pool, schemas, statementLabel(cfg, stats.runID, "outbox-relay"))
+			}
+		}
+		if err := workload.loadIDs(ctx); err != nil {
+			fmt.Printf("Error: %v, mixed workload disabled\n", err)
+		} else {
+			engine.start(workerSpec{
+				name: "mixed",
+				description: fmt.Sprintf("mixed workload worker (read %d%%, write %d%%, update %d%%)",
+					mixed.ReadPercent, mixed.WritePercent, 100-mixed.ReadPercent-mixed.WritePercent),
+				concurrency: mixed.Workers,
+				limiter:     newRateLimiter(mixed.RatePerSecond),
+				newTask: func(i int) task {
+					r := newRand(seed, fmt.Sprintf("mixed-worker-%d", i+1))
+					return func() (outcome, error) { return workload.run(execCtx, r) }
+				},
+			})
+		}
+	}
+
+	if cfg.Inserter.Churn.Enabled {
+		startChurn(engine, execCtx, pool, schemas, seed, cfg.Inserter.Churn.Tables, cfg.Inserter.KeyDistribution)
+	}
+
+	if cfg.Inserter.TempTableChurn.Enabled {
+		churn := cfg.Inserter.TempTableChurn
+		columns := churn.Columns
+		if columns <= 0 {
+			columns = 10
+		}
+		report := time.Duration(churn.ReportEveryNSeconds) * time.Second
+		if report <= 0 {
+			report = 30 * time.Second
+		}
+		startTempTableChurn(&wg, ctx, execCtx, pool, stats, newRateLimiter(churn.RatePerSecond),
+			max(churn.Sessions, 1), columns, report)
+	}
+
+	if len(cfg.Anomalies) > 0 {
+		startAnomalies(&wg, ctx, cfg, pool, stats, webhook)
+	}
+
+	var orphans *orphanInjector
+	if cfg.Inserter.Orphans.Enabled && cfg.Inserter.MainTablesInserts.Enabled {
+		if orphans, err = newOrphanInjector(ctx, pool, schemas, cfg.Inserter.Orphans.Tables, cfg.Inserter.Orphans.Percent); err != nil {
+			fmt.Printf("Error: %v, no orphans are injected\n", err)
+		}
+	}
+
+	mainLimiter := newRateLimiter(cfg.Inserter.MainTablesInserts.RatePerSecond)
+	var mainMode *modeSwitch
 	if cfg.Inserter.MainTablesInserts.Enabled {
+		// The tasks of both modes are built, so that reloading the config
+		// can switch the mode of the running workers.
+		newTasks := map[string]map[string]func(i int) task{"realistic-data": {}, "gibberish-data": {}}
+
+		exec := func(table, key, query string, args ...any) error {
+			return acks.exec(execCtx, pool, table, key, query, args...)
+		}
+		// Every goroutine gets tasks of its own, which are not safe for
+		// concurrent use.
+		for name := range realisticTasks(exec, schemas, seed, cfg.Inserter.KeyDistribution, columns, dirt, orphans) {
+			newTasks["realistic-data"][name] = func(i int) task {
+				return insertTask(1, realisticTasks(exec, schemas, workerSeed(seed, i), cfg.Inserter.KeyDistribution, columns, dirt, orphans)[name])
+			}
+		}
+
+		ids := newIDTracker(cfg.Inserter.KeyDistribution)
+		for _, schema := range schemas {
+			for _, table := range []string{"artist", "album", "genre", "media_type", "playlist", "track"} {
+				if err := ids.load(ctx, pool, schema, table); err != nil {
+					fmt.Println("Error:", err)
+				}
+			}
+		}
+
+		batchSize := max(cfg.Inserter.MainTablesInserts.BatchSize, 1)
 		tables := map[string]int{"artist": 20, "genre": 120, "media_type": 120, "playlist": 120}
 		for name, length := range tables {
-			startInsertWorker(&wg, ctx, name, 0, func() error {
-				_, err := pool.Exec(ctx, fmt.Sprintf(`INSERT INTO "%s"(name) VALUES ($1)`, name), GenerateRandomString(length))
-				return err
+			newTasks["gibberish-data"][name] = func(i int) task {
+				label := statementLabel(cfg, stats.runID, fmt.Sprintf("%s-worker-%d", name, i+1))
+				r := newRand(workerSeed(seed, i), name)
+				return batchTask(func() (int, error) {
+					schema := pickSchema(r, schemas)
+					args := make([]any, batchSize)
+					for i := range args {
+						args[i] = columns.shape(r, name, "name", GenerateRandomString(r, length))
+					}
+					return isolation.insert(name, batchSize, 1, args, func(n int, args []any) error {
+						rows, err := pool.Query(execCtx, label+fmt.Sprintf(`INSERT INTO %s(name) VALUES %s RETURNING %s`,
+							qualifiedTable(schema, name), valuesPlaceholders(n, 1), name+"_id"), args...)
+						if err != nil {
+							return err
+						}
+						acks.add(qualifiedTable(schema, name), name+"_id", ids.addRows(schema, name, rows))
+						return rows.Err()
+					})
+				})
+			}
+		}
+
+		for name := range relationalTasks(execCtx, pool, ids, acks, columns, orphans, schemas, seed, nil) {
+			newTasks["gibberish-data"][name] = func(i int) task {
+				return insertTask(1, relationalTasks(execCtx, pool, ids, acks, columns, orphans, schemas, workerSeed(seed, i), func(table string) string {
+					return statementLabel(cfg, stats.runID, fmt.Sprintf("%s-worker-%d", table, i+1))
+				})[name])
+			}
+		}
+
+		newTasks["gibberish-data"]["employee"] = func(i int) task {
+			label := statementLabel(cfg, stats.runID, fmt.Sprintf("employee-worker-%d", i+1))
+			r := newRand(workerSeed(seed, i), "employee")
+			v := columns.of(r, "employee")
+			return batchTask(func() (int, error) {
+				args := make([]any, 0, batchSize*10)
+				for range batchSize {
+					s20, s40, s60 := GenerateRandomString(r, 20), GenerateRandomString(r, 40), GenerateRandomString(r, 60)
+					args = append(args, v("last_name", s20), v("first_name", s20), v("title", s20), v("address", s60),
+						v("city", s40), v("state", s40), v("country", s40), v("phone", s20), v("fax", s20), v("email", s60))
+				}
+				table := qualifiedTable(pickSchema(r, schemas), "employee")
+				return isolation.insert("employee", batchSize, 10, args, func(rows int, args []any) error {
+					return acks.exec(execCtx, pool, table, "employee_id", label+fmt.Sprintf(`INSERT INTO %s (last_name, first_name, title, address, city, state, country, phone, fax, email) 
+						VALUES %s`, table, valuesPlaceholders(rows, 10)),
+						args...)
+				})
 			})
 		}
 
-		startInsertWorker(&wg, ctx, "employee", 0, func() error {
-			s20, s40, s60 := GenerateRandomString(20), GenerateRandomString(40), GenerateRandomString(60)
-			_, err := pool.Exec(ctx, `INSERT INTO "employee" (last_name, first_name, title, address, city, state, country, phone, fax, email) 
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
-				s20, s20, s20, s60, s40, s40, s40, s20, s20, s60)
-			return err
-		})
+		// The realistic inserts take their ids from MAX(id), past the
+		// counters of the gibberish ones.
+		mainMode = newModeSwitch(cfg.Inserter.MainTablesInserts.Mode, func(string) { ids.resetNextIDs() })
+		names := slices.Collect(maps.Keys(newTasks["gibberish-data"]))
+		for name := range newTasks["realistic-data"] {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			engine.start(workerSpec{
+				name:        name,
+				description: "insert worker for table " + name,
+				limiter:     mainLimiter,
+				newTask: func(i int) task {
+					tasks := map[string]task{}
+					for mode, newTask := range newTasks {
+						if newTask[name] != nil {
+							tasks[mode] = newTask[name](i)
+						}
+					}
+					return mainMode.task(ctx, tasks)
+				},
+			})
+		}
+	}
 
+	engine.started()
+	// Row targets of tables no worker inserts into, because their workload is
+	// disabled or filtered out, would never be reached and keep the run going.
+	var targeted []string
+	for _, table := range slices.Sorted(maps.Keys(cfg.Stop.TargetRows)) {
+		if engine.ran(table) {
+			targeted = append(targeted, table)
+		} else {
+			fmt.Printf("Error: no worker inserts into %s in this run, ignoring its stop.target_rows\n", table)
+		}
 	}
+	if len(targeted) > 0 {
+		go func() {
+			for ctx.Err() == nil {
+				if stats.allTargetsReached(targeted) {
+					fmt.Println("All row targets reached, draining...")
+					stop(errDrain)
+					return
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(500 * time.Millisecond):
+				}
+			}
+		}()
+	}
+	if reload != nil {
+		go watchReloads(ctx, &configReloader{engine: engine, mode: mainMode, cfg: cfg}, reload)
+	}
+
+	if err := sdNotify("READY=1\nSTATUS=Insert workers running"); err != nil {
+		fmt.Println("Error notifying systemd:", err)
+	}
+	go superviseWatchdog(ctx, pool)
+
+	engine.wait()
 	wg.Wait()
+	sdNotify("STOPPING=1")
+	if errors.Is(context.Cause(ctx), errDrain) {
+		fmt.Println("Drain completed.")
+	}
 
+	if cfg.Inserter.MixedWorkload.Enabled && cfg.Inserter.Outbox.Enabled {
+		if err := printOutboxReport(context.WithoutCancel(ctx), pool, schemas); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if cfg.Inserter.LargePayloads.Enabled {
+		if err := printLargePayloadReport(context.WithoutCancel(ctx), pool, schemas); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if ttl != nil {
+		if err := ttl.report(context.WithoutCancel(ctx)); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if connChurn != nil {
+		connChurn.report()
+	}
+
+	if idleTx != nil {
+		idleTx.report()
+	}
+
+	if deadlocks != nil {
+		deadlocks.report()
+	}
+
+	if prepared != nil {
+		if err := prepared.report(context.WithoutCancel(ctx)); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if cascade != nil {
+		cascade.report()
+	}
+
+	if longQueries != nil {
+		longQueries.report()
+	}
+
+	if indexes != nil {
+		indexes.report()
+	}
+
+	if workMem != nil {
+		if err := workMem.report(context.WithoutCancel(ctx)); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if isolation != nil {
+		isolation.report()
+	}
+
+	if orphans != nil {
+		if err := orphans.report(context.WithoutCancel(ctx), pool, schemas); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if acks != nil {
+		if err := acks.verify(context.WithoutCancel(ctx), pool); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if cfg.Inserter.Churn.Enabled {
+		if err := printChurnReport(context.WithoutCancel(ctx), pool, schemas, cfg.Inserter.Churn.Tables); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	if !cfg.ReadOnly {
+		if err := recordRunEnd(context.WithoutCancel(ctx), pool, stats); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	summary := stats.summary()
+	fmt.Println(summary)
+	if report := sampler.report(); report != "" {
+		fmt.Println(report)
+	}
+	if report := soak.report(); report != "" {
+		fmt.Println(report)
+	}
+	if report, err := serverLog.report(context.WithoutCancel(ctx), pool); err != nil {
+		fmt.Println("Error:", err)
+	} else if report != "" {
+		fmt.Println(report)
+	}
+	webhook.notify(EventRunFinished, summary)
+}
+
+// recreateTables creates the schema and seeds the data, as the recreate
+// command does.
+func recreateTables(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	err := withHooks(ctx, cfg, PhaseCreateTables, func() error {
+		fsys, files, err := schemaSource(cfg)
+		if err != nil {
+			return err
+		}
+		if err := applySqlFiles(ctx, cfg, pool, fsys, files); err != nil {
+			return err
+		}
+		if err := registerSchemaObjects(ctx, cfg, pool); err != nil {
+			return err
+		}
+		if err := dropForeignKeys(ctx, cfg, pool); err != nil {
+			return err
+		}
+		if err := setupPgCron(ctx, cfg, pool); err != nil {
+			return err
+		}
+		if err := setupTimescale(ctx, cfg, pool); err != nil {
+			return err
+		}
+		return setupPartitioning(ctx, cfg, pool)
+	})
+	if err != nil {
+		return err
+	}
+	return withHooks(ctx, cfg, PhaseSeed, func() error {
+		// Schema directories seed their data themselves.
+		if cfg.SchemaDir == "" {
+			if err := applySqlFiles(ctx, cfg, pool, embeddedSqlFiles, []string{"01-insert-data.sql"}); err != nil {
+				return err
+			}
+		}
+		return analyzeTables(ctx, cfg, pool)
+	})
 }
 
 //go:embed 00-create-tables.sql 01-insert-data.sql
 var embeddedSqlFiles embed.FS
 
-func executeSqlFiles(pool *pgxpool.Pool, sqlFiles []string) error {
+// schemaSource returns the SQL files creating the schema: all *.sql files
+// of schema_dir in lexical order when set, the embedded tables otherwise.
+// The files of schema_dir may seed data as well.
+func schemaSource(cfg *InserterConfig) (fs.FS, []string, error) {
+	if cfg.SchemaDir == "" {
+		return embeddedSqlFiles, []string{"00-create-tables.sql"}, nil
+	}
+	fsys := os.DirFS(cfg.SchemaDir)
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("schema directory %s has no .sql files", cfg.SchemaDir)
+	}
+	// Glob returns the files in lexical order.
+	return fsys, files, nil
+}
+
+func executeSqlFiles(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, sqlFiles []string) error {
 	for _, file := range sqlFiles {
-		content, err := embeddedSqlFiles.ReadFile(file)
+		content, err := fs.ReadFile(fsys, file)
 		if err != nil {
 			return fmt.Errorf("error reading SQL file %s: %w", file, err)
 		}
 
-		_, err = pool.Exec(context.Background(), string(content))
+		_, err = pool.Exec(ctx, string(content))
 		if err != nil {
 			return fmt.Errorf("error executing SQL file %s: %w", file, err)
 		}
@@ -170,7 +956,30 @@ func main() {
 		return
 	}
 
-	cfg, err := loadConfig(flags.ConfigPath)
+	if isWindowsService() {
+		flags.NoPrompt = true
+		if err := runWindowsService(flags); err != nil {
+			fmt.Println("Error running as Windows service:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	run(ctx, flags)
+}
+
+func run(ctx context.Context, flags *CommandFlags) {
+	if flags.Command == "scenario" && flags.ListScenarios {
+		if err := listScenarios(); err != nil {
+			fmt.Println("Error:", err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(flags.ConfigPath, flags.ConfigFormat)
 	if err != nil {
 		fmt.Println("Error loading config:", err)
 		return
@@ -178,19 +987,85 @@ func main() {
 
 	// fmt.Println("Config loaded successfully, inserter mode:", cfg.Inserter.Mode)
 
-	dbConn, err := connectPool(cfg)
+	if flags.Seed != nil {
+		cfg.Seed = flags.Seed
+	}
+	if flags.SchemaDir != "" {
+		cfg.SchemaDir = flags.SchemaDir
+	}
+	if flags.Duration > 0 {
+		cfg.Stop.DurationSeconds = int(flags.Duration.Round(time.Second) / time.Second)
+	}
+	if flags.DumpFormat != "" {
+		cfg.Dump.Format = flags.DumpFormat
+	}
+	if flags.DumpDir != "" {
+		cfg.Dump.Directory = flags.DumpDir
+	}
+	if flags.Command == "insert" {
+		if len(flags.Tables) > 0 {
+			cfg.Inserter.Tables = flags.Tables
+		}
+		cfg.Anomalies = append(cfg.Anomalies, flags.Inject...)
+	}
+
+	if flags.ShowEffectiveConfig {
+		data, err := effectiveConfig(cfg)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if flags.PidFile != "" {
+		pid, err := acquirePidFile(flags.PidFile)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		defer pid.release()
+	}
+
+	var poolOptions []func(*pgxpool.Config)
+	if flags.Command == "insert" && flags.RecordFile != "" {
+		recorder, err := newStatementRecorder(flags.RecordFile)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer func() {
+			if err := recorder.close(); err != nil {
+				fmt.Println("Error closing record file:", err)
+			}
+		}()
+		poolOptions = append(poolOptions, recorder.attach)
+		fmt.Printf("Recording statements to %s\n", flags.RecordFile)
+		if cfg.Inserter.BulkInserts.Enabled {
+			// The tracer only sees queries, a COPY sends its rows separately.
+			fmt.Println("Warning: bulk inserts use COPY, which is not recorded, a replay will miss their rows")
+		}
+	}
+
+	if err := checkReadOnly(cfg, flags.Command); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	dbConn, err := connectPool(cfg, poolOptions...)
 	if err != nil {
 		fmt.Println("Database connection failed:", err)
 		return
 	}
 	defer dbConn.Close()
+	if cfg.Pool.RebalanceEveryNSeconds > 0 {
+		startPoolRebalancer(ctx, dbConn, "main", time.Duration(cfg.Pool.RebalanceEveryNSeconds)*time.Second)
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
-
-	switch {
-	case flags.Validate:
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	switch flags.Command {
+	case "validate":
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
 
 		if err := dbConn.Ping(ctx); err != nil {
@@ -200,19 +1075,46 @@ func main() {
 
 		fmt.Println("validation successful: config is valid and database connection established.")
 
-	case flags.Insert:
+	case "insert":
+		if err := runHooks(ctx, cfg, "before", PhaseRun); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := checkTableNames(cfg.Inserter.Tables); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
 		fmt.Println("Running insert...")
-		runInsert(ctx, cfg, dbConn)
+		runInsert(ctx, cfg, dbConn, func() (*InserterConfig, error) {
+			return loadConfig(flags.ConfigPath, flags.ConfigFormat)
+		})
+		if err := runHooks(context.Background(), cfg, "after", PhaseRun); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
 
-	case flags.DropTables:
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Are you sure you want to drop all tables? (yes/no): ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(strings.ToLower(input))
+	case "drop":
+		if err := checkDestructiveAllowed(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		selected := flags.Tables
+		if len(selected) == 0 {
+			selected = cfg.Drop.Tables
+		}
+		what := "all tables"
+		if len(selected) > 0 {
+			what = "tables " + strings.Join(selected, ", ")
+		}
 
-		if input == "yes" || input == "y" {
-			fmt.Println("Dropping all tables...")
-			if err := dropTables(ctx, cfg, dbConn); err != nil {
+		ok, err := confirm(flags, fmt.Sprintf("Are you sure you want to drop %s?", what))
+		if err != nil {
+			fmt.Println("Error: drop needs a confirmation:", err)
+			return
+		}
+		if ok {
+			fmt.Printf("Dropping %s...\n", what)
+			if err := dropTables(ctx, cfg, dbConn, selected); err != nil {
 				fmt.Println("Error while dropping tables:", err)
 				return
 			}
@@ -220,20 +1122,221 @@ func main() {
 			fmt.Println("Aborted. No rows were deleted.")
 		}
 
-	case flags.Recreate:
+	case "truncate":
+		if err := checkDestructiveAllowed(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		what := "all tables"
+		if len(flags.Tables) > 0 {
+			what = "tables " + strings.Join(flags.Tables, ", ")
+		}
+
+		cascaded, err := cascadedTables(ctx, cfg, dbConn, flags.Tables)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(cascaded) > 0 {
+			what += ", and through foreign keys referencing them " + strings.Join(cascaded, ", ")
+		}
+		ok, err := confirm(flags, fmt.Sprintf("Are you sure you want to delete all rows of %s?", what))
+		if err != nil {
+			fmt.Println("Error: truncate needs a confirmation:", err)
+			return
+		}
+		if !ok {
+			fmt.Println("Aborted. No rows were deleted.")
+			return
+		}
+		fmt.Printf("Truncating %s...\n", what)
+		if err := truncateTables(ctx, cfg, dbConn, flags.Tables); err != nil {
+			fmt.Println("Error while truncating tables:", err)
+			return
+		}
+
+	case "recreate":
+		if err := checkDestructiveAllowed(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
 		fmt.Println("Recreating all tables...")
-		if err := executeSqlFiles(dbConn, []string{"00-create-tables.sql", "01-insert-data.sql"}); err != nil {
+		if err := recreateTables(ctx, cfg, dbConn); err != nil {
 			fmt.Println("Error while recreating tables:", err)
 			return
 		}
 		fmt.Println("Recreation completed successfully.")
 
-	case flags.CreateTables:
+	case "create-tables":
 		fmt.Println("Creating tables without inserting data...")
-		if err := executeSqlFiles(dbConn, []string{"00-create-tables.sql"}); err != nil {
+		err := withHooks(ctx, cfg, PhaseCreateTables, func() error {
+			fsys, files, err := schemaSource(cfg)
+			if err != nil {
+				return err
+			}
+			if err := applySqlFiles(ctx, cfg, dbConn, fsys, files); err != nil {
+				return err
+			}
+			if err := registerSchemaObjects(ctx, cfg, dbConn); err != nil {
+				return err
+			}
+			if err := dropForeignKeys(ctx, cfg, dbConn); err != nil {
+				return err
+			}
+			if err := setupPgCron(ctx, cfg, dbConn); err != nil {
+				return err
+			}
+			if err := setupTimescale(ctx, cfg, dbConn); err != nil {
+				return err
+			}
+			return setupPartitioning(ctx, cfg, dbConn)
+		})
+		if err != nil {
 			fmt.Println("Error while creating tables:", err)
 			return
 		}
 		fmt.Println("Tables created successfully.")
+
+	case "provision-tenant-dbs":
+		if cfg.TenantDatabases.Databases == 0 {
+			fmt.Println("Error: tenant_databases.databases must be set to provision tenant databases")
+			return
+		}
+		fmt.Printf("Provisioning %d tenant databases...\n", cfg.TenantDatabases.Databases)
+		if err := provisionTenantDatabases(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while provisioning tenant databases:", err)
+			return
+		}
+		fmt.Println("Tenant databases provisioned successfully.")
+
+		if cfg.TenantDatabases.RunWorkload {
+			if err := runTenantDatabaseWorkload(ctx, cfg); err != nil {
+				fmt.Println("Error while running tenant database workload:", err)
+				return
+			}
+		}
+
+	case "skew-demo":
+		if err := runSkewDemo(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running skew demo:", err)
+			return
+		}
+
+	case "list-objects":
+		if err := listObjects(ctx, dbConn); err != nil {
+			fmt.Println("Error while listing objects:", err)
+			return
+		}
+
+	case "lock-demo":
+		if err := runLockDemo(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running lock demo:", err)
+			return
+		}
+
+	case "cleanup":
+		if err := cleanup(ctx, dbConn, flags); err != nil {
+			fmt.Println("Error while cleaning up:", err)
+			return
+		}
+
+	case "replay":
+		if err := replay(ctx, dbConn, flags.RecordFile, flags.ReplaySpeed); err != nil {
+			fmt.Println("Error while replaying:", err)
+			return
+		}
+
+	case "autotune":
+		if err := runAutotune(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while autotuning:", err)
+			return
+		}
+
+	case "clone":
+		if err := runClone(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while cloning:", err)
+			return
+		}
+
+	case "any-schema":
+		if err := runAnySchema(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while inserting:", err)
+			return
+		}
+
+	case "fdw-demo":
+		if err := runFDWDemo(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running the FDW demo:", err)
+			return
+		}
+
+	case "replication-demo":
+		if err := runReplicationDemo(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running the replication demo:", err)
+			return
+		}
+
+	case "status":
+		if err := printStatus(ctx, cfg, dbConn, flags.JSON); err != nil {
+			fmt.Println("Error while reading the table status:", err)
+			return
+		}
+
+	case "dump":
+		if err := runDump(ctx, cfg, dbConn, flags.Tables); err != nil {
+			fmt.Println("Error while dumping tables:", err)
+			return
+		}
+
+	case "delete-experiment":
+		if err := runDeleteExperiment(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running the delete experiment:", err)
+			return
+		}
+
+	case "compression-experiment":
+		if err := runCompressionExperiment(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running the compression experiment:", err)
+			return
+		}
+
+	case "huge-transaction":
+		if err := runHugeTransaction(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running the huge transaction:", err)
+			return
+		}
+
+	case "crash-recovery":
+		if err := runCrashRecovery(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running the crash recovery rehearsal:", err)
+			return
+		}
+
+	case "index-only-demo":
+		if err := runIndexOnlyDemo(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running index-only scan demo:", err)
+			return
+		}
+
+	case "isolation-demo":
+		if err := runIsolationDemo(ctx, cfg, dbConn); err != nil {
+			fmt.Println("Error while running isolation demo:", err)
+			return
+		}
+
+	case "scenario":
+		s, err := loadScenario(flags.ScenarioFile, flags.ScenarioName)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var bp *breakpoints
+		if !flags.NoBreakpoints && slices.ContainsFunc(s.Phases, func(p scenarioPhase) bool { return p.Breakpoint }) {
+			bp = newBreakpoints(ctx, flags.NoPrompt, flags.ResumeAddress)
+		}
+		if err := runScenario(ctx, cfg, dbConn, s, bp); err != nil {
+			fmt.Println("Error while running scenario:", err)
+			return
+		}
 	}
 }
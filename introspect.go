@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type tableColumn struct {
+	name, typ, typName string
+	typmod             int32
+	notNull            bool
+	// hasDefault is set for columns with a default or identity, which
+	// inserts can leave out.
+	hasDefault bool
+	// check holds the understood CHECK constraints of the column.
+	check *valueCheck
+}
+
+type foreignKey struct {
+	name                string
+	columns, refColumns []string
+	refTable            string
+	actions             string
+}
+
+// tableInfo is the structure of a table, without its data.
+type tableInfo struct {
+	name        string
+	rows        int64
+	columns     []tableColumn
+	keys        []string
+	keyDefs     []string
+	foreignKeys []foreignKey
+	indexes     []string
+	checks      []checkConstraint
+}
+
+// rowIndexKey returns the column of a single column integer primary key,
+// which the clone fills with the row number so foreign keys can reference
+// it without looking up generated rows.
+func (t *tableInfo) rowIndexKey() string {
+	if len(t.keys) != 1 {
+		return ""
+	}
+	for _, c := range t.columns {
+		if c.name == t.keys[0] && isIntegerType(c.typName) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+func isIntegerType(typName string) bool {
+	return typName == "int2" || typName == "int4" || typName == "int8"
+}
+
+// introspectSchema reads the tables of schema with their columns,
+// constraints, indexes and estimated row counts. Index definitions are
+// rewritten to create the index in targetSchema.
+func introspectSchema(ctx context.Context, pool *pgxpool.Pool, schema, targetSchema string) ([]*tableInfo, error) {
+	rows, err := pool.Query(ctx, `SELECT c.oid, c.relname, c.reltuples::bigint FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind = 'r' AND NOT c.relispartition
+		ORDER BY c.relname`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("listing tables of schema %s failed: %w", schema, err)
+	}
+	type relation struct {
+		oid  uint32
+		name string
+		rows int64
+	}
+	relations, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (relation, error) {
+		var r relation
+		err := row.Scan(&r.oid, &r.name, &r.rows)
+		return r, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing tables of schema %s failed: %w", schema, err)
+	}
+
+	tables := make([]*tableInfo, 0, len(relations))
+	for _, rel := range relations {
+		t := &tableInfo{name: rel.name, rows: rel.rows}
+		if t.rows < 0 {
+			// Never analyzed, count instead of estimating.
+			if err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT count(*) FROM %s`, qualifiedTable(schema, rel.name))).Scan(&t.rows); err != nil {
+				return nil, fmt.Errorf("counting rows of %s failed: %w", rel.name, err)
+			}
+		}
+
+		rows, err := pool.Query(ctx, `SELECT a.attname, format_type(a.atttypid, a.atttypmod), t.typname, a.atttypmod, a.attnotnull,
+				a.atthasdef OR a.attidentity <> ''
+			FROM pg_attribute a JOIN pg_type t ON t.oid = a.atttypid
+			WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+			ORDER BY a.attnum`, rel.oid)
+		if err != nil {
+			return nil, fmt.Errorf("reading columns of %s failed: %w", rel.name, err)
+		}
+		t.columns, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (tableColumn, error) {
+			var c tableColumn
+			err := row.Scan(&c.name, &c.typ, &c.typName, &c.typmod, &c.notNull, &c.hasDefault)
+			return c, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading columns of %s failed: %w", rel.name, err)
+		}
+
+		rows, err = pool.Query(ctx, `SELECT con.conname, con.contype::text, pg_get_constraintdef(con.oid),
+				COALESCE(ref.relname, ''), COALESCE(refns.nspname, ''),
+				ARRAY(SELECT a.attname::text FROM unnest(con.conkey) WITH ORDINALITY k(n, i)
+					JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.n ORDER BY k.i),
+				ARRAY(SELECT a.attname::text FROM unnest(con.confkey) WITH ORDINALITY k(n, i)
+					JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.n ORDER BY k.i)
+			FROM pg_constraint con
+			LEFT JOIN pg_class ref ON ref.oid = con.confrelid
+			LEFT JOIN pg_namespace refns ON refns.oid = ref.relnamespace
+			WHERE con.conrelid = $1 AND con.contype IN ('p', 'u', 'f', 'c')
+			ORDER BY con.contype DESC, con.conname`, rel.oid)
+		if err != nil {
+			return nil, fmt.Errorf("reading constraints of %s failed: %w", rel.name, err)
+		}
+		var name, kind, def, refTable, refSchema string
+		var columns, refColumns []string
+		_, err = pgx.ForEachRow(rows, []any{&name, &kind, &def, &refTable, &refSchema, &columns, &refColumns}, func() error {
+			switch kind {
+			case "p":
+				t.keys = slices.Clone(columns)
+				t.keyDefs = append(t.keyDefs, def)
+			case "u":
+				t.keyDefs = append(t.keyDefs, def)
+			case "f":
+				actions := ""
+				if i := strings.Index(def, "REFERENCES"); i >= 0 {
+					if j := strings.Index(def[i:], ")"); j >= 0 {
+						actions = def[i+j+1:]
+					}
+				}
+				if refSchema != schema {
+					refTable = refSchema + "." + refTable
+				}
+				t.foreignKeys = append(t.foreignKeys, foreignKey{
+					name: name, columns: slices.Clone(columns), refColumns: slices.Clone(refColumns), refTable: refTable, actions: actions,
+				})
+			case "c":
+				check := checkConstraint{name: name, def: def}
+				if i := slices.IndexFunc(t.columns, func(c tableColumn) bool { return len(columns) == 1 && c.name == columns[0] }); i >= 0 {
+					var parsed valueCheck
+					if t.columns[i].check != nil {
+						parsed = *t.columns[i].check
+					}
+					if check.parsed = parseCheck(def, columns[0], &parsed); check.parsed {
+						t.columns[i].check = &parsed
+					}
+				}
+				t.checks = append(t.checks, check)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading constraints of %s failed: %w", rel.name, err)
+		}
+
+		rows, err = pool.Query(ctx, `SELECT replace(pg_get_indexdef(i.indexrelid), ' ON ' || quote_ident($2) || '.', ' ON ' || quote_ident($3) || '.')
+			FROM pg_index i
+			WHERE i.indrelid = $1 AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid)`,
+			rel.oid, schema, targetSchema)
+		if err != nil {
+			return nil, fmt.Errorf("reading indexes of %s failed: %w", rel.name, err)
+		}
+		if t.indexes, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			return nil, fmt.Errorf("reading indexes of %s failed: %w", rel.name, err)
+		}
+
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// referenceOrder sorts tables so referenced tables come before the tables
+// referencing them. Reference cycles are broken at an arbitrary table.
+func referenceOrder(tables []*tableInfo) []*tableInfo {
+	byName := map[string]*tableInfo{}
+	for _, t := range tables {
+		byName[t.name] = t
+	}
+
+	ordered := make([]*tableInfo, 0, len(tables))
+	state := map[string]int{}
+	var visit func(t *tableInfo)
+	visit = func(t *tableInfo) {
+		if state[t.name] != 0 {
+			return
+		}
+		state[t.name] = 1
+		for _, fk := range t.foreignKeys {
+			if parent, ok := byName[fk.refTable]; ok && parent != t {
+				visit(parent)
+			}
+		}
+		state[t.name] = 2
+		ordered = append(ordered, t)
+	}
+	for _, t := range tables {
+		visit(t)
+	}
+	return ordered
+}
+
+// unique reports whether column alone is the primary key or has a unique
+// constraint.
+func (t *tableInfo) unique(column string) bool {
+	for _, def := range t.keyDefs {
+		if strings.HasSuffix(def, "("+pgx.Identifier{column}.Sanitize()+")") || strings.HasSuffix(def, "("+column+")") {
+			return true
+		}
+	}
+	return false
+}
+
+// valueExpr returns the SQL expression generating random values of the
+// type of c satisfying its understood CHECK constraints, or an empty string
+// for unsupported types of NOT NULL columns.
+// Values of unique columns are derived from seq, an expression that is
+// distinct for every generated row.
+func valueExpr(c tableColumn, unique bool, seq string) string {
+	if c.check != nil {
+		if expr := checkedValueExpr(c, c.check); expr != "" {
+			return expr
+		}
+	}
+	switch c.typName {
+	case "int2", "int4", "int8":
+		if unique {
+			return "(" + seq + ")::" + c.typ
+		}
+		if c.typName == "int2" {
+			return "floor(random() * 32767)::int2"
+		}
+		return "floor(random() * 1000000)::" + c.typ
+	case "numeric":
+		if c.typmod > 4 {
+			precision, scale := ((c.typmod-4)>>16)&0xffff, (c.typmod-4)&0xffff
+			return fmt.Sprintf("trunc((random() * 1e%d)::numeric, %d)::%s", precision-scale, scale, c.typ)
+		}
+		return "round((random() * 1000)::numeric, 2)"
+	case "float4", "float8":
+		return "(random() * 1000)::" + c.typ
+	case "text", "varchar", "bpchar", "name", "citext":
+		value := "md5(random()::text)"
+		if unique {
+			value = "(" + seq + ") || '-' || " + value
+		}
+		if c.typmod > 4 && c.typName != "text" {
+			value = fmt.Sprintf("left(%s, %d)", value, c.typmod-4)
+		}
+		return value + "::" + c.typ
+	case "bool":
+		return "random() < 0.5"
+	case "date", "timestamp", "timestamptz", "time", "timetz":
+		return "(now() - random() * interval '3650 days')::" + c.typ
+	case "interval":
+		return "random() * interval '30 days'"
+	case "uuid":
+		return "md5((" + seq + ") || random()::text)::uuid"
+	case "json", "jsonb":
+		return "json_build_object('value', md5(random()::text))::" + c.typ
+	case "bytea":
+		return "decode(md5(random()::text), 'hex')"
+	}
+	if !c.notNull {
+		return "NULL"
+	}
+	return ""
+}
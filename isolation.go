@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// isolationAnomalies are the anomalies reproduced by the isolation demo.
+var isolationAnomalies = []string{"lost_update", "non_repeatable_read"}
+
+// isolationBalance is the balance of the demo account at the start of every
+// round.
+const isolationBalance = 100
+
+// resetIsolationAccount sets the demo account back to its initial balance.
+func resetIsolationAccount(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `INSERT INTO isolation_demo (id, balance) VALUES (1, $1)
+		ON CONFLICT (id) DO UPDATE SET balance = EXCLUDED.balance`, isolationBalance)
+	return err
+}
+
+// lostUpdate runs two read committed transactions that read the balance,
+// add to it in the application and write it back, and reports whether the
+// first write was lost. With lock the reads use SELECT FOR UPDATE, so the
+// second transaction waits for the first to commit and reads its result.
+func lostUpdate(ctx context.Context, pool *pgxpool.Pool, a, b *pgxpool.Conn, lock bool) (bool, error) {
+	if err := resetIsolationAccount(ctx, pool); err != nil {
+		return false, err
+	}
+	query := `SELECT balance FROM isolation_demo WHERE id = 1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	txA, err := a.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return false, err
+	}
+	defer txA.Rollback(context.Background())
+	txB, err := b.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return false, err
+	}
+	defer txB.Rollback(context.Background())
+
+	var balanceA, balanceB int
+	if err := txA.QueryRow(ctx, query).Scan(&balanceA); err != nil {
+		return false, err
+	}
+	fmt.Printf("  [A] %s -> balance=%d, will add 10\n", query, balanceA)
+
+	readB := make(chan error, 1)
+	go func() { readB <- txB.QueryRow(ctx, query).Scan(&balanceB) }()
+	if lock {
+		// Give the read of B time to queue behind the row lock of A.
+		fmt.Printf("  [B] %s -> waiting for the row lock of A\n", query)
+		if !sleep(ctx, 200*time.Millisecond) {
+			return false, ctx.Err()
+		}
+	} else {
+		if err := <-readB; err != nil {
+			return false, err
+		}
+		fmt.Printf("  [B] %s -> balance=%d, will add 20\n", query, balanceB)
+	}
+
+	if _, err := txA.Exec(ctx, `UPDATE isolation_demo SET balance = $1 WHERE id = 1`, balanceA+10); err != nil {
+		return false, err
+	}
+	if err := txA.Commit(ctx); err != nil {
+		return false, err
+	}
+	fmt.Printf("  [A] UPDATE balance=%d, committed\n", balanceA+10)
+
+	if lock {
+		if err := <-readB; err != nil {
+			return false, err
+		}
+		fmt.Printf("  [B] read balance=%d once A committed, will add 20\n", balanceB)
+	}
+	if _, err := txB.Exec(ctx, `UPDATE isolation_demo SET balance = $1 WHERE id = 1`, balanceB+20); err != nil {
+		return false, err
+	}
+	if err := txB.Commit(ctx); err != nil {
+		return false, err
+	}
+	fmt.Printf("  [B] UPDATE balance=%d, committed\n", balanceB+20)
+
+	var final int
+	if err := pool.QueryRow(ctx, `SELECT balance FROM isolation_demo WHERE id = 1`).Scan(&final); err != nil {
+		return false, err
+	}
+	expected := isolationBalance + 10 + 20
+	if final != expected {
+		fmt.Printf("  Final balance=%d, expected %d: the update of A was lost\n", final, expected)
+		return true, nil
+	}
+	fmt.Printf("  Final balance=%d as expected\n", final)
+	return false, nil
+}
+
+// nonRepeatableRead reads the balance twice in one transaction of the given
+// isolation level while another session updates it in between, and reports
+// whether the two reads differ.
+func nonRepeatableRead(ctx context.Context, pool *pgxpool.Pool, a, b *pgxpool.Conn, level pgx.TxIsoLevel) (bool, error) {
+	if err := resetIsolationAccount(ctx, pool); err != nil {
+		return false, err
+	}
+	const query = `SELECT balance FROM isolation_demo WHERE id = 1`
+
+	txA, err := a.BeginTx(ctx, pgx.TxOptions{IsoLevel: level})
+	if err != nil {
+		return false, err
+	}
+	defer txA.Rollback(context.Background())
+
+	var first, second int
+	if err := txA.QueryRow(ctx, query).Scan(&first); err != nil {
+		return false, err
+	}
+	fmt.Printf("  [A] %s -> balance=%d\n", query, first)
+
+	if _, err := b.Exec(ctx, `UPDATE isolation_demo SET balance = balance + 50 WHERE id = 1`); err != nil {
+		return false, err
+	}
+	fmt.Printf("  [B] UPDATE balance = balance + 50, committed\n")
+
+	if err := txA.QueryRow(ctx, query).Scan(&second); err != nil {
+		return false, err
+	}
+	fmt.Printf("  [A] %s -> balance=%d\n", query, second)
+	if err := txA.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	if first != second {
+		fmt.Printf("  The same query in the same transaction returned %d, then %d\n", first, second)
+		return true, nil
+	}
+	fmt.Printf("  Both reads returned %d\n", first)
+	return false, nil
+}
+
+// runIsolationDemo reproduces the anomalies allowed by read committed, the
+// default isolation level, with two sessions A and B whose statements are
+// interleaved in a fixed order, so every round shows the anomaly. Each
+// anomaly is then repeated with its fix: SELECT FOR UPDATE for the lost
+// update and repeatable read for the non-repeatable read.
+func runIsolationDemo(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	demo := cfg.IsolationDemo
+	rounds := max(demo.Rounds, 1)
+	anomalies := demo.Anomalies
+	if len(anomalies) == 0 {
+		anomalies = isolationAnomalies
+	}
+
+	setup := []string{
+		`DROP TABLE IF EXISTS isolation_demo`,
+		`CREATE TABLE isolation_demo (id INT PRIMARY KEY, balance INT NOT NULL)`,
+	}
+	for _, step := range setup {
+		if _, err := pool.Exec(ctx, step); err != nil {
+			return fmt.Errorf("creating isolation_demo failed: %w", err)
+		}
+	}
+
+	a, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Release()
+	b, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer b.Release()
+
+	type variant struct {
+		title string
+		run   func() (bool, error)
+	}
+	var summary []string
+	for _, anomaly := range anomalies {
+		var variants []variant
+		switch anomaly {
+		case "lost_update":
+			variants = []variant{
+				{"lost update, read committed with plain SELECT", func() (bool, error) { return lostUpdate(ctx, pool, a, b, false) }},
+				{"lost update, read committed with SELECT FOR UPDATE", func() (bool, error) { return lostUpdate(ctx, pool, a, b, true) }},
+			}
+		case "non_repeatable_read":
+			variants = []variant{
+				{"non-repeatable read, read committed", func() (bool, error) { return nonRepeatableRead(ctx, pool, a, b, pgx.ReadCommitted) }},
+				{"non-repeatable read, repeatable read", func() (bool, error) { return nonRepeatableRead(ctx, pool, a, b, pgx.RepeatableRead) }},
+			}
+		}
+
+		for _, v := range variants {
+			reproduced := 0
+			for round := 1; round <= rounds; round++ {
+				fmt.Printf("\n=== %s, round %d/%d ===\n", v.title, round, rounds)
+				ok, err := v.run()
+				if err != nil {
+					return fmt.Errorf("%s failed: %w", v.title, err)
+				}
+				if ok {
+					reproduced++
+				}
+			}
+			summary = append(summary, fmt.Sprintf("  %-52s anomaly in %d of %d rounds", v.title, reproduced, rounds))
+		}
+	}
+
+	fmt.Println("\nIsolation demo summary:")
+	for _, line := range summary {
+		fmt.Println(line)
+	}
+	return nil
+}
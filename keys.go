@@ -0,0 +1,88 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+)
+
+// keyDistributionTypes are the distributions of the keys picked for foreign
+// key references and update targets.
+var keyDistributionTypes = []string{"uniform", "zipfian", "hotspot"}
+
+// keyDistribution selects keys unevenly, so that a few hot rows, e.g. the
+// popular artists, receive most of the traffic as in real applications.
+// Hot keys are the lowest ids of a table, or the first ids known to a
+// worker when it references ids it tracks itself.
+type keyDistribution struct {
+	Type string `json:"type"`
+	// ZipfExponent skews the zipfian distribution, the higher the hotter
+	// the first keys. It must be greater than 1, default 1.1.
+	ZipfExponent float64 `json:"zipf_exponent"`
+	// HotKeysPercent of the keys receive HotTrafficPercent of the picks in
+	// the hotspot distribution, default 10 and 90.
+	HotKeysPercent    float64 `json:"hot_keys_percent"`
+	HotTrafficPercent float64 `json:"hot_traffic_percent"`
+}
+
+func (d keyDistribution) validate() error {
+	if d.Type != "" && !slices.Contains(keyDistributionTypes, d.Type) {
+		return fmt.Errorf("invalid type '%s', must be one of %v", d.Type, keyDistributionTypes)
+	}
+	if d.ZipfExponent != 0 && d.ZipfExponent <= 1 {
+		return fmt.Errorf("zipf_exponent must be greater than 1")
+	}
+	for _, percent := range []float64{d.HotKeysPercent, d.HotTrafficPercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("hot_keys_percent and hot_traffic_percent must be between 0 and 100")
+		}
+	}
+	return nil
+}
+
+// zipfExponent returns the exponent of the zipfian distribution.
+func (d keyDistribution) zipfExponent() float64 {
+	return cmp.Or(d.ZipfExponent, 1.1)
+}
+
+// hotspot returns the position of the next key of the hotspot distribution
+// in the ordered keys of a table, between 0 and 1.
+func (d keyDistribution) hotspot(r *rand.Rand) float64 {
+	hot := cmp.Or(d.HotKeysPercent, 10) / 100
+	if r.Float64() < cmp.Or(d.HotTrafficPercent, 90)/100 {
+		return r.Float64() * hot
+	}
+	return hot + r.Float64()*(1-hot)
+}
+
+// index returns the index of the next key of n keys.
+func (d keyDistribution) index(r *rand.Rand, n int) int {
+	switch d.Type {
+	case "zipfian":
+		if n == 1 {
+			return 0
+		}
+		return int(rand.NewZipf(r, d.zipfExponent(), 1, uint64(n-1)).Uint64())
+	case "hotspot":
+		return min(int(d.hotspot(r)*float64(n)), n-1)
+	}
+	return r.IntN(n)
+}
+
+// sqlFraction returns an SQL expression for the position of the next key
+// among n keys, n being an SQL expression too, between 0 and 1. The
+// fraction is drawn from r rather than random() on the server, so a seed
+// reproduces the picks. Zipfian picks invert the distribution function of a
+// continuous zipfian over the n keys.
+func (d keyDistribution) sqlFraction(r *rand.Rand, n string) string {
+	switch d.Type {
+	case "zipfian":
+		return fmt.Sprintf("((power(1 + %s * (power(%[2]s, %[3]s) - 1), 1 / %[3]s) - 1) / %[2]s)",
+			strconv.FormatFloat(r.Float64(), 'f', 9, 64), n, strconv.FormatFloat(1-d.zipfExponent(), 'f', 6, 64))
+	case "hotspot":
+		return strconv.FormatFloat(d.hotspot(r), 'f', 9, 64)
+	}
+	return strconv.FormatFloat(r.Float64(), 'f', 9, 64)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// newRunID returns a short random identifier for a run of the tool.
+func newRunID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statementLabel returns the comment prepended to statements of a worker,
+// e.g. "/* demo-db:bigtable-worker-1 run=3f2a9c01bd44 */ ", so that
+// pg_stat_statements and the server log can attribute load to workers and
+// runs. It returns an empty string when labels are disabled.
+func statementLabel(cfg *InserterConfig, runID, worker string) string {
+	if !cfg.StatementLabels {
+		return ""
+	}
+	return fmt.Sprintf("/* demo-db:%s run=%s */ ", worker, runID)
+}
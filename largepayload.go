@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// largePayloadTable receives the rows of the large payload inserter, whose
+// values are stored out of line in its TOAST table.
+const largePayloadTable = "demo_db_large_payloads"
+
+// maxPayloadBytes caps the size of a generated value, well below the 1 GB
+// limit of a field, since every value is built in memory first.
+const maxPayloadBytes = 256 << 20
+
+// setupLargePayloads creates the large payload table. A value is written to
+// payload_text or payload_bytea depending on inserter.large_payloads.type.
+func setupLargePayloads(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	for _, schema := range schemas {
+		_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			payload_text TEXT,
+			payload_bytea BYTEA,
+			payload_bytes INT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`, qualifiedTable(schema, largePayloadTable)))
+		if err != nil {
+			return fmt.Errorf("creating large payload table failed: %w", err)
+		}
+		if err := registerObjects(ctx, pool, managedObject{Kind: "table", Schema: schema, Name: largePayloadTable}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// largePayload returns a value of size bytes. Compressible values repeat a
+// short random string, which pglz and lz4 shrink to almost nothing; the
+// others are random, which TOAST stores at full size.
+func largePayload(r *rand.Rand, size int, compressible, binary bool) any {
+	if compressible {
+		value := strings.Repeat(GenerateRandomString(r, 64), size/64+1)[:size]
+		if binary {
+			return []byte(value)
+		}
+		return value
+	}
+	if binary {
+		value := make([]byte, size)
+		for i := 0; i < size; i += 8 {
+			n := r.Uint64()
+			for j := i; j < min(i+8, size); j++ {
+				value[j] = byte(n)
+				n >>= 8
+			}
+		}
+		return value
+	}
+	return GenerateRandomString(r, size)
+}
+
+// largePayloadTask returns a task inserting one row with a value between
+// minBytes and maxBytes.
+func largePayloadTask(ctx context.Context, pool *pgxpool.Pool, r *rand.Rand, label string, schemas []string, minBytes, maxBytes int, compressible, binary bool) task {
+	column := "payload_text"
+	if binary {
+		column = "payload_bytea"
+	}
+	return insertTask(1, func() error {
+		size := minBytes + r.IntN(maxBytes-minBytes+1)
+		_, err := pool.Exec(ctx, label+fmt.Sprintf(`INSERT INTO %s (%s, payload_bytes) VALUES ($1, $2)`,
+			qualifiedTable(pickSchema(r, schemas), largePayloadTable), column), largePayload(r, size, compressible, binary), size)
+		return err
+	})
+}
+
+// printLargePayloadReport prints the rows, the size of the values and the
+// space taken by the heap and the TOAST table of the large payload table.
+func printLargePayloadReport(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	fmt.Println("Large payload report:")
+	for _, schema := range schemas {
+		table := qualifiedTable(schema, largePayloadTable)
+		var rows, payloadBytes, heapBytes, toastBytes int64
+		err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT count(*), COALESCE(sum(payload_bytes), 0)::bigint,
+				pg_relation_size($1::regclass),
+				COALESCE((SELECT pg_total_relation_size(reltoastrelid) FROM pg_class WHERE oid = $1::regclass AND reltoastrelid <> 0), 0)
+			FROM %s`, table), table).Scan(&rows, &payloadBytes, &heapBytes, &toastBytes)
+		if err != nil {
+			return fmt.Errorf("reading the size of %s failed: %w", table, err)
+		}
+		fmt.Printf("  %-30s rows=%d payload=%s heap=%s toast=%s\n", table, rows,
+			formatBytes(payloadBytes), formatBytes(heapBytes), formatBytes(toastBytes))
+	}
+	return nil
+}
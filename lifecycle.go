@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errDrain is the cancellation cause of a graceful drain. Workers stop
+// taking new work, but statements already in flight may still complete.
+var errDrain = errors.New("drain requested")
+
+var (
+	aborted   = make(chan struct{})
+	abortOnce sync.Once
+)
+
+func abort() {
+	abortOnce.Do(func() { close(aborted) })
+}
+
+// signalContext returns a context that is cancelled on SIGTERM with errDrain
+// as the cause, or immediately aborted on Ctrl+C. A Ctrl+C during a drain
+// aborts the statements that are still running.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for sig := range sigs {
+			if sig == syscall.SIGTERM && ctx.Err() == nil {
+				fmt.Println("Drain requested, waiting for in-flight statements to complete...")
+				cancel(errDrain)
+				continue
+			}
+			fmt.Println("Aborting...")
+			abort()
+			cancel(context.Canceled)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel(nil)
+	}
+}
+
+// statementContext returns the context statements run with. It outlives ctx
+// by up to timeout when ctx was cancelled by a drain, and is cancelled
+// together with ctx otherwise.
+func statementContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	stmtCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stmtCtx.Done():
+			return
+		}
+		if errors.Is(context.Cause(ctx), errDrain) {
+			select {
+			case <-time.After(timeout):
+				fmt.Println("Drain timeout reached, cancelling in-flight statements")
+			case <-aborted:
+			case <-stmtCtx.Done():
+			}
+		}
+		cancel()
+	}()
+
+	return stmtCtx, cancel
+}
+
+func drainTimeout(cfg *InserterConfig) time.Duration {
+	if cfg.DrainTimeoutSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(cfg.DrainTimeoutSeconds) * time.Second
+}
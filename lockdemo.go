@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runLockDemo shows why migrations need lock_timeout: one session holds a
+// row lock on artist, while another repeatedly tries to ALTER the table.
+// Without a timeout the waiting ALTER would queue every other query on the
+// table behind it, which is measured with a concurrent SELECT.
+func runLockDemo(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	hold := time.Duration(cfg.LockDemo.HoldSeconds) * time.Second
+	if hold <= 0 {
+		hold = 10 * time.Second
+	}
+	lockTimeout := time.Duration(cfg.LockDemo.LockTimeoutMs) * time.Millisecond
+	if lockTimeout <= 0 {
+		lockTimeout = 2 * time.Second
+	}
+	attempts := max(cfg.LockDemo.Attempts, 1)
+
+	holder, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer holder.Release()
+
+	ddl, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer ddl.Release()
+
+	tx, err := holder.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `SELECT artist_id FROM artist ORDER BY artist_id LIMIT 1 FOR UPDATE`); err != nil {
+		tx.Rollback(context.Background())
+		return fmt.Errorf("locking artist row failed: %w", err)
+	}
+	fmt.Printf("[holder] Locked an artist row, holding the transaction open for %s\n", hold)
+	released := time.Now().Add(hold)
+	// From here on only the holder goroutine ends the transaction. Returning
+	// stops it and waits for it, so the connection is not used concurrently
+	// and not released while in use.
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-time.After(hold):
+		case <-ctx.Done():
+		case <-stop:
+			tx.Rollback(context.Background())
+			fmt.Println("[holder] Rolled back, row lock released")
+			return
+		}
+		tx.Commit(context.Background())
+		fmt.Println("[holder] Committed, row lock released")
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	if _, err := ddl.Exec(ctx, fmt.Sprintf("SET lock_timeout = %d", lockTimeout.Milliseconds())); err != nil {
+		return err
+	}
+	defer ddl.Exec(context.Background(), "RESET lock_timeout")
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt == attempts && time.Now().Before(released) {
+			fmt.Printf("[ddl] Waiting for the holder to finish before the last attempt\n")
+			select {
+			case <-time.After(time.Until(released) + 100*time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		blocked := make(chan time.Duration, 1)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			start := time.Now()
+			pool.Exec(ctx, `SELECT count(*) FROM artist`)
+			blocked <- time.Since(start)
+		}()
+
+		start := time.Now()
+		_, err := ddl.Exec(ctx, `ALTER TABLE artist ADD COLUMN IF NOT EXISTS demo_db_lock_demo INT`)
+		waited := time.Since(start)
+
+		var pgErr *pgconn.PgError
+		switch {
+		case err == nil:
+			fmt.Printf("[ddl] Attempt %d: ALTER TABLE succeeded after waiting %s\n", attempt, waited.Round(time.Millisecond))
+		case errors.As(err, &pgErr) && pgErr.Code == "55P03":
+			fmt.Printf("[ddl] Attempt %d: gave up after %s (lock_timeout), other queries are no longer blocked\n", attempt, waited.Round(time.Millisecond))
+		default:
+			return fmt.Errorf("ALTER TABLE failed: %w", err)
+		}
+		fmt.Printf("[reader] SELECT on artist queued behind the ALTER for %s\n", (<-blocked).Round(time.Millisecond))
+
+		if err == nil {
+			break
+		}
+	}
+
+	if _, err := pool.Exec(ctx, `ALTER TABLE artist DROP COLUMN IF EXISTS demo_db_lock_demo`); err != nil {
+		return fmt.Errorf("cleaning up lock demo column failed: %w", err)
+	}
+	return nil
+}
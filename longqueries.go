@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// longQueryWorkload runs slow queries, a pause of pg_sleep followed by a
+// sequential scan of bigtable, like a report or a forgotten ad hoc query.
+// They give statement_timeout, query kill tooling and slow query alerts
+// something to act on, and the report tells how the queries ended.
+type longQueryWorkload struct {
+	pool     *pgxpool.Pool
+	label    string
+	schemas  []string
+	duration time.Duration
+
+	mu         sync.Mutex
+	completed  int64
+	canceled   int64
+	terminated int64
+	longest    time.Duration
+}
+
+// record counts a query ending after d with err. Queries canceled by the
+// server, e.g. by statement_timeout or pg_cancel_backend, and sessions
+// terminated by pg_terminate_backend are expected and not errors.
+func (q *longQueryWorkload) record(d time.Duration, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		q.completed++
+		q.longest = max(q.longest, d)
+	case errors.As(err, &pgErr) && pgErr.Code == "57014":
+		q.canceled++
+		fmt.Printf("Long query canceled after %s: %s\n", d.Round(time.Millisecond), pgErr.Message)
+	case errors.As(err, &pgErr) && pgErr.Code == "57P01":
+		q.terminated++
+		fmt.Printf("Long query terminated after %s: %v\n", d.Round(time.Millisecond), err)
+	default:
+		return err
+	}
+	return nil
+}
+
+// task returns a task running one long query. The query runs in ctx, so
+// stopping or draining the run cancels it instead of waiting for it.
+func (q *longQueryWorkload) task(ctx context.Context, seed uint64) task {
+	r := newRand(seed, "long_queries")
+	return func() (outcome, error) {
+		result := outcome{name: "long_queries", read: true}
+		query := q.label + fmt.Sprintf(`SELECT count(*), max(length(b.cola))
+			FROM (SELECT pg_sleep($1)) AS pause, %s AS b`, qualifiedTable(pickSchema(r, q.schemas), "bigtable"))
+		started := time.Now()
+		err := q.pool.QueryRow(ctx, query, q.duration.Seconds()).Scan(nil, nil)
+		if ctx.Err() != nil {
+			return result, nil
+		}
+		return result, q.record(time.Since(started), err)
+	}
+}
+
+// startLongQueries starts the workers of the long query workload.
+func startLongQueries(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, schemas []string, seed uint64, label string) *longQueryWorkload {
+	settings := cfg.Inserter.LongQueries
+	q := &longQueryWorkload{
+		pool:     pool,
+		label:    label,
+		schemas:  schemas,
+		duration: time.Duration(settings.DurationSeconds) * time.Second,
+	}
+	if q.duration <= 0 {
+		q.duration = 30 * time.Second
+	}
+	interval := time.Duration(settings.EveryNSeconds) * time.Second
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+	e.start(workerSpec{
+		name:        "long_queries",
+		description: "long query worker",
+		concurrency: settings.Workers,
+		interval:    interval,
+		newTask:     func(i int) task { return q.task(ctx, workerSeed(seed, i)) },
+	})
+	return q
+}
+
+// report prints how the long queries ended.
+func (q *longQueryWorkload) report() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fmt.Println("Long query report:")
+	fmt.Printf("  %d completed, longest %s, %d canceled, %d terminated\n",
+		q.completed, q.longest.Round(time.Millisecond), q.canceled, q.terminated)
+}
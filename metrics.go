@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// writeMetrics writes the run counters and pool statistics in the
+// Prometheus text exposition format.
+func writeMetrics(w io.Writer, stats *runStats, pool *pgxpool.Pool) {
+	names := stats.tableNames()
+
+	fmt.Fprintln(w, "# HELP demodb_inserts_total Rows inserted per table.")
+	fmt.Fprintln(w, "# TYPE demodb_inserts_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "demodb_inserts_total{table=%q} %d\n", name, stats.table(name).inserts.Load())
+	}
+
+	fmt.Fprintln(w, "# HELP demodb_insert_errors_total Failed inserts per table.")
+	fmt.Fprintln(w, "# TYPE demodb_insert_errors_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "demodb_insert_errors_total{table=%q} %d\n", name, stats.table(name).errors.Load())
+	}
+
+	fmt.Fprintln(w, "# HELP demodb_updates_total Rows updated per table.")
+	fmt.Fprintln(w, "# TYPE demodb_updates_total counter")
+	for _, name := range names {
+		if updates := stats.table(name).updates.Load(); updates > 0 {
+			fmt.Fprintf(w, "demodb_updates_total{table=%q} %d\n", name, updates)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP demodb_deletes_total Rows deleted per table.")
+	fmt.Fprintln(w, "# TYPE demodb_deletes_total counter")
+	for _, name := range names {
+		if deletes := stats.table(name).deletes.Load(); deletes > 0 {
+			fmt.Fprintf(w, "demodb_deletes_total{table=%q} %d\n", name, deletes)
+		}
+	}
+
+	writeHistogram(w, "demodb_insert_duration_seconds", "Latency of successful inserts, updates and deletes.", "table", names,
+		func(name string) *latencyHistogram { return &stats.table(name).latency })
+
+	patterns := stats.patternNames()
+
+	fmt.Fprintln(w, "# HELP demodb_reads_total Queries run per read pattern.")
+	fmt.Fprintln(w, "# TYPE demodb_reads_total counter")
+	for _, name := range patterns {
+		fmt.Fprintf(w, "demodb_reads_total{pattern=%q} %d\n", name, stats.pattern(name).reads.Load())
+	}
+
+	fmt.Fprintln(w, "# HELP demodb_read_errors_total Failed queries per read pattern.")
+	fmt.Fprintln(w, "# TYPE demodb_read_errors_total counter")
+	for _, name := range patterns {
+		fmt.Fprintf(w, "demodb_read_errors_total{pattern=%q} %d\n", name, stats.pattern(name).errors.Load())
+	}
+
+	writeHistogram(w, "demodb_read_duration_seconds", "Latency of successful reads.", "pattern", patterns,
+		func(name string) *latencyHistogram { return &stats.pattern(name).latency })
+
+	ps := pool.Stat()
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"demodb_pool_total_conns", "Connections currently in the pool.", float64(ps.TotalConns())},
+		{"demodb_pool_acquired_conns", "Connections currently acquired.", float64(ps.AcquiredConns())},
+		{"demodb_pool_idle_conns", "Idle connections in the pool.", float64(ps.IdleConns())},
+		{"demodb_pool_max_conns", "Maximum size of the pool.", float64(ps.MaxConns())},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, g.value)
+	}
+
+	counters := []struct {
+		name, help string
+		value      float64
+	}{
+		{"demodb_pool_acquire_total", "Successful connection acquires.", float64(ps.AcquireCount())},
+		{"demodb_pool_acquire_duration_seconds_total", "Time spent acquiring connections.", ps.AcquireDuration().Seconds()},
+		{"demodb_pool_empty_acquire_total", "Acquires that had to wait for a connection.", float64(ps.EmptyAcquireCount())},
+		{"demodb_pool_canceled_acquire_total", "Acquires cancelled by their context.", float64(ps.CanceledAcquireCount())},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %g\n", c.name, c.help, c.name, c.name, c.value)
+	}
+}
+
+// writeHistogram writes one histogram series per name, labelled with key.
+func writeHistogram(w io.Writer, metric, help, key string, names []string, histogram func(name string) *latencyHistogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", metric)
+	for _, name := range names {
+		h := histogram(name)
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"%g\"} %d\n", metric, key, name, le, h.buckets[i].Load())
+		}
+		count := h.count.Load()
+		fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", metric, key, name, count)
+		fmt.Fprintf(w, "%s_sum{%s=%q} %g\n", metric, key, name, time.Duration(h.sumNanos.Load()).Seconds())
+		fmt.Fprintf(w, "%s_count{%s=%q} %d\n", metric, key, name, count)
+	}
+}
+
+// serveMetrics exposes /metrics and the effective configuration on /config
+// on metrics.listen_address until ctx is done.
+func serveMetrics(ctx context.Context, cfg *InserterConfig, stats *runStats, pool *pgxpool.Pool) {
+	addr := cfg.Metrics.ListenAddress
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, stats, pool)
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		data, err := effectiveConfig(cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Serving metrics on http://%s/metrics\n", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error serving metrics:", err)
+	}
+}
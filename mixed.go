@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// mixedWorkload runs pgbench like transactions against the Chinook tables,
+// choosing between a read, a purchase and an update transaction according
+// to the configured percentages.
+type mixedWorkload struct {
+	pool    *pgxpool.Pool
+	ids     *idTracker
+	schemas []string
+	label   string
+	// outbox writes an event for every invoice to the outbox table.
+	outbox bool
+
+	readPercent, writePercent int
+}
+
+// readTx looks up a track and the latest invoices of a customer.
+func (m *mixedWorkload) readTx(ctx context.Context, tx pgx.Tx, r *rand.Rand, schema string) error {
+	if _, err := runReadQuery(ctx, tx, m.label, "point_lookup", schema, 0); err != nil {
+		return err
+	}
+	customerID, err := m.ids.random(r, schema, "customer")
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, m.label+fmt.Sprintf(`SELECT invoice_id, invoice_date, total FROM %s
+		WHERE customer_id = $1 ORDER BY invoice_date DESC LIMIT 10`, qualifiedTable(schema, "invoice")), customerID)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// writeTx records a purchase of one to five tracks by a customer as an
+// invoice with its lines and returns the number of rows inserted.
+func (m *mixedWorkload) writeTx(ctx context.Context, tx pgx.Tx, r *rand.Rand, schema string) (int64, error) {
+	customerID, err := m.ids.random(r, schema, "customer")
+	if err != nil {
+		return 0, err
+	}
+	invoiceID, err := m.ids.nextID(ctx, m.pool, schema, "invoice")
+	if err != nil {
+		return 0, err
+	}
+	invoice := qualifiedTable(schema, "invoice")
+	_, err = tx.Exec(ctx, m.label+fmt.Sprintf(`INSERT INTO %s (invoice_id, customer_id, invoice_date, billing_address, billing_city, billing_state, billing_country, billing_postal_code, total)
+		SELECT $1, customer_id, NOW(), address, city, state, country, postal_code, 0 FROM %s WHERE customer_id = $2`,
+		invoice, qualifiedTable(schema, "customer")), invoiceID, customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	inserted := int64(1)
+	for range 1 + r.IntN(5) {
+		trackID, err := m.ids.random(r, schema, "track")
+		if err != nil {
+			return 0, err
+		}
+		lineID, err := m.ids.nextID(ctx, m.pool, schema, "invoice_line")
+		if err != nil {
+			return 0, err
+		}
+		tag, err := tx.Exec(ctx, m.label+fmt.Sprintf(`INSERT INTO %s (invoice_line_id, invoice_id, track_id, unit_price, quantity)
+			SELECT $1, $2, track_id, unit_price, 1 FROM %s WHERE track_id = $3`,
+			qualifiedTable(schema, "invoice_line"), qualifiedTable(schema, "track")), lineID, invoiceID, trackID)
+		if err != nil {
+			return 0, err
+		}
+		inserted += tag.RowsAffected()
+	}
+
+	_, err = tx.Exec(ctx, m.label+fmt.Sprintf(`UPDATE %s SET total = (SELECT COALESCE(SUM(unit_price * quantity), 0) FROM %s WHERE invoice_id = $1)
+		WHERE invoice_id = $1`, invoice, qualifiedTable(schema, "invoice_line")), invoiceID)
+	if err != nil || !m.outbox {
+		return inserted, err
+	}
+	return inserted, writeOutboxEvent(ctx, tx, m.label, schema, invoiceID)
+}
+
+// updateTx changes the contact details of a customer and the price of a
+// track and returns the number of rows updated.
+func (m *mixedWorkload) updateTx(ctx context.Context, tx pgx.Tx, r *rand.Rand, schema string) (int64, error) {
+	customerID, err := m.ids.random(r, schema, "customer")
+	if err != nil {
+		return 0, err
+	}
+	trackID, err := m.ids.random(r, schema, "track")
+	if err != nil {
+		return 0, err
+	}
+	p := realisticPerson(r)
+	customer, err := tx.Exec(ctx, m.label+fmt.Sprintf(`UPDATE %s SET phone = $1, email = $2 WHERE customer_id = $3`,
+		qualifiedTable(schema, "customer")), realisticPhone(r), p.email, customerID)
+	if err != nil {
+		return 0, err
+	}
+	track, err := tx.Exec(ctx, m.label+fmt.Sprintf(`UPDATE %s SET unit_price = $1 WHERE track_id = $2`,
+		qualifiedTable(schema, "track")), []float64{0.99, 1.29, 1.99}[r.IntN(3)], trackID)
+	if err != nil {
+		return 0, err
+	}
+	return customer.RowsAffected() + track.RowsAffected(), nil
+}
+
+// run executes one transaction of a randomly chosen kind, which is used as
+// the name of its outcome.
+func (m *mixedWorkload) run(ctx context.Context, r *rand.Rand) (outcome, error) {
+	schema := pickSchema(r, m.schemas)
+
+	var o outcome
+	err := pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		var err error
+		switch n := r.IntN(100); {
+		case n < m.readPercent:
+			o = outcome{name: "mixed_read", read: true}
+			err = m.readTx(ctx, tx, r, schema)
+		case n < m.readPercent+m.writePercent:
+			o.name = "invoice"
+			o.inserted, err = m.writeTx(ctx, tx, r, schema)
+		default:
+			o.name = "mixed_update"
+			o.updated, err = m.updateTx(ctx, tx, r, schema)
+		}
+		return err
+	})
+	return o, err
+}
+
+// loadIDs loads the customer and track ids the transactions reference.
+func (m *mixedWorkload) loadIDs(ctx context.Context) error {
+	for _, schema := range m.schemas {
+		for _, table := range []string{"customer", "track"} {
+			if err := m.ids.load(ctx, m.pool, schema, table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Events sent to the webhook notifier.
+const (
+	EventRunStarted          = "run_started"
+	EventErrorBudgetExceeded = "error_budget_exceeded"
+	EventRunFinished         = "run_finished"
+)
+
+type notifier struct {
+	url    string
+	format string
+	client *http.Client
+	source string
+}
+
+func newNotifier(cfg *InserterConfig) *notifier {
+	if cfg.Notifications.WebhookURL == "" {
+		return nil
+	}
+	return &notifier{
+		url:    cfg.Notifications.WebhookURL,
+		format: cfg.Notifications.Format,
+		client: &http.Client{Timeout: 10 * time.Second},
+		source: fmt.Sprintf("%s@%s:%s", cfg.Database, cfg.Host, cfg.Port),
+	}
+}
+
+// notify posts an event to the configured webhook. A nil notifier is a no-op
+// so callers don't need to check whether notifications are enabled. Failures
+// are printed but never stop the run.
+func (n *notifier) notify(event, message string) {
+	if n == nil {
+		return
+	}
+
+	var payload any
+	if n.format == "slack" {
+		payload = map[string]string{
+			"text": fmt.Sprintf("*demo-db* [%s] %s: %s", n.source, event, message),
+		}
+	} else {
+		payload = map[string]string{
+			"event":   event,
+			"message": message,
+			"source":  n.source,
+			"time":    time.Now().UTC().Format(time.RFC3339),
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("Error encoding webhook payload: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error creating webhook request: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		fmt.Printf("Error sending %s notification: %v\n", event, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Printf("Webhook returned %s for %s notification\n", resp.Status, event)
+	}
+}
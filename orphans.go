@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// orphanReference is the foreign key reference of a child table that the
+// orphan injector breaks.
+type orphanReference struct {
+	column, parent, parentKey string
+}
+
+// orphanReferences are the child tables that can receive orphans.
+var orphanReferences = map[string]orphanReference{
+	"album":          {"artist_id", "artist", "artist_id"},
+	"track":          {"album_id", "album", "album_id"},
+	"playlist_track": {"track_id", "track", "track_id"},
+	"customer":       {"support_rep_id", "employee", "employee_id"},
+}
+
+// dropForeignKeys drops the foreign keys of the demo tables, for the
+// skip_foreign_keys setting.
+func dropForeignKeys(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	if !cfg.SkipForeignKeys {
+		return nil
+	}
+	for _, schema := range workloadSchemas(cfg) {
+		for _, table := range demoTables {
+			rows, err := pool.Query(ctx, `SELECT conname FROM pg_constraint WHERE conrelid = to_regclass($1) AND contype = 'f'`,
+				qualifiedTable(schema, table))
+			if err != nil {
+				return fmt.Errorf("listing foreign keys of %s failed: %w", table, err)
+			}
+			var names []string
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					rows.Close()
+					return err
+				}
+				names = append(names, name)
+			}
+			rows.Close()
+			for _, name := range names {
+				if _, err := pool.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s`, qualifiedTable(schema, table), pgx.Identifier{name}.Sanitize())); err != nil {
+					return fmt.Errorf("dropping foreign key %s failed: %w", name, err)
+				}
+				fmt.Printf("Dropped foreign key %s of %s\n", name, qualifiedTable(schema, table))
+			}
+		}
+	}
+	return nil
+}
+
+// orphanInjector makes a share of the child rows reference parents that do
+// not exist, negative ids, giving data quality checks known defects to
+// find. A nil orphanInjector keeps all references valid.
+type orphanInjector struct {
+	percent  float64
+	injected map[string]*atomic.Int64
+}
+
+// newOrphanInjector returns an injector for tables, after checking that
+// their foreign keys are gone in every schema, which would reject the
+// orphans.
+func newOrphanInjector(ctx context.Context, pool *pgxpool.Pool, schemas []string, tables []string, percent float64) (*orphanInjector, error) {
+	if len(tables) == 0 {
+		tables = slices.Sorted(maps.Keys(orphanReferences))
+	}
+	o := &orphanInjector{percent: percent, injected: map[string]*atomic.Int64{}}
+	for _, table := range tables {
+		for _, schema := range schemas {
+			var keys int
+			err := pool.QueryRow(ctx, `SELECT count(*) FROM pg_constraint WHERE conrelid = to_regclass($1) AND contype = 'f'`,
+				qualifiedTable(schema, table)).Scan(&keys)
+			if err != nil {
+				return nil, fmt.Errorf("checking the foreign keys of %s failed: %w", table, err)
+			}
+			if keys > 0 {
+				return nil, fmt.Errorf("%s has foreign keys, which reject orphans; recreate the tables with skip_foreign_keys", qualifiedTable(schema, table))
+			}
+		}
+		o.injected[table] = &atomic.Int64{}
+	}
+	return o, nil
+}
+
+// orphan reports whether the next row of table gets an orphaned reference,
+// and counts it.
+func (o *orphanInjector) orphan(r *rand.Rand, table string) bool {
+	if o == nil || o.injected[table] == nil || r.Float64()*100 >= o.percent {
+		return false
+	}
+	o.injected[table].Add(1)
+	return true
+}
+
+// id returns the parent id for the next row of table, id or a missing one.
+func (o *orphanInjector) id(r *rand.Rand, table string, id int64) int64 {
+	if o.orphan(r, table) {
+		return -1 - r.Int64N(1_000_000)
+	}
+	return id
+}
+
+// expr returns the SQL expression of the parent id for the next row of
+// table, expr or a missing id.
+func (o *orphanInjector) expr(r *rand.Rand, table, expr string) string {
+	if o.orphan(r, table) {
+		return "(" + strconv.FormatInt(-1-r.Int64N(1_000_000), 10) + ")"
+	}
+	return expr
+}
+
+// report prints the orphans injected per table and those found, which
+// include orphans of earlier runs.
+func (o *orphanInjector) report(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	fmt.Println("Orphan report:")
+	for _, table := range slices.Sorted(maps.Keys(o.injected)) {
+		ref := orphanReferences[table]
+		var found int64
+		for _, schema := range schemas {
+			var n int64
+			err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT count(*) FROM %s c
+				WHERE c.%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.%s = c.%[2]s)`,
+				qualifiedTable(schema, table), ref.column, qualifiedTable(schema, ref.parent), ref.parentKey)).Scan(&n)
+			if err != nil {
+				return fmt.Errorf("counting the orphans of %s failed: %w", table, err)
+			}
+			found += n
+		}
+		fmt.Printf("  %-16s %d injected, %d orphaned rows found by %s\n", table, o.injected[table].Load(), found, ref.column)
+	}
+	return nil
+}
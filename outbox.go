@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// outboxTable receives an event in the transaction of every invoice of the
+// mixed workload when the outbox is enabled.
+const outboxTable = "demo_db_outbox"
+
+// setupOutbox creates the outbox table. The partial index keeps the relay
+// query cheap however many processed rows are waiting for vacuum.
+func setupOutbox(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	for _, schema := range schemas {
+		outbox := qualifiedTable(schema, outboxTable)
+		steps := []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+				aggregate_type TEXT NOT NULL,
+				aggregate_id BIGINT NOT NULL,
+				event_type TEXT NOT NULL,
+				payload JSONB NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				processed_at TIMESTAMPTZ
+			)`, outbox),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS demo_db_outbox_pending_idx ON %s (id) WHERE processed_at IS NULL`, outbox),
+		}
+		for _, step := range steps {
+			if _, err := pool.Exec(ctx, step); err != nil {
+				return fmt.Errorf("creating outbox table failed: %w", err)
+			}
+		}
+		if err := registerObjects(ctx, pool, managedObject{Kind: "table", Schema: schema, Name: outboxTable}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutboxEvent records the creation of an invoice in the outbox, in
+// the transaction that inserted it.
+func writeOutboxEvent(ctx context.Context, tx pgx.Tx, label, schema string, invoiceID int64) error {
+	_, err := tx.Exec(ctx, label+fmt.Sprintf(`INSERT INTO %s (aggregate_type, aggregate_id, event_type, payload)
+		SELECT 'invoice', invoice_id, 'invoice_created',
+			jsonb_build_object('invoice_id', invoice_id, 'customer_id', customer_id, 'total', total, 'invoice_date', invoice_date)
+		FROM %s WHERE invoice_id = $1`, qualifiedTable(schema, outboxTable), qualifiedTable(schema, "invoice")), invoiceID)
+	return err
+}
+
+// outboxEvent is an event handed to the relay's publisher.
+type outboxEvent struct {
+	ID          int64           `json:"id"`
+	AggregateID int64           `json:"aggregate_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// outboxRelay polls the outbox for pending events, publishes them and
+// marks them processed, or deletes them, in one transaction, so an event
+// is published again if marking it fails.
+type outboxRelay struct {
+	pool      *pgxpool.Pool
+	label     string
+	batchSize int
+	delete    bool
+	// webhookURL receives the events of a batch as a JSON array, they are
+	// printed when empty.
+	webhookURL string
+	client     *http.Client
+}
+
+func (o *outboxRelay) publish(ctx context.Context, events []outboxEvent) error {
+	if o.webhookURL == "" {
+		fmt.Printf("Relayed %d outbox events, ids %d-%d\n", len(events), events[0].ID, events[len(events)-1].ID)
+		return nil
+	}
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("publishing outbox events failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("publishing outbox events failed: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// task returns the task relaying one batch of a schema. Concurrent relays
+// skip the rows locked by each other.
+func (o *outboxRelay) task(ctx context.Context, schema string) task {
+	outbox := qualifiedTable(schema, outboxTable)
+	finish := fmt.Sprintf(`UPDATE %s SET processed_at = NOW() WHERE id = ANY($1)`, outbox)
+	if o.delete {
+		finish = fmt.Sprintf(`DELETE FROM %s WHERE id = ANY($1)`, outbox)
+	}
+
+	return func() (outcome, error) {
+		var result outcome
+		err := pgx.BeginFunc(ctx, o.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, o.label+fmt.Sprintf(`SELECT id, aggregate_id, event_type, payload FROM %s
+				WHERE processed_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, outbox), o.batchSize)
+			if err != nil {
+				return err
+			}
+			events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (outboxEvent, error) {
+				var e outboxEvent
+				err := row.Scan(&e.ID, &e.AggregateID, &e.EventType, &e.Payload)
+				return e, err
+			})
+			if err != nil || len(events) == 0 {
+				return err
+			}
+
+			if err := o.publish(ctx, events); err != nil {
+				return err
+			}
+			ids := make([]int64, len(events))
+			for i, e := range events {
+				ids[i] = e.ID
+			}
+			tag, err := tx.Exec(ctx, o.label+finish, ids)
+			if o.delete {
+				result.deleted = tag.RowsAffected()
+			} else {
+				result.updated = tag.RowsAffected()
+			}
+			return err
+		})
+		return result, err
+	}
+}
+
+// startOutboxRelay starts the relay workers of every schema, each relaying
+// up to one batch per poll interval.
+func startOutboxRelay(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, schemas []string, label string) {
+	settings := cfg.Inserter.Outbox
+	relay := &outboxRelay{
+		pool:       pool,
+		label:      label,
+		batchSize:  settings.BatchSize,
+		delete:     settings.DeleteProcessed,
+		webhookURL: settings.WebhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	if relay.batchSize <= 0 {
+		relay.batchSize = 100
+	}
+	interval := time.Duration(settings.PollIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for _, schema := range schemas {
+		name := "outbox_relay"
+		if schema != "" {
+			name += "_" + schema
+		}
+		e.start(workerSpec{
+			name:        name,
+			description: "outbox relay for " + qualifiedTable(schema, outboxTable),
+			concurrency: settings.Relays,
+			interval:    interval,
+			newTask:     func(int) task { return relay.task(ctx, schema) },
+		})
+	}
+}
+
+// printOutboxReport prints the pending events and the dead tuples left by
+// the relay, which show how well autovacuum keeps up with the outbox.
+func printOutboxReport(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	fmt.Println("Outbox report:")
+	for _, schema := range schemas {
+		outbox := qualifiedTable(schema, outboxTable)
+		var pending, live, dead, autovacuums, size int64
+		err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT (SELECT count(*) FROM %s WHERE processed_at IS NULL),
+				n_live_tup, n_dead_tup, autovacuum_count, pg_total_relation_size(relid)
+			FROM pg_stat_user_tables WHERE relid = to_regclass($1)`, outbox), outbox).Scan(&pending, &live, &dead, &autovacuums, &size)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading statistics of %s failed: %w", outbox, err)
+		}
+		fmt.Printf("  %-15s pending=%d live=%d dead=%d autovacuums=%d size=%s\n",
+			outbox, pending, live, dead, autovacuums, formatBytes(size))
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// partitionPrefix starts the names of the daily partitions of the timestamp
+// table, followed by the day, e.g. timestamp_p20240131.
+const partitionPrefix = "timestamp_p"
+
+// setupPartitioning replaces the timestamp table by a table range
+// partitioned by day on created_at, keeping its rows. Partitions are created
+// for the days of the existing rows and the upcoming days. A table already
+// partitioned is left alone.
+func setupPartitioning(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	if !cfg.Partitioning.Enabled {
+		return nil
+	}
+	for _, schema := range workloadSchemas(cfg) {
+		table := qualifiedTable(schema, "timestamp")
+		var partitioned bool
+		err := pool.QueryRow(ctx, `SELECT relkind = 'p' FROM pg_class WHERE oid = $1::regclass`, table).Scan(&partitioned)
+		if err != nil {
+			return fmt.Errorf("checking %s failed: %w", table, err)
+		}
+		if partitioned {
+			continue
+		}
+
+		old := qualifiedTable(schema, "timestamp_unpartitioned")
+		err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			steps := []string{
+				fmt.Sprintf(`ALTER TABLE %s RENAME TO timestamp_unpartitioned`, table),
+				// The names of the primary key and the sequence of the
+				// new table would collide with the old ones.
+				fmt.Sprintf(`ALTER INDEX IF EXISTS %s RENAME TO timestamp_unpartitioned_pkey`, qualifiedTable(schema, "timestamp_pkey")),
+				fmt.Sprintf(`ALTER SEQUENCE IF EXISTS %s RENAME TO timestamp_unpartitioned_id_seq`, qualifiedTable(schema, "timestamp_id_seq")),
+				fmt.Sprintf(`CREATE TABLE %s (
+					id SERIAL,
+					created_at TIMESTAMP NOT NULL,
+					PRIMARY KEY (id, created_at)
+				) PARTITION BY RANGE (created_at)`, table),
+			}
+			for _, step := range steps {
+				if _, err := tx.Exec(ctx, step); err != nil {
+					return err
+				}
+			}
+
+			var first time.Time
+			if err := tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MIN(created_at)::date, current_date)::timestamp FROM %s`, old)).Scan(&first); err != nil {
+				return err
+			}
+			if err := createPartitions(ctx, tx, schema, first, cfg.Partitioning.PremakeDays); err != nil {
+				return err
+			}
+
+			steps = []string{
+				fmt.Sprintf(`INSERT INTO %s (id, created_at) SELECT id, created_at FROM %s`, table, old),
+				fmt.Sprintf(`SELECT setval(pg_get_serial_sequence(%s, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s`, quoteLiteral(table), table),
+				fmt.Sprintf(`DROP TABLE %s`, old),
+			}
+			for _, step := range steps {
+				if _, err := tx.Exec(ctx, step); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("partitioning %s failed: %w", table, err)
+		}
+		fmt.Printf("%s is partitioned by day on created_at\n", table)
+	}
+	return nil
+}
+
+// partitionDB is a pool or a transaction creating partitions.
+type partitionDB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// createPartitions creates the daily partitions of the timestamp table from
+// the day of from, or the current date of the server when from is zero or
+// later, to premakeDays days after the current date.
+func createPartitions(ctx context.Context, db partitionDB, schema string, from time.Time, premakeDays int) error {
+	var today time.Time
+	if err := db.QueryRow(ctx, `SELECT current_date::timestamp`).Scan(&today); err != nil {
+		return err
+	}
+	if premakeDays <= 0 {
+		premakeDays = 3
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	if from.IsZero() || from.After(today) {
+		from = today
+	}
+	for day := from; !day.After(today.AddDate(0, 0, premakeDays)); day = day.AddDate(0, 0, 1) {
+		_, err := db.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+			qualifiedTable(schema, partitionPrefix+day.Format("20060102")), qualifiedTable(schema, "timestamp"),
+			day.Format(time.DateOnly), day.AddDate(0, 0, 1).Format(time.DateOnly)))
+		if err != nil {
+			return fmt.Errorf("creating partition for %s failed: %w", day.Format(time.DateOnly), err)
+		}
+	}
+	return nil
+}
+
+// dropOldPartitions drops the daily partitions of days more than
+// retentionDays before the current date of the server.
+func dropOldPartitions(ctx context.Context, pool *pgxpool.Pool, schema string, retentionDays int) ([]string, error) {
+	var today time.Time
+	if err := pool.QueryRow(ctx, `SELECT current_date::timestamp`).Scan(&today); err != nil {
+		return nil, err
+	}
+	rows, err := pool.Query(ctx, `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass ORDER BY c.relname`, qualifiedTable(schema, "timestamp"))
+	if err != nil {
+		return nil, err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := today.AddDate(0, 0, -retentionDays)
+	var dropped []string
+	for _, name := range names {
+		day, err := time.Parse("20060102", strings.TrimPrefix(name, partitionPrefix))
+		if err != nil || !strings.HasPrefix(name, partitionPrefix) || !day.Before(cutoff) {
+			continue
+		}
+		if _, err := pool.Exec(ctx, "DROP TABLE "+qualifiedTable(schema, name)); err != nil {
+			return dropped, fmt.Errorf("dropping partition %s failed: %w", name, err)
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
+
+// maintainPartitions creates the upcoming partitions of every schema and,
+// with a retention, drops the old ones.
+func maintainPartitions(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, schemas []string) error {
+	settings := cfg.Partitioning
+	for _, schema := range schemas {
+		var partitioned bool
+		err := pool.QueryRow(ctx, `SELECT COALESCE((SELECT relkind = 'p' FROM pg_class WHERE oid = to_regclass($1)), false)`,
+			qualifiedTable(schema, "timestamp")).Scan(&partitioned)
+		if err != nil {
+			return err
+		}
+		if !partitioned {
+			return fmt.Errorf("%s is not partitioned, run create-tables or recreate with partitioning.enabled", qualifiedTable(schema, "timestamp"))
+		}
+
+		if err := createPartitions(ctx, pool, schema, time.Time{}, settings.PremakeDays); err != nil {
+			return err
+		}
+		if settings.RetentionDays > 0 {
+			dropped, err := dropOldPartitions(ctx, pool, schema, settings.RetentionDays)
+			if len(dropped) > 0 {
+				fmt.Printf("Dropped partitions older than %d days: %s\n", settings.RetentionDays, strings.Join(dropped, ", "))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// startPartitionManager maintains the partitions of the timestamp table
+// right away, so the inserts of today have a partition, and then every
+// interval on the worker engine.
+func startPartitionManager(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, schemas []string) error {
+	if err := maintainPartitions(ctx, cfg, pool, schemas); err != nil {
+		return err
+	}
+	interval := time.Duration(cfg.Partitioning.EveryNSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	// The first maintenance ran above, so the worker starts an interval later.
+	e.start(workerSpec{
+		name:        "partition_manager",
+		description: "partition manager",
+		interval:    interval,
+		delay:       interval,
+		newTask: func(int) task {
+			return func() (outcome, error) {
+				return outcome{}, maintainPartitions(ctx, cfg, pool, schemas)
+			}
+		},
+	})
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cronJob is a job scheduled with pg_cron.
+type cronJob struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Command  string `json:"command"`
+}
+
+// salesByGenreView is refreshed by the default hourly pg_cron job.
+const salesByGenreView = "demo_db_sales_by_genre"
+
+// defaultCronJobs returns the jobs scheduled for schema when pg_cron.jobs is
+// empty: an hourly refresh of the sales by genre aggregate, a nightly purge
+// of old timestamp rows and an ANALYZE of the invoice tables every 15
+// minutes. The names of the jobs of a tenant schema end with the schema.
+func defaultCronJobs(schema string) []cronJob {
+	suffix := ""
+	if schema != "" {
+		suffix = "_" + schema
+	}
+	return []cronJob{
+		{Name: "demo_db_refresh_sales_by_genre" + suffix, Schedule: "0 * * * *",
+			Command: "REFRESH MATERIALIZED VIEW " + qualifiedTable(schema, salesByGenreView)},
+		{Name: "demo_db_purge_timestamps" + suffix, Schedule: "30 3 * * *",
+			Command: fmt.Sprintf("DELETE FROM %s WHERE created_at < NOW() - INTERVAL '7 days'", qualifiedTable(schema, "timestamp"))},
+		{Name: "demo_db_analyze_invoices" + suffix, Schedule: "*/15 * * * *",
+			Command: fmt.Sprintf("ANALYZE %s, %s", qualifiedTable(schema, "invoice"), qualifiedTable(schema, "invoice_line"))},
+	}
+}
+
+// setupPgCron schedules the configured pg_cron jobs, or the default ones,
+// so the database shows scheduled activity while demo-db is not running.
+// pg_cron has to be preloaded and cron.database_name has to name the
+// configured database, otherwise no jobs are scheduled.
+func setupPgCron(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	if !cfg.PgCron.Enabled {
+		return nil
+	}
+
+	var available bool
+	var cronDatabase, database string
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'pg_cron'),
+		COALESCE(current_setting('cron.database_name', true), ''), current_database()`).Scan(&available, &cronDatabase, &database)
+	if err != nil {
+		return err
+	}
+	if !available {
+		fmt.Println("pg_cron is not available on the server, skipping scheduled jobs")
+		return nil
+	}
+	if cronDatabase != "" && cronDatabase != database {
+		fmt.Printf("pg_cron runs in database %s (cron.database_name), not %s, skipping scheduled jobs\n", cronDatabase, database)
+		return nil
+	}
+	if _, err := pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_cron"); err != nil {
+		return fmt.Errorf("creating extension pg_cron failed, it has to be in shared_preload_libraries: %w", err)
+	}
+	objects := []managedObject{{Kind: "extension", Name: "pg_cron"}}
+
+	jobs := cfg.PgCron.Jobs
+	if len(jobs) == 0 {
+		// Every tenant schema gets its own view and jobs.
+		for _, schema := range workloadSchemas(cfg) {
+			query := fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s AS
+				SELECT g.genre_id, g.name, count(*) AS lines, sum(il.unit_price * il.quantity) AS revenue
+				FROM %s il JOIN %s t ON t.track_id = il.track_id JOIN %s g ON g.genre_id = t.genre_id
+				GROUP BY g.genre_id, g.name`, qualifiedTable(schema, salesByGenreView),
+				qualifiedTable(schema, "invoice_line"), qualifiedTable(schema, "track"), qualifiedTable(schema, "genre"))
+			if _, err := pool.Exec(ctx, query); err != nil {
+				return fmt.Errorf("creating materialized view %s failed: %w", qualifiedTable(schema, salesByGenreView), err)
+			}
+			objects = append(objects, managedObject{Kind: "materialized view", Schema: schema, Name: salesByGenreView})
+			jobs = append(jobs, defaultCronJobs(schema)...)
+		}
+	}
+
+	for _, job := range jobs {
+		// Scheduling a job with an existing name replaces it.
+		if _, err := pool.Exec(ctx, `SELECT cron.schedule($1, $2, $3)`, job.Name, job.Schedule, job.Command); err != nil {
+			return fmt.Errorf("scheduling pg_cron job %s failed: %w", job.Name, err)
+		}
+		fmt.Printf("Scheduled pg_cron job %s (%s): %s\n", job.Name, job.Schedule, job.Command)
+		objects = append(objects, managedObject{Kind: "cron job", Name: job.Name})
+	}
+	return registerObjects(ctx, pool, objects...)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pidFile guards against two instances running on the same host with the
+// same pidfile. The file holds the pid of the running instance and stays
+// locked for the lifetime of the process.
+type pidFile struct {
+	path string
+	file *os.File
+}
+
+func acquirePidFile(path string) (*pidFile, error) {
+	file, err := openLockedFile(path)
+	if err != nil {
+		if err == errPidFileLocked {
+			return nil, fmt.Errorf("another instance is already running (pid %s, pidfile %s)", readPid(path), path)
+		}
+		return nil, fmt.Errorf("cannot lock pidfile %s: %w", path, err)
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot write pidfile %s: %w", path, err)
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot write pidfile %s: %w", path, err)
+	}
+	return &pidFile{path: path, file: file}, nil
+}
+
+func (p *pidFile) release() {
+	if p == nil {
+		return
+	}
+	os.Remove(p.path)
+	p.file.Close()
+}
+
+func readPid(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil || len(strings.TrimSpace(string(content))) == 0 {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(content))
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errPidFileLocked = errors.New("pidfile is locked")
+
+// openLockedFile falls back to exclusive creation where flock is not
+// available. A stale pidfile left by a crashed process has to be removed
+// by hand.
+func openLockedFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errPidFileLocked
+	}
+	return file, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// workloadPoolNames are the groups of workers that can get a pool of their
+// own: reads runs the read workload, writes the inserters and the other
+// workloads changing rows, and maintenance the background tasks like the
+// partition manager, the WAL switcher, the concurrent index builds and the
+// schema changes.
+var workloadPoolNames = []string{"reads", "writes", "maintenance"}
+
+// workloadPool sizes the dedicated pool of a group of workers and sets the
+// role it connects as, the role of the config when empty.
+type workloadPool struct {
+	MaxConns int    `json:"max_conns"`
+	MinConns int    `json:"min_conns"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (p workloadPool) validate() error {
+	if p.MaxConns < 0 || p.MinConns < 0 {
+		return fmt.Errorf("max_conns and min_conns must not be negative")
+	}
+	if maxConns := cmp.Or(p.MaxConns, 5); p.MinConns > maxConns {
+		return fmt.Errorf("min_conns (%d) must not exceed max_conns (%d)", p.MinConns, maxConns)
+	}
+	return nil
+}
+
+// workloadPools holds the pools of the groups of workers. Groups without
+// a dedicated pool share the main one.
+type workloadPools struct {
+	reads, writes, maintenance *pgxpool.Pool
+	// dedicated holds the pools opened for a group, by group name.
+	dedicated map[string]*pgxpool.Pool
+}
+
+// openWorkloadPools opens the dedicated pools configured in pools. They
+// trace their statements like the main pool, so recorded runs include
+// them.
+func openWorkloadPools(cfg *InserterConfig, main *pgxpool.Pool) (*workloadPools, error) {
+	p := &workloadPools{reads: main, writes: main, maintenance: main, dedicated: map[string]*pgxpool.Pool{}}
+	for _, name := range workloadPoolNames {
+		settings, ok := cfg.Pools[name]
+		if !ok {
+			continue
+		}
+		c := *cfg
+		c.Pool.MaxConns, c.Pool.MinConns = settings.MaxConns, settings.MinConns
+		if settings.Username != "" {
+			c.Username, c.Password = settings.Username, settings.Password
+		}
+		pool, err := connectPool(&c, func(poolCfg *pgxpool.Config) {
+			poolCfg.ConnConfig.Tracer = main.Config().ConnConfig.Tracer
+		})
+		if err != nil {
+			p.close()
+			return nil, fmt.Errorf("opening the %s pool failed: %w", name, err)
+		}
+		p.dedicated[name] = pool
+		switch name {
+		case "reads":
+			p.reads = pool
+		case "writes":
+			p.writes = pool
+		case "maintenance":
+			p.maintenance = pool
+		}
+		fmt.Printf("Using a dedicated pool of up to %d connections as %s for %s\n", pool.Config().MaxConns, c.Username, name)
+	}
+	return p, nil
+}
+
+// close closes the dedicated pools.
+func (p *workloadPools) close() {
+	for _, pool := range p.dedicated {
+		pool.Close()
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressSnapshot is what a table had done at the previous progress
+// report.
+type progressSnapshot struct {
+	inserts uint64
+	errors  uint64
+	latency latencySnapshot
+}
+
+// startProgressReporter prints a throughput report every interval until
+// ctx is done: per table the rows inserted, the rate, the errors and the
+// p95 insert latency, both since the start and over the last interval.
+// It only reads stats, so it stays off the worker engine and keeps reporting
+// while the workers are paused.
+func startProgressReporter(wg *sync.WaitGroup, ctx context.Context, stats *runStats, interval time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fmt.Printf("Reporting progress every %s\n", interval)
+		prev := map[string]progressSnapshot{}
+		last := time.Now()
+		for sleep(ctx, interval) {
+			now := time.Now()
+			fmt.Print(progressReport(stats, prev, now.Sub(stats.started), now.Sub(last)))
+			last = now
+		}
+	}()
+}
+
+// progressReport formats a progress report and replaces the snapshots in
+// prev with the current ones. Tables without inserts or errors are left
+// out; reads are not part of it.
+func progressReport(stats *runStats, prev map[string]progressSnapshot, elapsed, interval time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Progress after %s, last %s:\n", elapsed.Round(time.Second), interval.Round(time.Second))
+	fmt.Fprintf(&b, "  %-15s %12s %10s %10s %10s %8s %8s %10s %10s\n",
+		"TABLE", "INSERTED", "ROWS/S", "INTERVAL", "ROWS/S", "ERRORS", "INTERVAL", "P95", "P95 INT")
+	rate := func(rows uint64, d time.Duration) float64 {
+		if d <= 0 {
+			return 0
+		}
+		return float64(rows) / d.Seconds()
+	}
+	var total, totalPrev progressSnapshot
+	for _, name := range stats.tableNames() {
+		t := stats.table(name)
+		cur := progressSnapshot{inserts: t.inserts.Load(), errors: t.errors.Load(), latency: t.latency.snapshot()}
+		last := prev[name]
+		prev[name] = cur
+		if cur.inserts == 0 && cur.errors == 0 {
+			continue
+		}
+		total.inserts += cur.inserts
+		total.errors += cur.errors
+		totalPrev.inserts += last.inserts
+		totalPrev.errors += last.errors
+		latest := cur.latency.sub(last.latency)
+		fmt.Fprintf(&b, "  %-15s %12d %10.1f %10d %10.1f %8d %8d %10s %10s\n", name,
+			cur.inserts, rate(cur.inserts, elapsed), cur.inserts-last.inserts, rate(cur.inserts-last.inserts, interval),
+			cur.errors, cur.errors-last.errors, cur.latency.formatQuantile(0.95), latest.formatQuantile(0.95))
+	}
+	fmt.Fprintf(&b, "  %-15s %12d %10.1f %10d %10.1f %8d %8d\n", "total",
+		total.inserts, rate(total.inserts, elapsed), total.inserts-totalPrev.inserts, rate(total.inserts-totalPrev.inserts, interval),
+		total.errors, total.errors-totalPrev.errors)
+	return b.String()
+}
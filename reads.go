@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// readPatterns build the SELECT statements of the read workload for a
+// schema. Random ids are drawn server side between 1 and MAX(id), which the
+// planner answers from the primary key index, so lookups can miss on tables
+// with gaps just like real traffic does.
+var readPatterns = map[string]func(schema string) string{
+	"point_lookup": func(schema string) string {
+		return fmt.Sprintf(`SELECT track_id, name, composer, unit_price FROM %[1]s
+			WHERE track_id = (SELECT floor(random() * MAX(track_id))::int + 1 FROM %[1]s)`, qualifiedTable(schema, "track"))
+	},
+	"timestamp_range": func(schema string) string {
+		return fmt.Sprintf(`SELECT id, created_at FROM %s
+			WHERE created_at >= NOW() - make_interval(mins => $1) ORDER BY created_at DESC LIMIT 100`, qualifiedTable(schema, "timestamp"))
+	},
+	"join": func(schema string) string {
+		return fmt.Sprintf(`SELECT ar.name, al.title, t.name, t.milliseconds
+			FROM %s ar
+			JOIN %s al ON al.artist_id = ar.artist_id
+			JOIN %s t ON t.album_id = al.album_id
+			WHERE ar.artist_id = (SELECT floor(random() * MAX(artist_id))::int + 1 FROM %[1]s)`,
+			qualifiedTable(schema, "artist"), qualifiedTable(schema, "album"), qualifiedTable(schema, "track"))
+	},
+	// customer_as_of reads a customer as it was at a random moment of the
+	// last range minutes, from the current row or the history table.
+	"customer_as_of": func(schema string) string {
+		return fmt.Sprintf(`WITH p AS (
+				SELECT NOW() - random() * make_interval(mins => $1) AS ts,
+					(SELECT floor(random() * MAX(customer_id))::int + 1 FROM %[1]s) AS id
+			)
+			SELECT c.customer_id, c.email, c.phone, c.valid_from, NULL::timestamptz AS valid_to
+			FROM %[1]s c, p WHERE c.customer_id = p.id AND c.valid_from <= p.ts
+			UNION ALL
+			SELECT h.customer_id, h.email, h.phone, h.valid_from, h.valid_to
+			FROM %[2]s h, p WHERE h.customer_id = p.id AND h.valid_from <= p.ts AND h.valid_to > p.ts`,
+			qualifiedTable(schema, "customer"), qualifiedTable(schema, "customer_history"))
+	},
+}
+
+// defaultReadPatterns returns the read patterns used when none are
+// configured, including the ones on history tables only when they exist.
+func defaultReadPatterns(history bool) []string {
+	if history {
+		return readPatternNames()
+	}
+	return slices.DeleteFunc(readPatternNames(), func(name string) bool { return slices.Contains(historyReadPatterns, name) })
+}
+
+func validateReadPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, ok := readPatterns[pattern]; !ok {
+			return fmt.Errorf("read pattern %s is not supported, must be one of %v", pattern, readPatternNames())
+		}
+	}
+	return nil
+}
+
+func readPatternNames() []string {
+	names := make([]string, 0, len(readPatterns))
+	for name := range readPatterns {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// querier is implemented by both pools and transactions.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// runReadQuery runs a read pattern and returns the number of rows read.
+func runReadQuery(ctx context.Context, db querier, label, pattern, schema string, rangeMinutes int) (int, error) {
+	query := label + readPatterns[pattern](schema)
+	var args []any
+	if pattern == "timestamp_range" || pattern == "customer_as_of" {
+		args = append(args, rangeMinutes)
+	}
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
+
+// readTask returns a task running a randomly chosen read pattern. Results
+// are recorded per pattern as reads, separately from inserts.
+func readTask(ctx context.Context, pool *pgxpool.Pool, r *rand.Rand, label string, schemas, patterns []string, rangeMinutes int) task {
+	return func() (outcome, error) {
+		pattern := patterns[r.IntN(len(patterns))]
+		_, err := runReadQuery(ctx, pool, label, pattern, pickSchema(r, schemas), rangeMinutes)
+		return outcome{name: pattern, read: true}, err
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+var (
+	firstNames = []string{
+		"Emma", "Liam", "Olivia", "Noah", "Ava", "Lucas", "Sophia", "Mateo", "Mia", "Leon",
+		"Charlotte", "Luca", "Amelia", "Hugo", "Isabella", "Finn", "Julia", "Elias", "Lena", "Jonas",
+		"Chloe", "Marco", "Sara", "Tomas", "Nora", "Ivan", "Ana", "David", "Laura", "Pablo",
+	}
+	lastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Muller", "Schmidt", "Schneider", "Rossi", "Russo", "Bianchi", "Dubois", "Moreau", "Jansen", "de Vries",
+		"Novak", "Horvat", "Kovacs", "Nowak", "Silva", "Santos", "Andersson", "Nielsen", "Murphy", "Kelly",
+	}
+	places = []struct{ city, state, country, postal string }{
+		{"New York", "NY", "USA", "100##"},
+		{"Chicago", "IL", "USA", "606##"},
+		{"Austin", "TX", "USA", "787##"},
+		{"Toronto", "ON", "Canada", "M5V ###"},
+		{"Vancouver", "BC", "Canada", "V6B ###"},
+		{"London", "", "United Kingdom", "SW1A #AA"},
+		{"Dublin", "", "Ireland", "D0# ###"},
+		{"Amsterdam", "", "Netherlands", "10## AB"},
+		{"Berlin", "", "Germany", "10###"},
+		{"Paris", "", "France", "750##"},
+		{"Milan", "", "Italy", "201##"},
+		{"Madrid", "", "Spain", "280##"},
+		{"Zagreb", "", "Croatia", "10###"},
+		{"Prague", "", "Czech Republic", "1## 00"},
+		{"Stockholm", "", "Sweden", "1## ##"},
+		{"Sao Paulo", "SP", "Brazil", "01###-000"},
+		{"Sydney", "NSW", "Australia", "2###"},
+	}
+	streets = []string{
+		"Main Street", "Oak Avenue", "Maple Road", "Park Lane", "Station Road", "High Street",
+		"Church Street", "Mill Lane", "River Road", "Elm Street", "Kings Road", "Harbour Way",
+	}
+	emailDomains = []string{"gmail.com", "yahoo.com", "outlook.com", "proton.me", "example.com"}
+	companies    = []string{
+		"Acme Corp", "Globex", "Initech", "Umbrella Music", "Stark Records", "Wayne Media",
+		"Soylent Sound", "Hooli", "Vandelay Industries", "Massive Dynamic",
+	}
+	jobTitles = []string{
+		"Sales Support Agent", "Sales Manager", "IT Staff", "IT Manager", "General Manager",
+		"Account Executive", "Marketing Specialist", "Customer Success Lead",
+	}
+	titleAdjectives = []string{
+		"Electric", "Silent", "Golden", "Broken", "Midnight", "Wild", "Velvet", "Crimson", "Lonely", "Endless",
+		"Neon", "Paper", "Burning", "Frozen", "Hidden", "Restless", "Blue", "Sweet", "Savage", "Distant",
+	}
+	titleNouns = []string{
+		"Heart", "Highway", "Dreams", "River", "Fire", "Moon", "Stranger", "Garden", "Thunder", "Echoes",
+		"Paradise", "Shadows", "Machine", "Horizon", "Rain", "City", "Summer", "Ghost", "Kingdom", "Waves",
+	}
+	bandNouns = []string{
+		"Wolves", "Kings", "Rebels", "Saints", "Pilots", "Strangers", "Lions", "Ravens", "Giants", "Monks",
+	}
+)
+
+func pick(r *rand.Rand, values []string) string {
+	return values[r.IntN(len(values))]
+}
+
+func randomDigits(r *rand.Rand, pattern string) string {
+	var b strings.Builder
+	for _, c := range pattern {
+		if c == '#' {
+			b.WriteByte(byte('0' + r.IntN(10)))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+type person struct {
+	firstName, lastName, email string
+}
+
+func realisticPerson(r *rand.Rand) person {
+	first, last := pick(r, firstNames), pick(r, lastNames)
+	local := strings.ToLower(strings.ReplaceAll(first+"."+last, " ", ""))
+	return person{
+		firstName: first,
+		lastName:  last,
+		email:     fmt.Sprintf("%s%d@%s", local, r.IntN(100), pick(r, emailDomains)),
+	}
+}
+
+type address struct {
+	street, city, state, country, postalCode string
+}
+
+func realisticAddress(r *rand.Rand) address {
+	p := places[r.IntN(len(places))]
+	return address{
+		street:     fmt.Sprintf("%d %s", 1+r.IntN(999), pick(r, streets)),
+		city:       p.city,
+		state:      p.state,
+		country:    p.country,
+		postalCode: randomDigits(r, p.postal),
+	}
+}
+
+func realisticPhone(r *rand.Rand) string {
+	return randomDigits(r, "+1 (###) ###-####")
+}
+
+func realisticArtistName(r *rand.Rand) string {
+	switch r.IntN(3) {
+	case 0:
+		return pick(r, firstNames) + " " + pick(r, lastNames)
+	case 1:
+		return "The " + pick(r, titleAdjectives) + " " + pick(r, bandNouns)
+	default:
+		return pick(r, titleNouns) + " " + pick(r, bandNouns)
+	}
+}
+
+func realisticTitle(r *rand.Rand) string {
+	switch r.IntN(3) {
+	case 0:
+		return pick(r, titleAdjectives) + " " + pick(r, titleNouns)
+	case 1:
+		return "The " + pick(r, titleNouns) + " of " + pick(r, titleNouns)
+	default:
+		return pick(r, titleNouns)
+	}
+}
+
+type track struct {
+	name, composer string
+	milliseconds   int
+	bytes          int
+	unitPrice      float64
+}
+
+func realisticTrack(r *rand.Rand) track {
+	ms := 120000 + r.IntN(300000)
+	price := 0.99
+	if r.IntN(10) == 0 {
+		price = 1.99
+	}
+	return track{
+		name:         realisticTitle(r),
+		composer:     pick(r, firstNames) + " " + pick(r, lastNames),
+		milliseconds: ms,
+		bytes:        ms * 32,
+		unitPrice:    price,
+	}
+}
+
+// sampleIDExpr returns a subquery picking an existing id from table using
+// the primary key index, instead of a full ORDER BY random() scan. The id
+// is picked between the lowest and the highest following keys.
+func sampleIDExpr(r *rand.Rand, keys keyDistribution, schema, table, column string) string {
+	t := qualifiedTable(schema, table)
+	fraction := keys.sqlFraction(r, fmt.Sprintf("(MAX(%[1]s) - MIN(%[1]s) + 1)", column))
+	return fmt.Sprintf(`(SELECT %[2]s FROM %[1]s WHERE %[2]s >= (SELECT MIN(%[2]s) + floor(%[3]s * (MAX(%[2]s) - MIN(%[2]s) + 1))::int FROM %[1]s) ORDER BY %[2]s LIMIT 1)`, t, column, fraction)
+}
+
+func randomDate(r *rand.Rand, fromYear, toYear int) time.Time {
+	return time.Date(fromYear+r.IntN(toYear-fromYear+1), time.Month(1+r.IntN(12)), 1+r.IntN(28), 0, 0, 0, 0, time.UTC)
+}
+
+// textValues returns the function giving the text values of the columns of
+// table: the generated value, made dirty by dirt and then shaped by
+// columns, so that dirty values count towards the cardinality.
+func textValues(r *rand.Rand, table string, columns *columnValues, dirt *dirtyData) func(column, value string) string {
+	return func(column, value string) string {
+		return columns.shape(r, table, column, dirt.apply(r, value, textColumns[table+"."+column]))
+	}
+}
+
+// realisticTasks returns insert tasks producing plausible content for the
+// artist, album, track, employee and customer tables. Tables without an
+// identity column get the next id from MAX(id), which is safe because each
+// of them has a single worker, see validateConfig. Each task draws from its
+// own stream of seed, and picks the rows it references following keys. exec
+// gets the qualified table and its key column along with the insert. dirt
+// and columns shape the generated text values, see textValues, and orphans
+// breaks some of the references.
+func realisticTasks(exec func(table, key, query string, args ...any) error, schemas []string, seed uint64, keys keyDistribution, columns *columnValues, dirt *dirtyData, orphans *orphanInjector) map[string]func() error {
+	return map[string]func() error{
+		"artist": withRand(seed, "artist", func(r *rand.Rand) error {
+			table := qualifiedTable(pickSchema(r, schemas), "artist")
+			return exec(table, "artist_id", fmt.Sprintf(`INSERT INTO %s (name) VALUES ($1)`, table), textValues(r, "artist", columns, dirt)("name", realisticArtistName(r)))
+		}),
+		"album": withRand(seed, "album", func(r *rand.Rand) error {
+			schema := pickSchema(r, schemas)
+			return exec(qualifiedTable(schema, "album"), "album_id", fmt.Sprintf(`INSERT INTO %s (album_id, title, artist_id)
+				SELECT COALESCE(MAX(album_id), 0) + 1, $1, %s FROM %[1]s`,
+				qualifiedTable(schema, "album"), orphans.expr(r, "album", sampleIDExpr(r, keys, schema, "artist", "artist_id"))),
+				textValues(r, "album", columns, dirt)("title", realisticTitle(r)))
+		}),
+		"track": withRand(seed, "track", func(r *rand.Rand) error {
+			schema := pickSchema(r, schemas)
+			t, v := realisticTrack(r), textValues(r, "track", columns, dirt)
+			return exec(qualifiedTable(schema, "track"), "track_id", fmt.Sprintf(`INSERT INTO %s (track_id, name, album_id, media_type_id, genre_id, composer, milliseconds, bytes, unit_price)
+				SELECT COALESCE(MAX(track_id), 0) + 1, $1, %s, %s, %s, $2, $3, $4, $5 FROM %[1]s`,
+				qualifiedTable(schema, "track"),
+				orphans.expr(r, "track", sampleIDExpr(r, keys, schema, "album", "album_id")),
+				sampleIDExpr(r, keys, schema, "media_type", "media_type_id"),
+				sampleIDExpr(r, keys, schema, "genre", "genre_id")),
+				v("name", t.name), v("composer", t.composer), t.milliseconds, t.bytes, t.unitPrice)
+		}),
+		"employee": withRand(seed, "employee", func(r *rand.Rand) error {
+			table := qualifiedTable(pickSchema(r, schemas), "employee")
+			p, a, v := realisticPerson(r), realisticAddress(r), textValues(r, "employee", columns, dirt)
+			return exec(table, "employee_id", fmt.Sprintf(`INSERT INTO %s (last_name, first_name, title, birth_date, hire_date, address, city, state, country, postal_code, phone, fax, email)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, table),
+				v("last_name", p.lastName), v("first_name", p.firstName), v("title", pick(r, jobTitles)), randomDate(r, 1960, 2000), randomDate(r, 2005, 2024),
+				v("address", a.street), v("city", a.city), v("state", a.state), v("country", a.country), v("postal_code", a.postalCode),
+				v("phone", realisticPhone(r)), v("fax", realisticPhone(r)), v("email", p.email))
+		}),
+		"customer": withRand(seed, "customer", func(r *rand.Rand) error {
+			schema := pickSchema(r, schemas)
+			p, a, v := realisticPerson(r), realisticAddress(r), textValues(r, "customer", columns, dirt)
+			return exec(qualifiedTable(schema, "customer"), "customer_id", fmt.Sprintf(`INSERT INTO %s (customer_id, first_name, last_name, company, address, city, state, country, postal_code, phone, email, support_rep_id)
+				SELECT COALESCE(MAX(customer_id), 0) + 1, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, %s FROM %[1]s`,
+				qualifiedTable(schema, "customer"), orphans.expr(r, "customer", sampleIDExpr(r, keys, schema, "employee", "employee_id"))),
+				v("first_name", p.firstName), v("last_name", p.lastName), v("company", pick(r, companies)), v("address", a.street),
+				v("city", a.city), v("state", a.state), v("country", a.country), v("postal_code", a.postalCode), v("phone", realisticPhone(r)), v("email", p.email))
+		}),
+	}
+}
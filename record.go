@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recordedStatement is one line of a recording file.
+type recordedStatement struct {
+	// At is the time since the start of the recording.
+	At time.Duration `json:"at"`
+	// Session is the backend pid the statement ran on, so statements of a
+	// transaction are replayed on the same connection.
+	Session uint32 `json:"session"`
+	SQL     string `json:"sql"`
+	Args    []any  `json:"args,omitempty"`
+}
+
+// statementRecorder is a pgx query tracer writing every statement issued
+// through the pool to a file as JSON lines.
+type statementRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	enc     *json.Encoder
+	started time.Time
+	err     error
+}
+
+func newStatementRecorder(path string) (*statementRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating record file failed: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	return &statementRecorder{file: file, w: w, enc: json.NewEncoder(w), started: time.Now()}, nil
+}
+
+// attach installs the recorder on a pool configuration.
+func (r *statementRecorder) attach(cfg *pgxpool.Config) {
+	cfg.ConnConfig.Tracer = r
+}
+
+func (r *statementRecorder) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	args := make([]any, len(data.Args))
+	for i, arg := range data.Args {
+		// Times are recorded as text, the server parses them back when
+		// they are replayed as literals.
+		if t, ok := arg.(time.Time); ok {
+			arg = t.Format(time.RFC3339Nano)
+		}
+		args[i] = arg
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return ctx
+	}
+	r.err = r.enc.Encode(recordedStatement{
+		At:      time.Since(r.started),
+		Session: conn.PgConn().PID(),
+		SQL:     data.SQL,
+		Args:    args,
+	})
+	if r.err != nil {
+		fmt.Println("Error recording statements, recording stopped:", r.err)
+	}
+	return ctx
+}
+
+func (r *statementRecorder) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+}
+
+func (r *statementRecorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.w.Flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// replay runs the statements of a recording against pool. Each recorded
+// session is replayed in order on its own connection, so transactions stay
+// intact. Statements are issued at their recorded time divided by speed,
+// or as fast as possible when speed is 0.
+func replay(ctx context.Context, pool *pgxpool.Pool, path string, speed float64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening record file failed: %w", err)
+	}
+	defer file.Close()
+
+	var wg sync.WaitGroup
+	var statements, failures atomic.Uint64
+	sessions := map[uint32]chan recordedStatement{}
+	defer func() {
+		for _, ch := range sessions {
+			close(ch)
+		}
+		wg.Wait()
+	}()
+
+	session := func(id uint32) (chan recordedStatement, error) {
+		if ch, ok := sessions[id]; ok {
+			return ch, nil
+		}
+		conn, err := pgx.ConnectConfig(ctx, pool.Config().ConnConfig.Copy())
+		if err != nil {
+			return nil, fmt.Errorf("connecting replay session failed: %w", err)
+		}
+		ch := make(chan recordedStatement, 1024)
+		sessions[id] = ch
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close(context.WithoutCancel(ctx))
+			for st := range ch {
+				// Arguments are sent as literals, letting the server convert
+				// the JSON decoded values to the column types.
+				args := append([]any{pgx.QueryExecModeSimpleProtocol}, st.Args...)
+				if _, err := conn.Exec(ctx, st.SQL, args...); err != nil {
+					failures.Add(1)
+					if ctx.Err() == nil {
+						fmt.Printf("Error replaying statement of session %d: %v\n", id, err)
+					}
+				}
+				statements.Add(1)
+			}
+		}()
+		return ch, nil
+	}
+
+	fmt.Printf("Replaying %s at speed %g...\n", path, speed)
+	dec := json.NewDecoder(bufio.NewReader(file))
+	dec.UseNumber()
+	start := time.Now()
+	var last time.Duration
+	for {
+		var st recordedStatement
+		if err := dec.Decode(&st); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading record file failed: %w", err)
+		}
+		for i, arg := range st.Args {
+			if n, ok := arg.(json.Number); ok {
+				st.Args[i] = n.String()
+			}
+		}
+
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(st.At) / speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		ch, err := session(st.Session)
+		if err != nil {
+			return err
+		}
+		select {
+		case ch <- st:
+		case <-ctx.Done():
+			return nil
+		}
+		last = st.At
+	}
+
+	replayed := len(sessions)
+	for _, ch := range sessions {
+		close(ch)
+	}
+	wg.Wait()
+	clear(sessions)
+
+	fmt.Printf("Replay completed: %d statements on %d sessions, %d failed, took %s (recorded %s)\n",
+		statements.Load(), replayed, failures.Load(), time.Since(start).Round(time.Millisecond), last.Round(time.Millisecond))
+	return nil
+}
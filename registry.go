@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// managedObject is a database object created by this tool. Objects are
+// recorded in the demo_db_objects registry so they can be listed and
+// cleaned up later.
+type managedObject struct {
+	Kind   string
+	Schema string
+	Name   string
+}
+
+func ensureRegistry(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS demo_db_objects (
+		kind TEXT NOT NULL,
+		schema_name TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		registered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (kind, schema_name, name)
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating demo_db_objects table failed: %w", err)
+	}
+	return nil
+}
+
+func registerObjects(ctx context.Context, pool *pgxpool.Pool, objects ...managedObject) error {
+	if err := ensureRegistry(ctx, pool); err != nil {
+		return err
+	}
+	for _, o := range objects {
+		_, err := pool.Exec(ctx, `INSERT INTO demo_db_objects (kind, schema_name, name) VALUES ($1, $2, $3)
+			ON CONFLICT (kind, schema_name, name) DO UPDATE SET registered_at = NOW()`, o.Kind, o.Schema, o.Name)
+		if err != nil {
+			return fmt.Errorf("registering %s %s failed: %w", o.Kind, o.Name, err)
+		}
+	}
+	return nil
+}
+
+// registerSchemaObjects records the demo tables, their indexes and, in
+// multi-tenant mode, the tenant schemas.
+func registerSchemaObjects(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	var objects []managedObject
+	for _, schema := range workloadSchemas(cfg) {
+		if schema != "" {
+			objects = append(objects, managedObject{Kind: "schema", Name: schema})
+		}
+
+		rows, err := pool.Query(ctx, `SELECT schemaname, tablename FROM pg_tables
+			WHERE tablename = ANY($1) AND schemaname = COALESCE(NULLIF($2, ''), current_schema())`, demoTables, schema)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var o managedObject
+			if err := rows.Scan(&o.Schema, &o.Name); err != nil {
+				rows.Close()
+				return err
+			}
+			o.Kind = "table"
+			objects = append(objects, o)
+		}
+		rows.Close()
+
+		rows, err = pool.Query(ctx, `SELECT schemaname, indexname FROM pg_indexes
+			WHERE tablename = ANY($1) AND schemaname = COALESCE(NULLIF($2, ''), current_schema())`, demoTables, schema)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var o managedObject
+			if err := rows.Scan(&o.Schema, &o.Name); err != nil {
+				rows.Close()
+				return err
+			}
+			o.Kind = "index"
+			objects = append(objects, o)
+		}
+		rows.Close()
+	}
+	return registerObjects(ctx, pool, objects...)
+}
+
+// objectExistsQuery checks whether a registered object is still present.
+const objectExistsQuery = `SELECT CASE $1
+	WHEN 'schema' THEN EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $3)
+	WHEN 'database' THEN EXISTS (SELECT 1 FROM pg_database WHERE datname = $3)
+	WHEN 'role' THEN EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $3)
+	WHEN 'extension' THEN EXISTS (SELECT 1 FROM pg_extension WHERE extname = $3)
+	WHEN 'statistics' THEN EXISTS (SELECT 1 FROM pg_statistic_ext WHERE stxname = $3)
+	WHEN 'server' THEN EXISTS (SELECT 1 FROM pg_foreign_server WHERE srvname = $3)
+	WHEN 'publication' THEN EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $3)
+	WHEN 'subscription' THEN EXISTS (SELECT 1 FROM pg_subscription WHERE subname = $3)
+	ELSE to_regclass(quote_ident(COALESCE(NULLIF($2, ''), current_schema())) || '.' || quote_ident($3)) IS NOT NULL
+END`
+
+// objectExists reports whether a registered object is still present.
+// pg_cron jobs are looked up only when the cron schema exists, as queries
+// on its tables would fail otherwise.
+func objectExists(ctx context.Context, pool *pgxpool.Pool, o managedObject) (bool, error) {
+	var present bool
+	if o.Kind == "cron job" {
+		if err := pool.QueryRow(ctx, `SELECT to_regclass('cron.job') IS NOT NULL`).Scan(&present); err != nil || !present {
+			return false, err
+		}
+		err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM cron.job WHERE jobname = $1)`, o.Name).Scan(&present)
+		return present, err
+	}
+	err := pool.QueryRow(ctx, objectExistsQuery, o.Kind, o.Schema, o.Name).Scan(&present)
+	return present, err
+}
+
+// listObjects prints the objects in the registry and whether they still
+// exist in the target database.
+func listObjects(ctx context.Context, pool *pgxpool.Pool) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('demo_db_objects') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		fmt.Println("No objects registered, demo_db_objects does not exist in this database.")
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, `SELECT kind, schema_name, name, registered_at FROM demo_db_objects ORDER BY kind, schema_name, name`)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		managedObject
+		registeredAt time.Time
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.Kind, &e.Schema, &e.Name, &e.registeredAt); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%-12s %-15s %-40s %-8s %s\n", "KIND", "SCHEMA", "NAME", "STATUS", "REGISTERED")
+	for _, e := range entries {
+		present, err := objectExists(ctx, pool, e.managedObject)
+		if err != nil {
+			return fmt.Errorf("checking %s %s failed: %w", e.Kind, e.Name, err)
+		}
+		status := "present"
+		if !present {
+			status = "missing"
+		}
+		fmt.Printf("%-12s %-15s %-40s %-8s %s\n", e.Kind, e.Schema, e.Name, status, e.registeredAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// dropRegisteredObjects drops the views, sequences, functions, extended
+// statistics, foreign data wrapper and logical replication objects and
+// pg_cron jobs recorded in the registry and removes them from it.
+func dropRegisteredObjects(ctx context.Context, pool *pgxpool.Pool) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('demo_db_objects') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, `SELECT kind, schema_name, name FROM demo_db_objects
+		WHERE kind IN ('view', 'materialized view', 'sequence', 'function', 'statistics', 'foreign table', 'server', 'publication', 'subscription', 'cron job') ORDER BY kind`)
+	if err != nil {
+		return err
+	}
+	var objects []managedObject
+	for rows.Next() {
+		var o managedObject
+		if err := rows.Scan(&o.Kind, &o.Schema, &o.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		if o.Kind == "cron job" {
+			present, err := objectExists(ctx, pool, o)
+			if err == nil && present {
+				_, err = pool.Exec(ctx, `SELECT cron.unschedule($1)`, o.Name)
+			}
+			if err != nil {
+				return fmt.Errorf("unscheduling cron job %s failed: %w", o.Name, err)
+			}
+		} else {
+			query := fmt.Sprintf("DROP %s IF EXISTS %s CASCADE", strings.ToUpper(o.Kind), qualifiedTable(o.Schema, o.Name))
+			if _, err := pool.Exec(ctx, query); err != nil {
+				return fmt.Errorf("dropping %s %s failed: %w", o.Kind, o.Name, err)
+			}
+		}
+		if _, err := pool.Exec(ctx, `DELETE FROM demo_db_objects WHERE kind = $1 AND schema_name = $2 AND name = $3`, o.Kind, o.Schema, o.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Dropped %s %s (if existed)\n", o.Kind, o.Name)
+	}
+	return nil
+}
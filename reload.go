@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// modeSwitch holds the mode of the main tables inserts, which a config
+// reload can switch while the workers run.
+type modeSwitch struct {
+	mu       sync.Mutex
+	mode     string
+	changed  chan struct{}
+	onSwitch func(mode string)
+}
+
+func newModeSwitch(mode string, onSwitch func(mode string)) *modeSwitch {
+	return &modeSwitch{mode: mode, changed: make(chan struct{}), onSwitch: onSwitch}
+}
+
+func (m *modeSwitch) current() (string, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode, m.changed
+}
+
+// set switches to mode, waking up the workers waiting for it.
+func (m *modeSwitch) set(mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mode == m.mode {
+		return
+	}
+	m.mode = mode
+	if m.onSwitch != nil {
+		m.onSwitch(mode)
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// task returns a task running the task of the current mode in tasks. A
+// table without a task in the current mode, like customer in the
+// gibberish mode, waits until the mode is switched or ctx is done.
+func (m *modeSwitch) task(ctx context.Context, tasks map[string]task) task {
+	return func() (outcome, error) {
+		for {
+			mode, changed := m.current()
+			if t := tasks[mode]; t != nil {
+				return t()
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return outcome{}, nil
+			}
+		}
+	}
+}
+
+// mainTableWorkers are the names of the workers of the main tables
+// inserts, in either mode.
+var mainTableWorkers = []string{"artist", "album", "track", "genre", "media_type", "playlist", "playlist_track", "employee", "customer"}
+
+// reloadableWorkload is a workload whose enabled flag and rate are applied
+// to its running workers when the config is reloaded.
+type reloadableWorkload struct {
+	key     string
+	workers []string
+	enabled func(cfg *InserterConfig) bool
+	// rate returns the rate of the workers, nil for workloads without one.
+	rate func(cfg *InserterConfig) float64
+}
+
+var reloadableWorkloads = []reloadableWorkload{
+	{"inserter.timestamp_inserts", []string{"timestamp"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.TimestampInserts.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.TimestampInserts.RatePerSecond }},
+	{"inserter.bigtable_inserts", []string{"bigtable"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.BigTableInserts.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.BigTableInserts.RatePerSecond }},
+	{"inserter.main_tables_inserts", mainTableWorkers,
+		func(cfg *InserterConfig) bool { return cfg.Inserter.MainTablesInserts.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.MainTablesInserts.RatePerSecond }},
+	{"inserter.history", []string{"history"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.History.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.History.RatePerSecond }},
+	{"inserter.large_payloads", []string{"large_payloads"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.LargePayloads.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.LargePayloads.RatePerSecond }},
+	{"inserter.ttl", []string{"ttl"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.TTL.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.TTL.RatePerSecond }},
+	{"inserter.ttl", []string{"ttl_expire", "ttl_purge"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.TTL.Enabled }, nil},
+	{"inserter.connection_churn", []string{"connection_churn"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.ConnectionChurn.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.ConnectionChurn.RatePerSecond }},
+	{"inserter.idle_in_transaction", []string{"idle_in_transaction"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.IdleInTransaction.Enabled }, nil},
+	{"inserter.deadlocks", []string{"deadlock"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.Deadlocks.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.Deadlocks.RatePerSecond }},
+	{"inserter.prepared_transactions", []string{"prepared_transactions"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.PreparedTransactions.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.PreparedTransactions.RatePerSecond }},
+	{"inserter.cascade_deletes", []string{"cascade_insert"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.CascadeDeletes.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.CascadeDeletes.RatePerSecond }},
+	{"inserter.cascade_deletes", []string{"cascade_child"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.CascadeDeletes.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.CascadeDeletes.ChildRatePerSecond }},
+	{"inserter.cascade_deletes", []string{"cascade_delete"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.CascadeDeletes.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.CascadeDeletes.DeleteRatePerSecond }},
+	{"inserter.work_mem_stress", []string{"work_mem_stress"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.WorkMemStress.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.WorkMemStress.RatePerSecond }},
+	{"inserter.long_queries", []string{"long_queries"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.LongQueries.Enabled }, nil},
+	{"inserter.read_workload", []string{"read"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.ReadWorkload.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.ReadWorkload.RatePerSecond }},
+	{"inserter.mixed_workload", []string{"mixed"},
+		func(cfg *InserterConfig) bool { return cfg.Inserter.MixedWorkload.Enabled },
+		func(cfg *InserterConfig) float64 { return cfg.Inserter.MixedWorkload.RatePerSecond }},
+}
+
+// controlsOf returns the controls of the workers among names that were
+// started, by name.
+func (e *workerEngine) controlsOf(names []string) map[string]*workerControl {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	controls := map[string]*workerControl{}
+	for _, name := range names {
+		if c, ok := e.controls[name]; ok {
+			controls[name] = c
+		}
+	}
+	return controls
+}
+
+// configReloader applies a reloaded config to the running workers, without
+// restarting them: disabled workloads are paused and enabled ones resumed,
+// rates are replaced and the main tables switch their mode. Only the
+// settings that changed since the last config are applied, so pauses and
+// rates set through the control API survive reloads that leave them alone.
+type configReloader struct {
+	engine *workerEngine
+	mode   *modeSwitch
+	cfg    *InserterConfig
+}
+
+func (r *configReloader) apply(next *InserterConfig) {
+	prev := r.cfg
+	changes := 0
+	notStarted := map[string]bool{}
+	for _, w := range reloadableWorkloads {
+		controls := r.engine.controlsOf(w.workers)
+		names := slices.Sorted(maps.Keys(controls))
+		was, is := w.enabled(prev), w.enabled(next)
+		if len(controls) == 0 {
+			if is && !was && !notStarted[w.key] {
+				notStarted[w.key] = true
+				fmt.Printf("Reload: %s enabled, but its workers only start with a run, restart to start them\n", w.key)
+				changes++
+			}
+			continue
+		}
+		if was != is {
+			for _, c := range controls {
+				if is {
+					c.resume()
+				} else {
+					c.pause()
+				}
+			}
+			action := "pausing"
+			if is {
+				action = "resuming"
+			}
+			fmt.Printf("Reload: %s enabled=%t, %s %v\n", w.key, is, action, names)
+			changes++
+		}
+		if w.rate == nil {
+			continue
+		}
+		if rate := w.rate(next); rate != w.rate(prev) {
+			// The workers keep sharing one limiter, as when they started.
+			limiter := newRateLimiter(rate)
+			for _, c := range controls {
+				c.setLimiter(limiter)
+			}
+			fmt.Printf("Reload: rate of %v set to %g per second\n", names, rate)
+			changes++
+		}
+	}
+	if mode := next.Inserter.MainTablesInserts.Mode; r.mode != nil && mode != prev.Inserter.MainTablesInserts.Mode {
+		r.mode.set(mode)
+		fmt.Printf("Reload: main tables switched to %s\n", mode)
+		changes++
+	}
+	if changes == 0 {
+		fmt.Println("Reload: no changes to enabled flags, rates or modes")
+	}
+	r.cfg = next
+}
+
+// watchReloads reloads the config with load on every SIGHUP until ctx is
+// done. A config that fails to load or validate is ignored, keeping the
+// current settings.
+func watchReloads(ctx context.Context, r *configReloader, load func() (*InserterConfig, error)) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+		}
+		sdNotify("RELOADING=1")
+		next, err := load()
+		if err != nil {
+			fmt.Println("Error reloading config, keeping the current settings:", err)
+		} else {
+			r.apply(next)
+		}
+		sdNotify("READY=1")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// conninfoValue quotes a value of a libpq key/value connection string.
+func conninfoValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// publisherConninfo returns the connection string the subscriber uses to
+// reach the configured database, replication.publisher_conninfo when set.
+func publisherConninfo(cfg *InserterConfig) string {
+	if cfg.Replication.PublisherConninfo != "" {
+		return cfg.Replication.PublisherConninfo
+	}
+	return fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s", conninfoValue(cfg.Host), conninfoValue(cfg.Port),
+		conninfoValue(cfg.Database), conninfoValue(cfg.Username), conninfoValue(cfg.Password))
+}
+
+// tableCounts returns the number of rows of each demo table.
+func tableCounts(ctx context.Context, pool *pgxpool.Pool) (map[string]int64, error) {
+	counts := make(map[string]int64, len(demoTables))
+	for _, table := range demoTables {
+		var n int64
+		if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+pgx.Identifier{table}.Sanitize()).Scan(&n); err != nil {
+			return nil, fmt.Errorf("counting rows of %s failed: %w", table, err)
+		}
+		counts[table] = n
+	}
+	return counts, nil
+}
+
+// setupSubscriber creates the demo tables in the database of pool, unless
+// they exist and are empty, and subscribes it to the publication.
+func setupSubscriber(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, publication, subscription string) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_subscription WHERE subname = $1)`, subscription).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		fmt.Printf("Subscription %s already exists on the subscriber, keeping it\n", subscription)
+		return nil
+	}
+
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('"timestamp"') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		counts, err := tableCounts(ctx, pool)
+		if err != nil {
+			return err
+		}
+		for _, table := range demoTables {
+			if counts[table] > 0 {
+				return fmt.Errorf("table %s of the subscriber has %d rows, the initial copy needs empty tables", table, counts[table])
+			}
+		}
+	} else {
+		if err := executeSqlFiles(ctx, pool, embeddedSqlFiles, []string{"00-create-tables.sql"}); err != nil {
+			return fmt.Errorf("creating the tables on the subscriber failed: %w", err)
+		}
+		// The tables were created in the default schema.
+		if err := registerSchemaObjects(ctx, &InserterConfig{}, pool); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf("CREATE SUBSCRIPTION %s CONNECTION %s PUBLICATION %s", pgx.Identifier{subscription}.Sanitize(),
+		quoteLiteral(publisherConninfo(cfg)), pgx.Identifier{publication}.Sanitize())
+	if _, err := pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("creating subscription %s failed: %w", subscription, err)
+	}
+	fmt.Printf("Created subscription %s to publication %s\n", subscription, publication)
+	return registerObjects(ctx, pool, managedObject{Kind: "subscription", Name: subscription})
+}
+
+// runReplicationDemo publishes the demo tables of the configured database,
+// subscribes the database at replication.subscriber_url to them, inserts
+// rows for a while and waits until the subscriber has all of them.
+func runReplicationDemo(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	repl := cfg.Replication
+	if repl.SubscriberURL == "" {
+		return fmt.Errorf("replication.subscriber_url is required")
+	}
+	publication, subscription := repl.Publication, repl.Subscription
+	if publication == "" {
+		publication = "demo_db_pub"
+	}
+	if subscription == "" {
+		subscription = "demo_db_sub"
+	}
+
+	var walLevel string
+	if err := pool.QueryRow(ctx, "SHOW wal_level").Scan(&walLevel); err != nil {
+		return err
+	}
+	if walLevel != "logical" {
+		return fmt.Errorf("wal_level of the publisher is %s, logical replication needs wal_level = logical", walLevel)
+	}
+
+	subscriber := *cfg
+	// The subscriber URL carries its own TLS settings.
+	var defaults InserterConfig
+	subscriber.TLS = defaults.TLS
+	if err := setConnectionURL(&subscriber, repl.SubscriberURL); err != nil {
+		return fmt.Errorf("replication.subscriber_url: %w", err)
+	}
+	if subscriber.Host == cfg.Host && subscriber.Port == cfg.Port && subscriber.Database == cfg.Database {
+		return fmt.Errorf("replication.subscriber_url points at the configured database")
+	}
+	subPool, err := connectPool(&subscriber)
+	if err != nil {
+		return fmt.Errorf("connecting to the subscriber failed: %w", err)
+	}
+	defer subPool.Close()
+
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)`, publication).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		fmt.Printf("Publication %s already exists, keeping it\n", publication)
+	} else {
+		query := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", pgx.Identifier{publication}.Sanitize(), joinIdentifiers(demoTables))
+		if _, err := pool.Exec(ctx, query); err != nil {
+			return fmt.Errorf("creating publication %s failed: %w", publication, err)
+		}
+		fmt.Printf("Created publication %s for %d tables\n", publication, len(demoTables))
+		if err := registerObjects(ctx, pool, managedObject{Kind: "publication", Name: publication}); err != nil {
+			return err
+		}
+	}
+	if err := setupSubscriber(ctx, cfg, subPool, publication, subscription); err != nil {
+		return err
+	}
+
+	duration := time.Duration(repl.DurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = 30 * time.Second
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	execCtx, cancelExec := statementContext(writeCtx, drainTimeout(cfg))
+	defer cancelExec()
+
+	fmt.Printf("Inserting into the publisher for %s...\n", duration)
+	stats := newRunStats()
+	engine := newWorkerEngine(writeCtx, stats, newRetryPolicy(cfg), nil)
+	engine.start(workerSpec{
+		name:        "timestamp",
+		description: "insert worker for table timestamp",
+		limiter:     newRateLimiter(repl.RatePerSecond),
+		newTask: func(int) task {
+			return insertTask(1, func() error {
+				_, err := pool.Exec(execCtx, `INSERT INTO "timestamp"(created_at) VALUES (NOW())`)
+				return err
+			})
+		},
+	})
+	engine.started()
+	engine.wait()
+	fmt.Println(stats.summary())
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return verifyReplication(ctx, pool, subPool, time.Duration(repl.VerifyTimeoutSeconds)*time.Second)
+}
+
+// verifyReplication waits until every demo table of the subscriber has as
+// many rows as on the publisher, or timeout passed.
+func verifyReplication(ctx context.Context, pub, sub *pgxpool.Pool, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	want, err := tableCounts(ctx, pub)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Waiting for the rows to arrive on the subscriber...")
+	started := time.Now()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		got, err := tableCounts(ctx, sub)
+		if err != nil {
+			return err
+		}
+		var missing []string
+		for _, table := range demoTables {
+			if got[table] != want[table] {
+				missing = append(missing, fmt.Sprintf("%s (%d of %d rows)", table, got[table], want[table]))
+			}
+		}
+		if len(missing) == 0 {
+			fmt.Printf("All rows arrived on the subscriber after %s\n", time.Since(started).Round(time.Millisecond))
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline.C:
+			return fmt.Errorf("rows did not arrive on the subscriber within %s: %s", timeout, strings.Join(missing, ", "))
+		case <-ticker.C:
+		}
+	}
+}
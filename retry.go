@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// retryPolicy decides how long a worker waits after a failed statement.
+// Waits grow exponentially from initial up to max, and a worker gives up
+// after maxAttempts consecutive failures, or never when it is zero.
+type retryPolicy struct {
+	initial, max time.Duration
+	maxAttempts  int
+}
+
+func newRetryPolicy(cfg *InserterConfig) retryPolicy {
+	p := retryPolicy{
+		initial:     time.Duration(cfg.Retry.InitialBackoffMs) * time.Millisecond,
+		max:         time.Duration(cfg.Retry.MaxBackoffMs) * time.Millisecond,
+		maxAttempts: cfg.Retry.MaxAttempts,
+	}
+	if p.initial <= 0 {
+		p.initial = 500 * time.Millisecond
+	}
+	if p.max <= 0 {
+		p.max = 30 * time.Second
+	}
+	return p
+}
+
+// backoff returns the wait after the given number of consecutive failures,
+// with up to 20% jitter so workers do not retry in lockstep.
+func (p retryPolicy) backoff(failures int) time.Duration {
+	d := p.initial
+	for i := 1; i < failures && d < p.max; i++ {
+		d *= 2
+	}
+	d = min(d, p.max)
+	return d - time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+func (p retryPolicy) exhausted(failures int) bool {
+	return p.maxAttempts > 0 && failures >= p.maxAttempts
+}
+
+// isFatal reports whether retrying err is pointless because it comes from
+// the schema, permissions or authentication rather than the server being
+// briefly unavailable or a conflict with another transaction.
+func isFatal(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(pgErr.Code, "42"), // syntax error or access rule violation
+		strings.HasPrefix(pgErr.Code, "28"), // invalid authorization
+		pgErr.Code == "3D000",               // invalid catalog name
+		pgErr.Code == "3F000":               // invalid schema name
+		return true
+	}
+	return false
+}
+
+// sleep waits for d and reports false when ctx was done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retry handles a failed attempt of a worker loop after failures
+// consecutive errors. It waits for the backoff and returns true when the
+// worker should try again, or false when the error is fatal, the attempts
+// are exhausted or ctx is done.
+func (p retryPolicy) retry(ctx context.Context, worker string, failures int, err error) bool {
+	if isFatal(err) {
+		fmt.Printf("Fatal error in %s, stopping it: %v\n", worker, err)
+		return false
+	}
+	if p.exhausted(failures) {
+		fmt.Printf("Giving up %s after %d consecutive errors: %v\n", worker, failures, err)
+		return false
+	}
+	d := p.backoff(failures)
+	fmt.Printf("Error in %s (attempt %d), retrying in %s: %v\n", worker, failures, d.Round(time.Millisecond), err)
+	return sleep(ctx, d)
+}
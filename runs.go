@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// configHash returns a short hash identifying the effective configuration
+// of a run. The password is left out so it never ends up in the database.
+func configHash(cfg *InserterConfig) string {
+	c := *cfg
+	c.Password = ""
+	content, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// recordRunStart creates the demo_db_runs control table if needed and
+// registers the run, so the load applied to a database stays visible in
+// the database itself.
+func recordRunStart(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, stats *runStats, action string) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS demo_db_runs (
+		run_id TEXT PRIMARY KEY,
+		action TEXT NOT NULL,
+		config_hash TEXT NOT NULL,
+		client_host TEXT,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ,
+		rows_inserted BIGINT,
+		errors BIGINT
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating demo_db_runs table failed: %w", err)
+	}
+	if err := registerObjects(ctx, pool, managedObject{Kind: "table", Name: "demo_db_runs"}); err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	_, err = pool.Exec(ctx, `INSERT INTO demo_db_runs (run_id, action, config_hash, client_host, started_at) VALUES ($1, $2, $3, $4, $5)`,
+		stats.runID, action, configHash(cfg), hostname, stats.started)
+	if err != nil {
+		return fmt.Errorf("recording run %s failed: %w", stats.runID, err)
+	}
+	return nil
+}
+
+func recordRunEnd(ctx context.Context, pool *pgxpool.Pool, stats *runStats) error {
+	inserts, errors := stats.totals()
+	_, err := pool.Exec(ctx, `UPDATE demo_db_runs SET finished_at = NOW(), rows_inserted = $2, errors = $3 WHERE run_id = $1`,
+		stats.runID, int64(inserts), int64(errors))
+	if err != nil {
+		return fmt.Errorf("recording end of run %s failed: %w", stats.runID, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// checkDestructiveAllowed refuses destructive actions unless the target is
+// recognisably a demo database: its name has to match the configured
+// pattern, and it either carries the demo_db_marker table created with the
+// schema, has no tables at all, or the config explicitly allows it.
+func checkDestructiveAllowed(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	if cfg.ReadOnly {
+		return fmt.Errorf("read_only is set, refusing destructive action")
+	}
+	if pattern := cfg.Safety.DatabaseNamePattern; pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid safety.database_name_pattern: %w", err)
+		}
+		if !re.MatchString(cfg.Database) {
+			return fmt.Errorf("database '%s' does not match safety.database_name_pattern '%s', refusing destructive action", cfg.Database, pattern)
+		}
+	}
+
+	if cfg.Safety.AllowDestructive {
+		return nil
+	}
+
+	var hasMarker, hasTables bool
+	err := pool.QueryRow(ctx, `SELECT
+		EXISTS (SELECT 1 FROM pg_tables WHERE tablename = 'demo_db_marker'),
+		EXISTS (SELECT 1 FROM pg_tables WHERE schemaname NOT IN ('pg_catalog', 'information_schema'))`).Scan(&hasMarker, &hasTables)
+	if err != nil {
+		return fmt.Errorf("checking for demo_db_marker failed: %w", err)
+	}
+	if hasMarker || !hasTables {
+		return nil
+	}
+	return fmt.Errorf("database '%s' has no demo_db_marker table and does not look like a demo database, set safety.allow_destructive to true to proceed", cfg.Database)
+}
+
+// readOnlyCommands are the commands allowed with read_only. insert and
+// scenario are only allowed when no writing workload is enabled.
+var readOnlyCommands = []string{"validate", "status", "list-objects", "dump", "insert", "scenario"}
+
+// writingWorkloads returns the config keys of the enabled workloads and
+// settings that write to the database.
+func writingWorkloads(cfg *InserterConfig) []string {
+	ins := cfg.Inserter
+	var names []string
+	for _, w := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"inserter.wal_switcher", ins.WalSwitcher.Enabled},
+		{"inserter.timestamp_inserts", ins.TimestampInserts.Enabled},
+		{"inserter.bigtable_inserts", ins.BigTableInserts.Enabled},
+		{"inserter.bulk_inserts", ins.BulkInserts.Enabled},
+		{"inserter.concurrent_indexes", ins.ConcurrentIndexes.Enabled},
+		{"inserter.schema_changes", ins.SchemaChanges.Enabled},
+		{"inserter.outbox", ins.Outbox.Enabled},
+		{"inserter.large_payloads", ins.LargePayloads.Enabled},
+		{"inserter.ttl", ins.TTL.Enabled},
+		{"inserter.idle_in_transaction", ins.IdleInTransaction.Enabled && ins.IdleInTransaction.Statement == "insert"},
+		{"inserter.deadlocks", ins.Deadlocks.Enabled},
+		{"inserter.prepared_transactions", ins.PreparedTransactions.Enabled},
+		{"inserter.history", ins.History.Enabled},
+		{"inserter.mixed_workload", ins.MixedWorkload.Enabled},
+		{"inserter.churn", ins.Churn.Enabled},
+		{"inserter.temp_table_churn", ins.TempTableChurn.Enabled},
+		{"inserter.work_mem_stress", ins.WorkMemStress.Enabled},
+		{"inserter.cascade_deletes", ins.CascadeDeletes.Enabled},
+		{"inserter.main_tables_inserts", ins.MainTablesInserts.Enabled},
+		{"partitioning", cfg.Partitioning.Enabled},
+		{"scheduler.persist_state", cfg.Scheduler.PersistState},
+		{"anomalies", len(cfg.Anomalies) > 0},
+	} {
+		if w.enabled {
+			names = append(names, w.name)
+		}
+	}
+	return names
+}
+
+// checkReadOnly refuses command when read_only is set and the command or
+// the workloads it would run write to the database. Connections are opened
+// with default_transaction_read_only as well, so the server refuses writes
+// that slip through.
+func checkReadOnly(cfg *InserterConfig, command string) error {
+	if !cfg.ReadOnly {
+		return nil
+	}
+	if !slices.Contains(readOnlyCommands, command) {
+		return fmt.Errorf("read_only is set, refusing to run %s, allowed commands are %v", command, readOnlyCommands)
+	}
+	if command == "insert" {
+		if names := writingWorkloads(cfg); len(names) > 0 {
+			return fmt.Errorf("read_only is set, refusing to run the writing workloads %s", strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// confirm asks question on stdin and reports whether it was answered with
+// yes. With --yes no question is asked. Without it, prompting is refused
+// when stdin is not a terminal, e.g. in CI pipelines or cron jobs, instead
+// of blocking or reading an answer nobody typed.
+func confirm(flags *CommandFlags, question string) (bool, error) {
+	if flags.Yes {
+		return true, nil
+	}
+	if flags.NoPrompt {
+		return false, fmt.Errorf("confirmation is not available when running as a service, pass --yes to proceed")
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("stdin is not a terminal, pass --yes to proceed without confirmation")
+	}
+
+	fmt.Printf("%s (yes/no): ", question)
+	input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	input = strings.TrimSpace(strings.ToLower(input))
+	return input == "yes" || input == "y", nil
+}
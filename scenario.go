@@ -0,0 +1,333 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// scenarioPhaseTypes are the kinds of phases of a scenario: seed recreates
+// the tables, ramp, steady and chaos run the insert workload and drain
+// leaves the database idle before printing its status.
+var scenarioPhaseTypes = []string{"seed", "ramp", "steady", "chaos", "drain"}
+
+// scenario is a timeline of phases run one after the other by the scenario
+// command, read from a JSON, YAML or TOML file or the scenario library.
+type scenario struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Settings override the configuration for all phases, before the
+	// settings of each phase.
+	Settings map[string]any  `json:"settings"`
+	Phases   []scenarioPhase `json:"phases"`
+}
+
+// scenarioLibrary holds the scenarios shipped with demo-db, selected by
+// their file name without extension.
+//
+//go:embed scenarios/*.yaml
+var scenarioLibrary embed.FS
+
+type scenarioPhase struct {
+	Name            string `json:"name"`
+	Type            string `json:"type"`
+	DurationSeconds int    `json:"duration_seconds"`
+	// Settings override the configuration for the phase, using the same
+	// keys as the config file, e.g. {"inserter": {"read_workload": ...}}.
+	Settings map[string]any `json:"settings"`
+	// Anomalies are injected during a chaos phase.
+	Anomalies []anomalySpec `json:"anomalies"`
+	// A ramp runs in steps, raising the rate_per_second of the inserters
+	// from from_percent of the configured rates to all of them.
+	FromPercent int `json:"from_percent"`
+	Steps       int `json:"steps"`
+	// Breakpoint pauses the scenario before the phase until the operator
+	// resumes it, printing the notes for the presenter.
+	Breakpoint bool   `json:"breakpoint"`
+	Notes      string `json:"notes"`
+}
+
+func (p scenarioPhase) title() string {
+	if p.Name != "" && p.Name != p.Type {
+		return fmt.Sprintf("%s (%s)", p.Name, p.Type)
+	}
+	return p.Type
+}
+
+// loadScenario reads the scenario file at path, in the format given by its
+// extension, or the scenario of the library called name.
+func loadScenario(path, name string) (*scenario, error) {
+	var file io.ReadCloser
+	format := "yaml"
+	var err error
+	switch {
+	case path != "" && name != "":
+		return nil, fmt.Errorf("scenario takes either -file or -name")
+	case path != "":
+		if format, err = configFormat(path, ""); err != nil {
+			return nil, err
+		}
+		if file, err = os.Open(path); err != nil {
+			return nil, fmt.Errorf("cannot open scenario file: %w", err)
+		}
+	case name != "":
+		if file, err = scenarioLibrary.Open("scenarios/" + name + ".yaml"); err != nil {
+			return nil, fmt.Errorf("unknown scenario '%s', must be one of %v", name, libraryScenarioNames())
+		}
+	default:
+		return nil, fmt.Errorf("scenario needs -file or -name, -list shows the scenarios of the library")
+	}
+	defer file.Close()
+
+	s, err := parseScenario(file, format)
+	if err != nil {
+		return nil, err
+	}
+	if s.Name == "" {
+		s.Name = cmp.Or(name, path)
+	}
+	return s, nil
+}
+
+// parseScenario decodes and checks a scenario.
+func parseScenario(r io.Reader, format string) (*scenario, error) {
+	var s scenario
+	if err := decodeConfig(r, format, &s); err != nil {
+		return nil, fmt.Errorf("cannot parse %s scenario: %w", format, err)
+	}
+	if len(s.Phases) == 0 {
+		return nil, fmt.Errorf("scenario %s has no phases", s.Name)
+	}
+	for i, p := range s.Phases {
+		switch p.Type {
+		case "seed", "drain":
+		case "ramp", "steady", "chaos":
+			if p.DurationSeconds <= 0 {
+				return nil, fmt.Errorf("phase %d (%s) needs a duration_seconds", i+1, p.title())
+			}
+		default:
+			return nil, fmt.Errorf("phase %d: invalid type '%s', must be one of %v", i+1, p.Type, scenarioPhaseTypes)
+		}
+		if p.Type == "chaos" && len(p.Anomalies) == 0 {
+			return nil, fmt.Errorf("phase %d (%s) needs at least one anomaly", i+1, p.title())
+		}
+		for j, spec := range p.Anomalies {
+			if err := spec.validate(); err != nil {
+				return nil, fmt.Errorf("phase %d (%s) anomalies[%d]: %w", i+1, p.title(), j, err)
+			}
+		}
+		if p.FromPercent < 0 || p.FromPercent > 100 || p.Steps < 0 {
+			return nil, fmt.Errorf("phase %d (%s): from_percent must be between 0 and 100 and steps must not be negative", i+1, p.title())
+		}
+	}
+	return &s, nil
+}
+
+// mergeSettings merges overrides into doc, replacing everything but nested
+// objects, which are merged key by key. Objects are copied, so overrides
+// are never modified by later merges.
+func mergeSettings(doc, overrides map[string]any) {
+	for key, value := range overrides {
+		if nested, ok := value.(map[string]any); ok {
+			current, ok := doc[key].(map[string]any)
+			if !ok {
+				current = map[string]any{}
+				doc[key] = current
+			}
+			mergeSettings(current, nested)
+			continue
+		}
+		doc[key] = value
+	}
+}
+
+// phaseConfig returns a copy of cfg with the settings of a scenario and a
+// phase applied, in order, and checked like a config file.
+func phaseConfig(cfg *InserterConfig, settings ...map[string]any) (*InserterConfig, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, overrides := range settings {
+		mergeSettings(doc, overrides)
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+
+	var phase InserterConfig
+	if err := json.Unmarshal(data, &phase); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	if err := validateConfig(&phase); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	return &phase, nil
+}
+
+// scaleRates multiplies the rate_per_second of every inserter by factor.
+// Inserters without a rate are not throttled and keep running at full
+// speed.
+func scaleRates(cfg *InserterConfig, factor float64) {
+	ins := &cfg.Inserter
+	for _, rate := range []*float64{
+		&ins.TimestampInserts.RatePerSecond,
+		&ins.BigTableInserts.RatePerSecond,
+		&ins.History.RatePerSecond,
+		&ins.LargePayloads.RatePerSecond,
+		&ins.TTL.RatePerSecond,
+		&ins.ConnectionChurn.RatePerSecond,
+		&ins.Deadlocks.RatePerSecond,
+		&ins.PreparedTransactions.RatePerSecond,
+		&ins.ReadWorkload.RatePerSecond,
+		&ins.MixedWorkload.RatePerSecond,
+		&ins.TempTableChurn.RatePerSecond,
+		&ins.WorkMemStress.RatePerSecond,
+		&ins.CascadeDeletes.RatePerSecond,
+		&ins.CascadeDeletes.ChildRatePerSecond,
+		&ins.CascadeDeletes.DeleteRatePerSecond,
+		&ins.MainTablesInserts.RatePerSecond,
+	} {
+		*rate *= factor
+	}
+}
+
+// runScenarioPhase runs one phase with its own configuration.
+func runScenarioPhase(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, p scenarioPhase) error {
+	duration := time.Duration(p.DurationSeconds) * time.Second
+	switch p.Type {
+	case "seed":
+		if err := checkDestructiveAllowed(ctx, cfg, pool); err != nil {
+			return err
+		}
+		return recreateTables(ctx, cfg, pool)
+
+	case "ramp":
+		steps := p.Steps
+		if steps <= 0 {
+			steps = 5
+		}
+		from := p.FromPercent
+		if from == 0 {
+			from = 10
+		}
+		step := duration / time.Duration(steps)
+		for i := range steps {
+			percent := 100.0
+			if steps > 1 {
+				percent = float64(from) + float64(100-from)*float64(i)/float64(steps-1)
+			}
+			stepCfg := *cfg
+			scaleRates(&stepCfg, percent/100)
+			stepCfg.Stop.DurationSeconds = max(int(step.Seconds()), 1)
+			fmt.Printf("Ramp step %d/%d at %.0f%% of the configured rates for %s\n", i+1, steps, percent, step)
+			runInsert(ctx, &stepCfg, pool, nil)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		return nil
+
+	case "steady", "chaos":
+		phaseCfg := *cfg
+		phaseCfg.Stop.DurationSeconds = p.DurationSeconds
+		phaseCfg.Anomalies = append(phaseCfg.Anomalies[:len(phaseCfg.Anomalies):len(phaseCfg.Anomalies)], p.Anomalies...)
+		runInsert(ctx, &phaseCfg, pool, nil)
+		return ctx.Err()
+
+	case "drain":
+		if duration > 0 {
+			fmt.Printf("Leaving the database idle for %s...\n", duration)
+			if !sleep(ctx, duration) {
+				return ctx.Err()
+			}
+		}
+		return printStatus(ctx, cfg, pool, false)
+	}
+	return nil
+}
+
+// libraryScenarioNames returns the names of the scenarios of the library.
+func libraryScenarioNames() []string {
+	files, _ := fs.Glob(scenarioLibrary, "scenarios/*.yaml")
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(path.Base(file), ".yaml")
+	}
+	return names
+}
+
+// listScenarios prints the scenarios of the library with their description.
+func listScenarios() error {
+	for _, name := range libraryScenarioNames() {
+		s, err := loadScenario("", name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-22s %s\n", name, s.Description)
+	}
+	return nil
+}
+
+// runScenario runs the phases of a scenario in order, stopping at the first
+// phase that fails or when ctx is done. Breakpoints are skipped when bp is
+// nil.
+func runScenario(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, s *scenario, bp *breakpoints) error {
+	// Check the settings of every phase before running the first one.
+	configs := make([]*InserterConfig, len(s.Phases))
+	for i, p := range s.Phases {
+		var err error
+		if configs[i], err = phaseConfig(cfg, s.Settings, p.Settings); err != nil {
+			return fmt.Errorf("phase %d (%s): %w", i+1, p.title(), err)
+		}
+		switch p.Type {
+		case "seed":
+			err = checkReadOnly(configs[i], "recreate")
+		case "ramp", "steady":
+			err = checkReadOnly(configs[i], "insert")
+		case "chaos":
+			phaseCfg := *configs[i]
+			phaseCfg.Anomalies = p.Anomalies
+			err = checkReadOnly(&phaseCfg, "insert")
+		}
+		if err != nil {
+			return fmt.Errorf("phase %d (%s): %w", i+1, p.title(), err)
+		}
+	}
+
+	name := s.Name
+	fmt.Printf("Running scenario %s, %d phases\n", name, len(s.Phases))
+	started := time.Now()
+	for i, p := range s.Phases {
+		if p.Breakpoint {
+			if err := bp.pause(ctx, p); err != nil {
+				fmt.Printf("Scenario %s interrupted at the breakpoint before %s\n", name, p.title())
+				return nil
+			}
+		}
+		fmt.Printf("\n=== Phase %d/%d: %s, started at %s ===\n", i+1, len(s.Phases), p.title(), time.Now().UTC().Format(time.RFC3339))
+		if err := runScenarioPhase(ctx, configs[i], pool, p); err != nil {
+			if ctx.Err() != nil {
+				fmt.Printf("Scenario %s interrupted in phase %s\n", name, p.title())
+				return nil
+			}
+			return fmt.Errorf("phase %d (%s) failed: %w", i+1, p.title(), err)
+		}
+	}
+	fmt.Printf("\nScenario %s completed in %s\n", name, time.Since(started).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// schedulerStore persists the position of interval based workers in the
+// demo_db_scheduler_state control table, so a restarted daemon waits for
+// the remainder of the current window instead of starting over. A nil
+// store disables persistence.
+type schedulerStore struct {
+	pool *pgxpool.Pool
+}
+
+func newSchedulerStore(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) (*schedulerStore, error) {
+	if !cfg.Scheduler.PersistState {
+		return nil, nil
+	}
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS demo_db_scheduler_state (
+		worker TEXT PRIMARY KEY,
+		last_run_at TIMESTAMPTZ NOT NULL,
+		rows_inserted BIGINT NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating scheduler state table failed: %w", err)
+	}
+	// Earlier versions named the column runs, although it held the rows
+	// inserted.
+	_, err = pool.Exec(ctx, `DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+			AND table_name = 'demo_db_scheduler_state' AND column_name = 'runs') THEN
+			ALTER TABLE demo_db_scheduler_state RENAME COLUMN runs TO rows_inserted;
+		END IF;
+	END $$`)
+	if err != nil {
+		return nil, fmt.Errorf("renaming the runs column of the scheduler state table failed: %w", err)
+	}
+	if err := registerObjects(ctx, pool, managedObject{Kind: "table", Name: "demo_db_scheduler_state"}); err != nil {
+		return nil, err
+	}
+	return &schedulerStore{pool: pool}, nil
+}
+
+// load returns the last run time of a worker and the rows it inserted so
+// far. The zero time is returned for workers that never ran.
+func (s *schedulerStore) load(ctx context.Context, worker string) (time.Time, uint64, error) {
+	if s == nil {
+		return time.Time{}, 0, nil
+	}
+	var lastRun time.Time
+	var rowsInserted int64
+	err := s.pool.QueryRow(ctx, `SELECT last_run_at, rows_inserted FROM demo_db_scheduler_state WHERE worker = $1`, worker).Scan(&lastRun, &rowsInserted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, 0, nil
+	}
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return lastRun, uint64(rowsInserted), nil
+}
+
+func (s *schedulerStore) save(ctx context.Context, worker string, lastRun time.Time, rowsInserted uint64) error {
+	if s == nil {
+		return nil
+	}
+	_, err := s.pool.Exec(ctx, `INSERT INTO demo_db_scheduler_state (worker, last_run_at, rows_inserted) VALUES ($1, $2, $3)
+		ON CONFLICT (worker) DO UPDATE SET last_run_at = EXCLUDED.last_run_at, rows_inserted = EXCLUDED.rows_inserted`,
+		worker, lastRun, int64(rowsInserted))
+	return err
+}
+
+// resumeDelay returns how long a worker has to wait before its next run
+// given the time of its last persisted run.
+func resumeDelay(lastRun time.Time, interval time.Duration) time.Duration {
+	if lastRun.IsZero() || interval <= 0 {
+		return 0
+	}
+	return max(time.Until(lastRun.Add(interval)), 0)
+}
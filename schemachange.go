@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type schemaChangeStep struct {
+	name    string
+	queries []string
+}
+
+// schemaChangeSteps returns typical online migrations on table, written the
+// way they are usually run in production.
+func schemaChangeSteps(table string, backfillBatch int) []schemaChangeStep {
+	return []schemaChangeStep{
+		{
+			name: "ADD COLUMN with default",
+			queries: []string{
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS demo_db_flag BOOLEAN NOT NULL DEFAULT false`, table),
+			},
+		},
+		{
+			name: "SET NOT NULL directly (full scan under ACCESS EXCLUSIVE)",
+			queries: []string{
+				fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN cola SET NOT NULL`, table),
+				fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN cola DROP NOT NULL`, table),
+			},
+		},
+		{
+			name: "SET NOT NULL via NOT VALID check constraint",
+			queries: []string{
+				fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT demo_db_cola_not_null CHECK (cola IS NOT NULL) NOT VALID`, table),
+				fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT demo_db_cola_not_null`, table),
+				fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN cola SET NOT NULL`, table),
+				fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT demo_db_cola_not_null`, table),
+				fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN cola DROP NOT NULL`, table),
+			},
+		},
+		{
+			name: "Type change via new column and batched backfill",
+			queries: []string{
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS demo_db_id_big BIGINT`, table),
+				fmt.Sprintf(`DO $$
+DECLARE
+	lo BIGINT;
+	hi BIGINT;
+BEGIN
+	SELECT MIN(bigtable_id), MAX(bigtable_id) INTO lo, hi FROM %[1]s;
+	WHILE lo <= hi LOOP
+		UPDATE %[1]s SET demo_db_id_big = bigtable_id WHERE bigtable_id >= lo AND bigtable_id < lo + %[2]d AND demo_db_id_big IS NULL;
+		COMMIT;
+		lo := lo + %[2]d;
+	END LOOP;
+END $$`, table, backfillBatch),
+			},
+		},
+		{
+			name: "Clean up migration columns",
+			queries: []string{
+				fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS demo_db_flag, DROP COLUMN IF EXISTS demo_db_id_big`, table),
+			},
+		},
+	}
+}
+
+// startSchemaChanges waits for delay and then runs the migration steps on
+// the bigtable of each schema once, one schema after the other, reporting
+// for each step how long it took and how the latency of the concurrent
+// bigtable inserts changed while it ran. The steps run once in order rather
+// than repeatedly, so they do not use the worker engine.
+func startSchemaChanges(wg *sync.WaitGroup, ctx, execCtx context.Context, pool *pgxpool.Pool, stats *runStats, schemas []string, delay time.Duration, lockTimeout time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		conn, err := pool.Acquire(execCtx)
+		if err != nil {
+			fmt.Println("Error acquiring connection for schema changes:", err)
+			return
+		}
+		defer conn.Release()
+
+		if lockTimeout > 0 {
+			if _, err := conn.Exec(execCtx, fmt.Sprintf("SET lock_timeout = %d", lockTimeout.Milliseconds())); err != nil {
+				fmt.Println("Error setting lock_timeout:", err)
+				return
+			}
+			defer conn.Exec(context.Background(), "RESET lock_timeout")
+		}
+
+		inserts := stats.table("bigtable")
+		for _, schema := range schemas {
+			if schema != "" {
+				fmt.Printf("Schema changes on %s.bigtable\n", schema)
+			}
+			runSchemaChangeSteps(ctx, execCtx, conn.Conn(), stats, inserts, schema)
+		}
+		fmt.Println("Schema change simulation finished")
+	}()
+}
+
+// runSchemaChangeSteps runs the migration steps on the bigtable of schema.
+// The statistics do not tell schemas apart, so the reported inserts are the
+// ones into the bigtable of every schema.
+func runSchemaChangeSteps(ctx, execCtx context.Context, conn *pgx.Conn, stats *runStats, inserts *tableStats, schema string) {
+	for _, step := range schemaChangeSteps(qualifiedTable(schema, "bigtable"), 10000) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		fmt.Printf("Schema change: %s ...\n", step.name)
+		stats.setPhase("schema change: " + step.name)
+		countBefore, sumBefore := inserts.latency.count.Load(), inserts.latency.sumNanos.Load()
+		inserts.windowMaxNanos.Store(0)
+		start := time.Now()
+
+		var stepErr error
+		for _, query := range step.queries {
+			if _, stepErr = conn.Exec(execCtx, query); stepErr != nil {
+				break
+			}
+		}
+		elapsed := time.Since(start)
+		stats.setPhase("steady")
+
+		rows := inserts.latency.count.Load() - countBefore
+		var avg time.Duration
+		if rows > 0 {
+			avg = time.Duration((inserts.latency.sumNanos.Load() - sumBefore) / rows)
+		}
+		maxLatency := time.Duration(inserts.windowMaxNanos.Load())
+
+		if stepErr != nil {
+			fmt.Printf("Schema change: %s failed after %s: %v\n", step.name, elapsed.Round(time.Millisecond), stepErr)
+		} else {
+			fmt.Printf("Schema change: %s took %s\n", step.name, elapsed.Round(time.Millisecond))
+		}
+		fmt.Printf("  concurrent bigtable inserts: %d, avg latency %s, max latency %s\n",
+			rows, avg.Round(time.Microsecond), maxLatency.Round(time.Microsecond))
+	}
+}
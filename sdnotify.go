@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// sdNotify sends a state such as "READY=1" to systemd when running as a
+// Type=notify service. It is a no-op when NOTIFY_SOCKET is not set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often the watchdog has to be pinged, which
+// is half of WATCHDOG_USEC as recommended by sd_watchdog_enabled(3).
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// superviseWatchdog pings the systemd watchdog as long as the database is
+// reachable, so systemd restarts the service when the pool is wedged.
+func superviseWatchdog(ctx context.Context, pool *pgxpool.Pool) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, interval)
+			err := pool.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				fmt.Printf("Watchdog: database ping failed, skipping watchdog notification: %v\n", err)
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				fmt.Printf("Watchdog: notifying systemd failed: %v\n", err)
+			}
+		}
+	}
+}
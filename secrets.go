@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// passwordCommandTimeout bounds how long password_command may take.
+const passwordCommandTimeout = 30 * time.Second
+
+// resolvePassword sets the password from password_file or the output of
+// password_command when it is not configured directly. Trailing newlines
+// are removed, as secret files and helpers usually end with one.
+func resolvePassword(cfg *InserterConfig) error {
+	if cfg.PasswordFile != "" && cfg.PasswordCommand != "" {
+		return fmt.Errorf("only one of password_file and password_command can be set")
+	}
+	if cfg.Password != "" {
+		return nil
+	}
+
+	switch {
+	case cfg.PasswordFile != "":
+		data, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("reading password_file failed: %w", err)
+		}
+		cfg.Password = strings.TrimRight(string(data), "\r\n")
+	case cfg.PasswordCommand != "":
+		ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+		defer cancel()
+		cmd := shellCommand(ctx, cfg.PasswordCommand)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("running password_command failed: %w", err)
+		}
+		cfg.Password = strings.TrimRight(string(out), "\r\n")
+	}
+	return nil
+}
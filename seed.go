@@ -0,0 +1,39 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+)
+
+// newRand returns the generator of one stream of generated data, usually
+// one worker. A stream derived from the same seed produces the same sequence
+// of values on every run, which is why the generators are never shared
+// between goroutines. That covers the values the tool generates, not those
+// left to the server, like NOW() or the random() of the read workload, nor
+// ids taken from other workers, see the README.
+func newRand(seed uint64, stream string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(stream))
+	return rand.New(rand.NewPCG(seed, h.Sum64()))
+}
+
+// runSeed returns the configured seed, or a random one when none is set.
+func runSeed(cfg *InserterConfig) uint64 {
+	if cfg.Seed != nil {
+		return *cfg.Seed
+	}
+	return rand.Uint64()
+}
+
+// withRand binds task to its own generator of stream.
+func withRand(seed uint64, stream string, task func(r *rand.Rand) error) func() error {
+	r := newRand(seed, stream)
+	return func() error { return task(r) }
+}
+
+// workerSeed returns the seed of goroutine i of a worker. The first goroutine
+// keeps the seed, so adding goroutines to a worker does not change the data
+// of the first one.
+func workerSeed(seed uint64, i int) uint64 {
+	return seed ^ uint64(i)*0x9e3779b97f4a7c15
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxServerLogRead bounds how much of the server log is read at the end of
+// a run. Only the most recent part is kept when more was written.
+const maxServerLogRead = 16 << 20
+
+// serverLogEvents are the server log messages worth correlating with a run.
+var serverLogEvents = []struct {
+	category string
+	pattern  *regexp.Regexp
+}{
+	{"deadlock", regexp.MustCompile(`deadlock detected`)},
+	{"checkpoint", regexp.MustCompile(`checkpoint(s are occurring too frequently| starting| complete)`)},
+	{"autovacuum", regexp.MustCompile(`automatic (aggressive )?(vacuum|analyze)`)},
+	{"lock", regexp.MustCompile(`lock timeout|still waiting for|acquired \w+ on`)},
+	{"error", regexp.MustCompile(`\b(ERROR|FATAL|PANIC)\b`)},
+}
+
+var logTimestamp = regexp.MustCompile(`^"?(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?) (UTC|GMT|[+-]\d{2}(:?\d{2})?)`)
+
+// serverLogTail remembers where the server log ended when the run started,
+// so the messages written during the run can be read afterwards. The log is
+// read from a local file when one is configured, otherwise through
+// pg_read_file, which needs superuser or pg_read_server_files. A nil tail
+// reports nothing.
+type serverLogTail struct {
+	localFile string
+	path      string
+	offset    int64
+	started   time.Time
+}
+
+func startServerLogTail(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) (*serverLogTail, error) {
+	t := &serverLogTail{localFile: cfg.ServerLog.File, started: time.Now()}
+	if t.localFile != "" {
+		info, err := os.Stat(t.localFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading server log file failed: %w", err)
+		}
+		t.offset = info.Size()
+		return t, nil
+	}
+
+	var path *string
+	if err := pool.QueryRow(ctx, `SELECT pg_current_logfile()`).Scan(&path); err != nil {
+		return nil, fmt.Errorf("finding the current server log failed: %w", err)
+	}
+	if path == nil {
+		return nil, fmt.Errorf("the server does not run the logging collector, set server_log.file instead")
+	}
+	t.path = *path
+	if err := pool.QueryRow(ctx, `SELECT size FROM pg_stat_file($1)`, t.path).Scan(&t.offset); err != nil {
+		return nil, fmt.Errorf("reading server log %s failed: %w", t.path, err)
+	}
+	return t, nil
+}
+
+// read returns what was appended to the log since the start of the run.
+func (t *serverLogTail) read(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	if t.localFile != "" {
+		file, err := os.Open(t.localFile)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return "", err
+		}
+		offset := max(t.offset, info.Size()-maxServerLogRead)
+		if info.Size() < t.offset {
+			// The file was rotated or truncated during the run.
+			offset = max(0, info.Size()-maxServerLogRead)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(file)
+		return string(data), err
+	}
+
+	path, offset := t.path, t.offset
+	var current *string
+	if err := pool.QueryRow(ctx, `SELECT pg_current_logfile()`).Scan(&current); err != nil {
+		return "", err
+	}
+	if current != nil && *current != path {
+		// The log was rotated during the run, only the new file is read.
+		path, offset = *current, 0
+	}
+
+	var content string
+	err := pool.QueryRow(ctx, `SELECT pg_read_file($1, GREATEST($2, s.size - $3), LEAST(s.size - $2, $3)) FROM pg_stat_file($1) s`,
+		path, offset, int64(maxServerLogRead)).Scan(&content)
+	return content, err
+}
+
+// report lists the interesting log messages written during the run with
+// their time relative to its start.
+func (t *serverLogTail) report(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	content, err := t.read(ctx, pool)
+	if err != nil {
+		return "", fmt.Errorf("reading server log failed: %w", err)
+	}
+
+	var b strings.Builder
+	counts := map[string]int{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, event := range serverLogEvents {
+			if !event.pattern.MatchString(line) {
+				continue
+			}
+			counts[event.category]++
+			fmt.Fprintf(&b, "  %-8s %-10s %s\n", t.since(line), event.category, line)
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("Server log during the run: %d deadlocks, %d checkpoints, %d autovacuum, %d lock waits, %d errors",
+		counts["deadlock"], counts["checkpoint"], counts["autovacuum"], counts["lock"], counts["error"])
+	return strings.TrimSuffix(summary+"\n"+b.String(), "\n"), nil
+}
+
+// since returns the time of a log line relative to the start of the run,
+// or "?" when the line has no timestamp it can parse.
+func (t *serverLogTail) since(line string) string {
+	m := logTimestamp.FindStringSubmatch(line)
+	if m == nil {
+		return "?"
+	}
+	zone := m[3]
+	layout := "2006-01-02 15:04:05.999999999 MST"
+	switch {
+	case strings.Contains(zone, ":"):
+		layout = "2006-01-02 15:04:05.999999999 -07:00"
+	case len(zone) == 5:
+		layout = "2006-01-02 15:04:05.999999999 -0700"
+	case len(zone) == 3 && (zone[0] == '+' || zone[0] == '-'):
+		layout = "2006-01-02 15:04:05.999999999 -07"
+	}
+	at, err := time.Parse(layout, m[1]+" "+zone)
+	if err != nil {
+		return "?"
+	}
+	d := at.Sub(t.started).Round(time.Second)
+	if d < 0 {
+		return d.String()
+	}
+	return "+" + d.String()
+}
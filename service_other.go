@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+func isWindowsService() bool {
+	return false
+}
+
+func runWindowsService(flags *CommandFlags) error {
+	return nil
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+func isWindowsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runWindowsService runs the selected action under the Windows service
+// control manager. Stop and shutdown requests drain the running action the
+// same way SIGTERM does on other platforms.
+func runWindowsService(flags *CommandFlags) error {
+	return svc.Run("demo-db", &serviceHandler{flags: flags})
+}
+
+type serviceHandler struct {
+	flags *CommandFlags
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, h.flags)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case <-done:
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel(errDrain)
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// explain runs EXPLAIN ANALYZE for query and returns the plan as text.
+func explain(ctx context.Context, pool *pgxpool.Pool, query string) (string, error) {
+	return explainWith(ctx, pool, "ANALYZE, BUFFERS", query)
+}
+
+// explainWith runs EXPLAIN with the given options for query.
+func explainWith(ctx context.Context, pool *pgxpool.Pool, options, query string) (string, error) {
+	rows, err := pool.Query(ctx, "EXPLAIN ("+options+") "+query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+func printPlan(ctx context.Context, pool *pgxpool.Pool, title, query string) error {
+	plan, err := explain(ctx, pool, query)
+	if err != nil {
+		return fmt.Errorf("explaining %q failed: %w", query, err)
+	}
+	fmt.Printf("\n=== %s ===\n%s\n%s\n", title, query, plan)
+	return nil
+}
+
+// runSkewDemo builds the skew_demo table, where one status value covers
+// 99.9% of the rows and city determines country, then prints the plans
+// that show how the planner reacts to common vs rare values and to
+// correlated columns with and without extended statistics.
+func runSkewDemo(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	rows := cfg.SkewDemo.Rows
+	if rows <= 0 {
+		rows = 1000000
+	}
+
+	setup := []string{
+		`DROP TABLE IF EXISTS skew_demo`,
+		`CREATE TABLE skew_demo (
+			id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+			status TEXT NOT NULL,
+			city TEXT NOT NULL,
+			country TEXT NOT NULL,
+			payload TEXT
+		)`,
+		fmt.Sprintf(`INSERT INTO skew_demo (status, city, country, payload)
+			SELECT CASE WHEN g %% 1000 = 0 THEN 'rare' ELSE 'common' END,
+				'city_' || (g %% 100),
+				'country_' || (g %% 100 / 10),
+				md5(g::text)
+			FROM generate_series(1, %d) AS g`, rows),
+		`CREATE INDEX skew_demo_status_idx ON skew_demo (status)`,
+		`CREATE INDEX skew_demo_city_country_idx ON skew_demo (city, country)`,
+		`ANALYZE skew_demo`,
+	}
+
+	fmt.Printf("Creating skew_demo table with %d rows...\n", rows)
+	for _, query := range setup {
+		if _, err := pool.Exec(ctx, query); err != nil {
+			return fmt.Errorf("setting up skew demo failed: %w", err)
+		}
+	}
+	if err := registerObjects(ctx, pool, managedObject{Kind: "table", Name: "skew_demo"}); err != nil {
+		return err
+	}
+
+	if err := printPlan(ctx, pool, "Common value (99.9% of rows)", `SELECT * FROM skew_demo WHERE status = 'common'`); err != nil {
+		return err
+	}
+	if err := printPlan(ctx, pool, "Rare value (0.1% of rows)", `SELECT * FROM skew_demo WHERE status = 'rare'`); err != nil {
+		return err
+	}
+
+	correlated := `SELECT * FROM skew_demo WHERE city = 'city_42' AND country = 'country_4'`
+	if err := printPlan(ctx, pool, "Correlated columns without extended statistics", correlated); err != nil {
+		return err
+	}
+
+	if !cfg.SkewDemo.CreateStatistics {
+		fmt.Println("\nSet skew_demo.create_statistics to compare with extended statistics.")
+		return nil
+	}
+
+	for _, query := range []string{
+		`CREATE STATISTICS skew_demo_city_country_stats (dependencies, ndistinct, mcv) ON city, country FROM skew_demo`,
+		`ANALYZE skew_demo`,
+	} {
+		if _, err := pool.Exec(ctx, query); err != nil {
+			return fmt.Errorf("creating extended statistics failed: %w", err)
+		}
+	}
+	if err := registerObjects(ctx, pool, managedObject{Kind: "statistics", Name: "skew_demo_city_country_stats"}); err != nil {
+		return err
+	}
+	return printPlan(ctx, pool, "Correlated columns with extended statistics", correlated)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// soakSample is a snapshot of the resources a long run could leak, on the
+// client and on the server.
+type soakSample struct {
+	at          time.Time
+	heapBytes   uint64
+	goroutines  int
+	connections int64
+	tempBytes   int64
+}
+
+// soakMonitor samples resource usage during endurance runs and flags values
+// that drift above the baseline taken after the warm-up. A nil monitor
+// reports nothing.
+type soakMonitor struct {
+	mu       sync.Mutex
+	baseline *soakSample
+	last     soakSample
+	peak     soakSample
+	drifts   map[string]int
+}
+
+func takeSoakSample(ctx context.Context, pool *pgxpool.Pool) (soakSample, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s := soakSample{at: time.Now(), heapBytes: mem.HeapAlloc, goroutines: runtime.NumGoroutine()}
+	err := pool.QueryRow(ctx, `SELECT
+			(SELECT count(*) FROM pg_stat_activity WHERE application_name = $1),
+			(SELECT temp_bytes FROM pg_stat_database WHERE datname = current_database())`,
+		applicationName).Scan(&s.connections, &s.tempBytes)
+	return s, err
+}
+
+// startSoakMonitor samples every interval until ctx is done. The first
+// sample after warmup becomes the baseline, later samples exceeding it by
+// more than driftPercent are reported as drifts. Like the progress reporter
+// it observes the run, so it stays off the worker engine.
+func startSoakMonitor(wg *sync.WaitGroup, ctx context.Context, pool *pgxpool.Pool, interval, warmup time.Duration, driftPercent float64) *soakMonitor {
+	m := &soakMonitor{drifts: map[string]int{}}
+	started := time.Now()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fmt.Printf("Soak monitor sampling every %s, baseline after %s warm-up\n", interval, warmup)
+		for sleep(ctx, interval) {
+			s, err := takeSoakSample(ctx, pool)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Println("Error taking soak sample:", err)
+				}
+				continue
+			}
+			if time.Since(started) >= warmup {
+				m.observe(s, driftPercent)
+			}
+		}
+	}()
+	return m
+}
+
+func (m *soakMonitor) observe(s soakSample, driftPercent float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.baseline == nil {
+		m.baseline, m.peak = &s, s
+		fmt.Printf("Soak baseline: heap %s, %d goroutines, %d connections\n", formatBytes(int64(s.heapBytes)), s.goroutines, s.connections)
+	}
+	m.last = s
+	m.peak.heapBytes = max(m.peak.heapBytes, s.heapBytes)
+	m.peak.goroutines = max(m.peak.goroutines, s.goroutines)
+	m.peak.connections = max(m.peak.connections, s.connections)
+
+	limit := 1 + driftPercent/100
+	var drifted []string
+	check := func(name string, value, base float64) {
+		if base > 0 && value > base*limit {
+			m.drifts[name]++
+			drifted = append(drifted, fmt.Sprintf("%s %.0f vs baseline %.0f", name, value, base))
+		}
+	}
+	check("heap_bytes", float64(s.heapBytes), float64(m.baseline.heapBytes))
+	check("goroutines", float64(s.goroutines), float64(m.baseline.goroutines))
+	check("connections", float64(s.connections), float64(m.baseline.connections))
+
+	tempRate := float64(s.tempBytes-m.baseline.tempBytes) / max(s.at.Sub(m.baseline.at).Hours(), 1/3600.0)
+	fmt.Printf("Soak: uptime %s, heap %s, %d goroutines, %d connections, temp %s/h\n",
+		time.Since(m.baseline.at).Round(time.Second), formatBytes(int64(s.heapBytes)), s.goroutines, s.connections, formatBytes(int64(tempRate)))
+	if len(drifted) > 0 {
+		fmt.Printf("Soak DRIFT: %s\n", strings.Join(drifted, ", "))
+	}
+}
+
+func (m *soakMonitor) report() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.baseline == nil {
+		return "Soak report: the run ended before the warm-up, no baseline was taken"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Soak report over %s:\n", m.last.at.Sub(m.baseline.at).Round(time.Second))
+	fmt.Fprintf(&b, "  %-12s baseline=%-10s last=%-10s peak=%-10s drifts=%d\n", "heap",
+		formatBytes(int64(m.baseline.heapBytes)), formatBytes(int64(m.last.heapBytes)), formatBytes(int64(m.peak.heapBytes)), m.drifts["heap_bytes"])
+	fmt.Fprintf(&b, "  %-12s baseline=%-10d last=%-10d peak=%-10d drifts=%d\n", "goroutines",
+		m.baseline.goroutines, m.last.goroutines, m.peak.goroutines, m.drifts["goroutines"])
+	fmt.Fprintf(&b, "  %-12s baseline=%-10d last=%-10d peak=%-10d drifts=%d\n", "connections",
+		m.baseline.connections, m.last.connections, m.peak.connections, m.drifts["connections"])
+	fmt.Fprintf(&b, "  %-12s %s written during the run", "temp", formatBytes(m.last.tempBytes-m.baseline.tempBytes))
+	return b.String()
+}
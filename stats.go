@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the insert latency
+// histogram buckets.
+var latencyBuckets = [...]float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type latencyHistogram struct {
+	buckets  [len(latencyBuckets)]atomic.Uint64
+	count    atomic.Uint64
+	sumNanos atomic.Uint64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			h.buckets[i].Add(1)
+		}
+	}
+	h.count.Add(1)
+	h.sumNanos.Add(uint64(d.Nanoseconds()))
+}
+
+// latencySnapshot is a copy of the counters of a latencyHistogram, which
+// can be subtracted from a later one to get the latencies of an interval.
+type latencySnapshot struct {
+	buckets [len(latencyBuckets)]uint64
+	count   uint64
+}
+
+func (h *latencyHistogram) snapshot() latencySnapshot {
+	var s latencySnapshot
+	for i := range h.buckets {
+		s.buckets[i] = h.buckets[i].Load()
+	}
+	s.count = h.count.Load()
+	return s
+}
+
+// sub returns the latencies observed since prev was taken.
+func (s latencySnapshot) sub(prev latencySnapshot) latencySnapshot {
+	for i := range s.buckets {
+		s.buckets[i] -= prev.buckets[i]
+	}
+	s.count -= prev.count
+	return s
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile,
+// and false when there are no latencies or it is above the last bucket.
+func (s latencySnapshot) quantile(q float64) (time.Duration, bool) {
+	if s.count == 0 {
+		return 0, false
+	}
+	rank := uint64(math.Ceil(q * float64(s.count)))
+	for i, le := range latencyBuckets {
+		if s.buckets[i] >= rank {
+			return time.Duration(le * float64(time.Second)), true
+		}
+	}
+	return 0, false
+}
+
+// formatQuantile formats the q quantile of s for reports.
+func (s latencySnapshot) formatQuantile(q float64) string {
+	if d, ok := s.quantile(q); ok {
+		return "<=" + d.String()
+	}
+	if s.count == 0 {
+		return "-"
+	}
+	return fmt.Sprintf(">%gs", latencyBuckets[len(latencyBuckets)-1])
+}
+
+type tableStats struct {
+	inserts atomic.Uint64
+	errors  atomic.Uint64
+	latency latencyHistogram
+	updates atomic.Uint64
+	deletes atomic.Uint64
+
+	// windowMaxNanos is the highest latency seen since it was last reset,
+	// used to measure the impact of concurrent operations on inserts.
+	windowMaxNanos atomic.Int64
+}
+
+func (t *tableStats) observeMax(d time.Duration) {
+	for {
+		current := t.windowMaxNanos.Load()
+		if d.Nanoseconds() <= current || t.windowMaxNanos.CompareAndSwap(current, d.Nanoseconds()) {
+			return
+		}
+	}
+}
+
+// readStats counts the queries of a read pattern, or of a worker only
+// reading, such as the long queries.
+type readStats struct {
+	reads   atomic.Uint64
+	errors  atomic.Uint64
+	latency latencyHistogram
+}
+
+// runStats collects per-table counters for a single run of the tool, and
+// per-pattern counters for its reads.
+type runStats struct {
+	mu       sync.Mutex
+	tables   map[string]*tableStats
+	patterns map[string]*readStats
+	started  time.Time
+	runID    string
+
+	// currentPhase names what the run is doing, e.g. a running schema
+	// change, so samples can be attributed to it.
+	currentPhase atomic.Pointer[string]
+
+	// quiet suppresses per-worker progress messages, which add up to a lot
+	// of output on long runs.
+	quiet bool
+
+	// targets are the row counts after which the workers of a table stop.
+	targets map[string]uint64
+
+	errorBudget    uint64
+	totalErrors    atomic.Uint64
+	budgetExceeded sync.Once
+	onBudget       func(errors uint64)
+
+	// The read errors have a budget of their own, failing reads do not use
+	// up the one of the inserts.
+	readErrorBudget    uint64
+	totalReadErrors    atomic.Uint64
+	readBudgetExceeded sync.Once
+	onReadBudget       func(errors uint64)
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		tables:   map[string]*tableStats{},
+		patterns: map[string]*readStats{},
+		started:  time.Now(),
+		runID:    newRunID(),
+	}
+}
+
+func (s *runStats) setPhase(phase string) {
+	s.currentPhase.Store(&phase)
+}
+
+func (s *runStats) phase() string {
+	if p := s.currentPhase.Load(); p != nil {
+		return *p
+	}
+	return "steady"
+}
+
+func (s *runStats) table(name string) *tableStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[name]
+	if !ok {
+		t = &tableStats{}
+		s.tables[name] = t
+	}
+	return t
+}
+
+// recordBatch records rows inserted by a single statement, such as a COPY.
+func (s *runStats) recordBatch(name string, rows int64, latency time.Duration) {
+	t := s.table(name)
+	t.inserts.Add(uint64(rows))
+	t.latency.observe(latency)
+	t.observeMax(latency)
+}
+
+func (s *runStats) pattern(name string) *readStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.patterns[name]
+	if !ok {
+		r = &readStats{}
+		s.patterns[name] = r
+	}
+	return r
+}
+
+func (s *runStats) recordRead(name string, latency time.Duration) {
+	r := s.pattern(name)
+	r.reads.Add(1)
+	r.latency.observe(latency)
+}
+
+func (s *runStats) recordReadError(name string) {
+	s.pattern(name).errors.Add(1)
+	total := s.totalReadErrors.Add(1)
+	if s.readErrorBudget > 0 && total > s.readErrorBudget && s.onReadBudget != nil {
+		s.readBudgetExceeded.Do(func() { s.onReadBudget(total) })
+	}
+}
+
+// readCounts returns the reads and read errors of name, without adding it
+// to the patterns when it has none.
+func (s *runStats) readCounts(name string) (reads, errors uint64) {
+	s.mu.Lock()
+	r, ok := s.patterns[name]
+	s.mu.Unlock()
+	if !ok {
+		return 0, 0
+	}
+	return r.reads.Load(), r.errors.Load()
+}
+
+// recordUpdate records rows changed by a single UPDATE, whose latency is
+// tracked together with the inserts of the table.
+func (s *runStats) recordUpdate(name string, rows int64, latency time.Duration) {
+	t := s.table(name)
+	t.updates.Add(uint64(rows))
+	t.latency.observe(latency)
+	t.observeMax(latency)
+}
+
+// recordDelete records rows removed by a single DELETE.
+func (s *runStats) recordDelete(name string, rows int64, latency time.Duration) {
+	t := s.table(name)
+	t.deletes.Add(uint64(rows))
+	t.latency.observe(latency)
+	t.observeMax(latency)
+}
+
+func (s *runStats) recordError(name string) {
+	s.table(name).errors.Add(1)
+	total := s.totalErrors.Add(1)
+	if s.errorBudget > 0 && total > s.errorBudget && s.onBudget != nil {
+		s.budgetExceeded.Do(func() { s.onBudget(total) })
+	}
+}
+
+// targetReached reports whether table has a row target that was reached.
+func (s *runStats) targetReached(table string) bool {
+	target, ok := s.targets[table]
+	return ok && s.table(table).inserts.Load() >= target
+}
+
+// allTargetsReached reports whether the row targets of tables were all
+// reached.
+func (s *runStats) allTargetsReached(tables []string) bool {
+	for _, table := range tables {
+		if !s.targetReached(table) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *runStats) tableNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *runStats) patternNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.patterns))
+	for name := range s.patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// totals returns the number of inserted rows and errors over all tables.
+func (s *runStats) totals() (inserts, errors uint64) {
+	for _, name := range s.tableNames() {
+		t := s.table(name)
+		inserts += t.inserts.Load()
+		errors += t.errors.Load()
+	}
+	return inserts, errors
+}
+
+func (s *runStats) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Run %s summary after %s:\n", s.runID, time.Since(s.started).Round(time.Second))
+	for _, name := range s.tableNames() {
+		t := s.table(name)
+		inserts, updates, deletes := t.inserts.Load(), t.updates.Load(), t.deletes.Load()
+		fmt.Fprintf(&b, "  %-15s", name)
+		if inserts > 0 || updates == 0 && deletes == 0 {
+			fmt.Fprintf(&b, " inserted=%d", inserts)
+		}
+		if updates > 0 {
+			fmt.Fprintf(&b, " updated=%d", updates)
+		}
+		if deletes > 0 {
+			fmt.Fprintf(&b, " deleted=%d", deletes)
+		}
+		fmt.Fprintf(&b, " errors=%d\n", t.errors.Load())
+	}
+	inserts, errors := s.totals()
+	fmt.Fprintf(&b, "  %-15s inserted=%d errors=%d", "total", inserts, errors)
+	if patterns := s.patternNames(); len(patterns) > 0 {
+		var reads uint64
+		b.WriteString("\nReads:")
+		for _, name := range patterns {
+			r := s.pattern(name)
+			reads += r.reads.Load()
+			fmt.Fprintf(&b, "\n  %-15s reads=%d errors=%d", name, r.reads.Load(), r.errors.Load())
+		}
+		fmt.Fprintf(&b, "\n  %-15s reads=%d errors=%d", "total", reads, s.totalReadErrors.Load())
+	}
+	return b.String()
+}
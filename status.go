@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tableStatus is a line of the status report.
+type tableStatus struct {
+	Schema         string     `json:"schema"`
+	Table          string     `json:"table"`
+	Rows           int64      `json:"rows"`
+	TableBytes     int64      `json:"table_bytes"`
+	IndexBytes     int64      `json:"index_bytes"`
+	LastAutovacuum *time.Time `json:"last_autovacuum"`
+}
+
+// statusQuery reads the status of the demo tables of a schema, the current
+// one when empty. Row counts are the planner estimates, so the report stays
+// cheap on large tables; tables never analyzed fall back to n_live_tup.
+const statusQuery = `SELECT n.nspname, c.relname,
+		CASE WHEN c.reltuples >= 0 THEN c.reltuples::bigint ELSE COALESCE(s.n_live_tup, 0) END,
+		pg_table_size(c.oid), pg_indexes_size(c.oid), s.last_autovacuum
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+	WHERE c.relkind IN ('r', 'p') AND c.relname = ANY($1)
+		AND n.nspname = COALESCE(NULLIF($2, ''), current_schema())
+	ORDER BY c.relname`
+
+// printStatus prints the estimated row count, table and index size and
+// last autovacuum of every demo table, as JSON when asJSON is set.
+func printStatus(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, asJSON bool) error {
+	statuses := []tableStatus{}
+	for _, schema := range workloadSchemas(cfg) {
+		rows, err := pool.Query(ctx, statusQuery, demoTables, schema)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var s tableStatus
+			if err := rows.Scan(&s.Schema, &s.Table, &s.Rows, &s.TableBytes, &s.IndexBytes, &s.LastAutovacuum); err != nil {
+				rows.Close()
+				return err
+			}
+			statuses = append(statuses, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No demo tables found.")
+		return nil
+	}
+	var rows, tableBytes, indexBytes int64
+	fmt.Printf("%-15s %-16s %14s %12s %12s %s\n", "SCHEMA", "TABLE", "ROWS (EST.)", "TABLE SIZE", "INDEX SIZE", "LAST AUTOVACUUM")
+	for _, s := range statuses {
+		vacuumed := "never"
+		if s.LastAutovacuum != nil {
+			vacuumed = s.LastAutovacuum.Format(time.RFC3339)
+		}
+		fmt.Printf("%-15s %-16s %14d %12s %12s %s\n", s.Schema, s.Table, s.Rows, formatBytes(s.TableBytes), formatBytes(s.IndexBytes), vacuumed)
+		rows, tableBytes, indexBytes = rows+s.Rows, tableBytes+s.TableBytes, indexBytes+s.IndexBytes
+	}
+	fmt.Printf("%-15s %-16s %14d %12s %12s\n", "", "total", rows, formatBytes(tableBytes), formatBytes(indexBytes))
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// catalogTables are the system catalogs that grow with every temporary
+// table created and dropped.
+var catalogTables = []string{"pg_attribute", "pg_class", "pg_depend", "pg_type"}
+
+// printCatalogBloat reports the size and dead tuples of the catalogs
+// touched by temporary table churn.
+func printCatalogBloat(ctx context.Context, pool *pgxpool.Pool, title string) error {
+	rows, err := pool.Query(ctx, `SELECT relname, pg_total_relation_size(relid), n_live_tup, n_dead_tup, COALESCE(last_autovacuum::text, 'never')
+		FROM pg_stat_sys_tables WHERE schemaname = 'pg_catalog' AND relname = ANY($1) ORDER BY relname`, catalogTables)
+	if err != nil {
+		return fmt.Errorf("querying catalog statistics failed: %w", err)
+	}
+	defer rows.Close()
+
+	fmt.Printf("Catalog statistics %s:\n", title)
+	for rows.Next() {
+		var name, lastAutovacuum string
+		var size, live, dead int64
+		if err := rows.Scan(&name, &size, &live, &dead, &lastAutovacuum); err != nil {
+			return err
+		}
+		fmt.Printf("  %-15s size=%-10s live=%-8d dead=%-8d last_autovacuum=%s\n", name, formatBytes(size), live, dead, lastAutovacuum)
+	}
+	return rows.Err()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// startTempTableChurn runs sessions workers that each hold a connection and
+// create and drop temporary tables with columns columns at the rate allowed
+// by limiter, while a reporter prints the catalog statistics every
+// reportInterval. Temporary tables live as long as their session, so every
+// worker holds its connection for the whole run, which the worker engine,
+// having no teardown per goroutine, cannot release.
+func startTempTableChurn(wg *sync.WaitGroup, ctx, execCtx context.Context, pool *pgxpool.Pool, stats *runStats, limiter *rateLimiter, sessions, columns int, reportInterval time.Duration) {
+	defs := make([]string, columns)
+	for i := range defs {
+		defs[i] = fmt.Sprintf("col%d TEXT", i+1)
+	}
+	columnList := strings.Join(defs, ", ")
+
+	if err := printCatalogBloat(ctx, pool, "before temp table churn"); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	var created sync.WaitGroup
+	var mu sync.Mutex
+	var total int
+
+	for session := range sessions {
+		created.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer created.Done()
+
+			// Each session gets its own connection outside the pool, so
+			// holding it for the whole run does not starve the inserters.
+			conn, err := pgx.ConnectConfig(ctx, pool.Config().ConnConfig.Copy())
+			if err != nil {
+				fmt.Printf("Error connecting temp table session %d: %v\n", session+1, err)
+				return
+			}
+			defer conn.Close(context.WithoutCancel(ctx))
+
+			count := 0
+			defer func() {
+				mu.Lock()
+				total += count
+				mu.Unlock()
+			}()
+
+			for {
+				if err := limiter.wait(ctx); err != nil {
+					return
+				}
+
+				name := pgx.Identifier{fmt.Sprintf("demo_db_churn_%d", count)}.Sanitize()
+				_, err := conn.Exec(execCtx, fmt.Sprintf("CREATE TEMP TABLE %s (id BIGINT PRIMARY KEY, %s)", name, columnList))
+				if err == nil {
+					_, err = conn.Exec(execCtx, "DROP TABLE "+name)
+				}
+				if err != nil {
+					stats.recordError("temp_tables")
+					fmt.Printf("Error churning temp tables in session %d: %v\n", session+1, err)
+					select {
+					case <-time.After(5 * time.Second):
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				count++
+
+				if ctx.Err() != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				created.Wait()
+				if err := printCatalogBloat(context.WithoutCancel(ctx), pool, "after temp table churn"); err != nil {
+					fmt.Println("Error:", err)
+				}
+				fmt.Printf("Temp table churn: %d tables created and dropped by %d sessions\n", total, sessions)
+				return
+			case <-time.After(reportInterval):
+				if err := printCatalogBloat(execCtx, pool, "during temp table churn"); err != nil {
+					fmt.Println("Error:", err)
+				}
+			}
+		}
+	}()
+}
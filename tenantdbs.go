@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func tenantDatabaseNames(cfg *InserterConfig) []string {
+	prefix := cfg.TenantDatabases.NamePrefix
+	if prefix == "" {
+		prefix = cfg.Database + "_tenant_"
+	}
+	names := make([]string, cfg.TenantDatabases.Databases)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%03d", prefix, i+1)
+	}
+	return names
+}
+
+// tenantSchemaApplied reports whether the database of pool has the demo
+// schema, i.e. the demo_db_marker table or one of the demo tables. Other
+// tables, e.g. of extensions in the template, do not count.
+func tenantSchemaApplied(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var applied bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_tables WHERE tablename = ANY($1))`,
+		append([]string{"demo_db_marker"}, demoTables...)).Scan(&applied)
+	return applied, err
+}
+
+// provisionTenantDatabases creates one database per tenant from the
+// configured template and applies the demo schema to each of them. Existing
+// databases get the schema too when they do not have it yet, e.g. after a
+// provisioning that failed halfway.
+func provisionTenantDatabases(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	fsys, files, err := schemaSource(cfg)
+	if err != nil {
+		return err
+	}
+	template := cfg.TenantDatabases.Template
+	if template == "" {
+		template = "template1"
+	}
+
+	for _, name := range tenantDatabaseNames(cfg) {
+		var exists bool
+		err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("checking database %s failed: %w", name, err)
+		}
+		if !exists {
+			query := fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pgx.Identifier{name}.Sanitize(), pgx.Identifier{template}.Sanitize())
+			if _, err := pool.Exec(ctx, query); err != nil {
+				return fmt.Errorf("creating database %s failed: %w", name, err)
+			}
+			fmt.Printf("Created database %s from template %s\n", name, template)
+			if err := registerObjects(ctx, pool, managedObject{Kind: "database", Name: name}); err != nil {
+				return err
+			}
+		}
+
+		if err := provisionTenantSchema(ctx, cfg, name, exists, fsys, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// provisionTenantSchema applies the schema files to the tenant database
+// name, unless it already has the schema.
+func provisionTenantSchema(ctx context.Context, cfg *InserterConfig, name string, existed bool, fsys fs.FS, files []string) error {
+	tenantPool, err := connectPool(tenantConfig(cfg, name))
+	if err != nil {
+		return fmt.Errorf("connecting to database %s failed: %w", name, err)
+	}
+	defer tenantPool.Close()
+
+	applied, err := tenantSchemaApplied(ctx, tenantPool)
+	if err != nil {
+		return fmt.Errorf("checking the schema of database %s failed: %w", name, err)
+	}
+	if applied {
+		fmt.Printf("Database %s already exists with its schema, skipping\n", name)
+		return nil
+	}
+	if existed {
+		fmt.Printf("Database %s exists without the schema, applying it\n", name)
+	}
+	if err := executeSqlFiles(ctx, tenantPool, fsys, files); err != nil {
+		return fmt.Errorf("applying schema to database %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// tenantConfig returns a copy of cfg pointing at another database.
+func tenantConfig(cfg *InserterConfig, database string) *InserterConfig {
+	c := *cfg
+	c.Database = database
+	return &c
+}
+
+// runTenantDatabaseWorkload inserts into the timestamp table of every tenant
+// database in turn, keeping one pool open per database.
+func runTenantDatabaseWorkload(ctx context.Context, cfg *InserterConfig) error {
+	names := tenantDatabaseNames(cfg)
+	pools := make([]*pgxpool.Pool, 0, len(names))
+	defer func() {
+		for _, p := range pools {
+			p.Close()
+		}
+	}()
+
+	for _, name := range names {
+		p, err := connectPool(tenantConfig(cfg, name))
+		if err != nil {
+			return fmt.Errorf("connecting to database %s failed: %w", name, err)
+		}
+		pools = append(pools, p)
+	}
+
+	execCtx, cancelExec := statementContext(ctx, drainTimeout(cfg))
+	defer cancelExec()
+
+	stats := newRunStats()
+	interval := time.Duration(cfg.TenantDatabases.EveryNSeconds) * time.Second
+	next := 0
+
+	fmt.Printf("Running round-robin workload across %d tenant databases...\n", len(pools))
+	engine := newWorkerEngine(ctx, stats, newRetryPolicy(cfg), nil)
+	engine.start(workerSpec{
+		name:        "timestamp",
+		description: "insert worker for table timestamp",
+		interval:    interval,
+		newTask: func(int) task {
+			return insertTask(1, func() error {
+				p := pools[next%len(pools)]
+				next++
+				_, err := p.Exec(execCtx, `INSERT INTO "timestamp"(created_at) VALUES (NOW())`)
+				return err
+			})
+		},
+	})
+	engine.wait()
+
+	fmt.Println(stats.summary())
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tenantSchemas returns the tenant schema names when multi-tenant mode is
+// enabled, e.g. tenant_001 ... tenant_010. It returns nil otherwise.
+func tenantSchemas(cfg *InserterConfig) []string {
+	if !cfg.MultiTenant.Enabled {
+		return nil
+	}
+	prefix := cfg.MultiTenant.SchemaPrefix
+	if prefix == "" {
+		prefix = "tenant_"
+	}
+	schemas := make([]string, cfg.MultiTenant.Tenants)
+	for i := range schemas {
+		schemas[i] = fmt.Sprintf("%s%03d", prefix, i+1)
+	}
+	return schemas
+}
+
+// workloadSchemas returns the schemas the insert workload is spread across.
+// The empty string stands for the connection's default search_path.
+func workloadSchemas(cfg *InserterConfig) []string {
+	if schemas := tenantSchemas(cfg); len(schemas) > 0 {
+		return schemas
+	}
+	return []string{""}
+}
+
+func pickSchema(r *rand.Rand, schemas []string) string {
+	return schemas[r.IntN(len(schemas))]
+}
+
+// qualifiedTable returns the quoted table name, prefixed with the schema
+// when one is given.
+func qualifiedTable(schema, table string) string {
+	if schema == "" {
+		return pgx.Identifier{table}.Sanitize()
+	}
+	return pgx.Identifier{schema, table}.Sanitize()
+}
+
+// applySqlFiles executes the SQL files once in the default schema or, in
+// multi-tenant mode, once in every tenant schema.
+func applySqlFiles(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, fsys fs.FS, sqlFiles []string) error {
+	schemas := tenantSchemas(cfg)
+	if len(schemas) == 0 {
+		return executeSqlFiles(ctx, pool, fsys, sqlFiles)
+	}
+	for _, schema := range schemas {
+		if err := executeSqlFilesInSchema(ctx, pool, schema, fsys, sqlFiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func executeSqlFilesInSchema(ctx context.Context, pool *pgxpool.Pool, schema string, fsys fs.FS, sqlFiles []string) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	ident := pgx.Identifier{schema}.Sanitize()
+	if _, err := conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+ident); err != nil {
+		return fmt.Errorf("creating schema %s failed: %w", schema, err)
+	}
+	if _, err := conn.Exec(ctx, "SET search_path TO "+ident); err != nil {
+		return fmt.Errorf("setting search_path to %s failed: %w", schema, err)
+	}
+	defer conn.Exec(context.Background(), "RESET search_path")
+
+	for _, file := range sqlFiles {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("error reading SQL file %s: %w", file, err)
+		}
+		if _, err := conn.Exec(ctx, string(content)); err != nil {
+			return fmt.Errorf("error executing SQL file %s in schema %s: %w", file, schema, err)
+		}
+		fmt.Printf("Executed SQL file %s in schema %s successfully.\n", file, schema)
+	}
+	return nil
+}
+
+func dropTenantSchemas(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	for _, schema := range tenantSchemas(cfg) {
+		if _, err := pool.Exec(ctx, "DROP SCHEMA IF EXISTS "+pgx.Identifier{schema}.Sanitize()+" CASCADE"); err != nil {
+			return fmt.Errorf("dropping schema %s failed: %w", schema, err)
+		}
+		fmt.Printf("Dropped schema %s (if existed)\n", schema)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// thinkTimeDistributions are the distributions of the think time of a
+// worker.
+var thinkTimeDistributions = []string{"fixed", "exponential"}
+
+// thinkTime is the pause of a worker after each statement, like the time a
+// user of a real application spends between two requests. The pause is
+// taken without holding a connection, so more workers share fewer busy
+// connections, as with real clients.
+type thinkTime struct {
+	// Distribution is fixed, which always pauses MeanMs, or exponential,
+	// which pauses MeanMs on average with many short and few long pauses.
+	Distribution string `json:"distribution"`
+	MeanMs       int    `json:"mean_ms"`
+	// MaxMs caps the pauses of the exponential distribution, zero does not
+	// cap them.
+	MaxMs int `json:"max_ms"`
+}
+
+func (t thinkTime) validate() error {
+	if t.Distribution != "" && !slices.Contains(thinkTimeDistributions, t.Distribution) {
+		return fmt.Errorf("invalid distribution '%s', must be one of %v", t.Distribution, thinkTimeDistributions)
+	}
+	if t.MeanMs < 0 || t.MaxMs < 0 {
+		return fmt.Errorf("mean_ms and max_ms must not be negative")
+	}
+	return nil
+}
+
+// delay returns the next pause.
+func (t thinkTime) delay() time.Duration {
+	mean := time.Duration(t.MeanMs) * time.Millisecond
+	if t.Distribution != "exponential" {
+		return mean
+	}
+	d := time.Duration(rand.ExpFloat64() * float64(mean))
+	if t.MaxMs > 0 {
+		d = min(d, time.Duration(t.MaxMs)*time.Millisecond)
+	}
+	return d
+}
+
+func (t thinkTime) String() string {
+	if t.Distribution == "exponential" {
+		return fmt.Sprintf("exponential, mean %dms", t.MeanMs)
+	}
+	return fmt.Sprintf("fixed %dms", t.MeanMs)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// hypertableColumns are the tables that can become hypertables with the
+// primary key column of the schema. Both are partitioned by created_at,
+// which setupTimescale adds to bigtable.
+var hypertableColumns = map[string]string{
+	"timestamp": "id",
+	"bigtable":  "bigtable_id",
+}
+
+// setupTimescale turns the configured tables into TimescaleDB hypertables
+// right after they are created. The time column has to be part of every
+// unique index of a hypertable, so the primary keys are extended with it.
+// The timestamp table gets device_id and value columns, written by the
+// timestamp inserter, to have something to compress and aggregate.
+func setupTimescale(ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool) error {
+	ts := cfg.TimescaleDB
+	if !ts.Enabled {
+		return nil
+	}
+	if _, err := pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS timescaledb"); err != nil {
+		return fmt.Errorf("creating extension timescaledb failed, it has to be in shared_preload_libraries: %w", err)
+	}
+	if err := registerObjects(ctx, pool, managedObject{Kind: "extension", Name: "timescaledb"}); err != nil {
+		return err
+	}
+	interval := ts.ChunkInterval
+	if interval == "" {
+		interval = "1 day"
+	}
+
+	for _, schema := range workloadSchemas(cfg) {
+		for _, name := range ts.Tables {
+			table := qualifiedTable(schema, name)
+			var steps []string
+			switch name {
+			case "timestamp":
+				steps = append(steps, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS device_id INT, ADD COLUMN IF NOT EXISTS value DOUBLE PRECISION`, table))
+			case "bigtable":
+				steps = append(steps, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`, table))
+			}
+			// A primary key without created_at is replaced, whatever its
+			// name, so running the setup again is a no-op.
+			steps = append(steps, fmt.Sprintf(`DO $$
+				DECLARE
+					pk name;
+				BEGIN
+					SELECT conname INTO pk FROM pg_constraint c
+					WHERE conrelid = %[1]s::regclass AND contype = 'p' AND NOT EXISTS (
+						SELECT 1 FROM pg_attribute WHERE attrelid = c.conrelid AND attnum = ANY(c.conkey) AND attname = 'created_at');
+					IF pk IS NOT NULL THEN
+						EXECUTE format('ALTER TABLE %%s DROP CONSTRAINT %%I, ADD PRIMARY KEY (%%I, created_at)', %[1]s, pk, %[2]s);
+					END IF;
+				END
+				$$`, quoteLiteral(table), quoteLiteral(hypertableColumns[name])))
+			steps = append(steps, fmt.Sprintf(`SELECT create_hypertable(%s, 'created_at', chunk_time_interval => INTERVAL %s,
+				if_not_exists => TRUE, migrate_data => TRUE)`, quoteLiteral(table), quoteLiteral(interval)))
+
+			for _, step := range steps {
+				if _, err := pool.Exec(ctx, step); err != nil {
+					return fmt.Errorf("turning %s into a hypertable failed: %w", table, err)
+				}
+			}
+			fmt.Printf("%s is a hypertable on created_at, chunks of %s\n", table, interval)
+		}
+	}
+	return nil
+}
+
+// validateHypertables checks that timescaledb.tables only lists tables that
+// can become hypertables.
+func validateHypertables(tables []string) error {
+	for _, table := range tables {
+		if _, ok := hypertableColumns[table]; !ok {
+			return fmt.Errorf("timescaledb.tables: table '%s' cannot be a hypertable, must be one of %v", table, hypertableNames())
+		}
+	}
+	return nil
+}
+
+func hypertableNames() []string {
+	names := make([]string, 0, len(hypertableColumns))
+	for name := range hypertableColumns {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+func validateTLS(cfg *InserterConfig) error {
+	if mode := cfg.TLS.SSLMode; mode != "" && !slices.Contains(sslModes, mode) {
+		return fmt.Errorf("invalid tls.sslmode '%s', must be one of %v", mode, sslModes)
+	}
+	if (cfg.TLS.ClientCert == "") != (cfg.TLS.ClientKey == "") {
+		return fmt.Errorf("tls.client_cert and tls.client_key must be set together")
+	}
+	return nil
+}
+
+// withTLSParams adds the configured TLS settings to a connection URL or a
+// key/value connection string, replacing the ones it already has. Without
+// TLS settings connStr is returned unchanged.
+func withTLSParams(connStr string, cfg *InserterConfig) (string, error) {
+	params := map[string]string{}
+	for param, value := range map[string]string{
+		"sslmode":     cfg.TLS.SSLMode,
+		"sslrootcert": cfg.TLS.RootCert,
+		"sslcert":     cfg.TLS.ClientCert,
+		"sslkey":      cfg.TLS.ClientKey,
+	} {
+		if value != "" {
+			params[param] = value
+		}
+	}
+	if len(params) == 0 {
+		return connStr, nil
+	}
+
+	if !strings.HasPrefix(connStr, "postgres://") && !strings.HasPrefix(connStr, "postgresql://") {
+		// The last occurrence of a key in a key/value string wins.
+		for _, param := range slices.Sorted(maps.Keys(params)) {
+			connStr += " " + param + "=" + conninfoValue(params[param])
+		}
+		return strings.TrimSpace(connStr), nil
+	}
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection url: %w", err)
+	}
+	query := u.Query()
+	for param, value := range params {
+		query.Set(param, value)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// setServerName verifies the server certificate against name instead of
+// the host connected to, e.g. when connecting through a proxy or by IP.
+func setServerName(poolCfg *pgxpool.Config, name string) {
+	conn := poolCfg.ConnConfig
+	if conn.TLSConfig != nil {
+		conn.TLSConfig.ServerName = name
+	}
+	for _, fallback := range conn.Fallbacks {
+		if fallback.TLSConfig != nil {
+			fallback.TLSConfig.ServerName = name
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestWithTLSParams(t *testing.T) {
+	tests := []struct {
+		name, connStr, sslMode, want string
+	}{
+		{"url without tls", "postgres://u@db/x?connect_timeout=3", "", "postgres://u@db/x?connect_timeout=3"},
+		{"key/value without tls", "host=db dbname=x user=u", "", "host=db dbname=x user=u"},
+		{"url with sslmode", "postgres://u@db/x?sslmode=disable", "require", "postgres://u@db/x?sslmode=require"},
+		{"key/value with sslmode", "host=db dbname=x user=u sslmode=disable", "require", "host=db dbname=x user=u sslmode=disable sslmode='require'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &InserterConfig{}
+			cfg.TLS.SSLMode = tt.sslMode
+			got, err := withTLSParams(tt.connStr, cfg)
+			if err != nil {
+				t.Fatalf("withTLSParams(%q): %v", tt.connStr, err)
+			}
+			if got != tt.want {
+				t.Errorf("withTLSParams(%q) = %q, want %q", tt.connStr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTLSParamsKeyValueParses(t *testing.T) {
+	cfg := &InserterConfig{}
+	cfg.TLS.SSLMode = "disable"
+	connStr, err := withTLSParams("host=db dbname=x user=u sslmode=require", cfg)
+	if err != nil {
+		t.Fatalf("withTLSParams: %v", err)
+	}
+	poolCfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		t.Fatalf("parsing %q failed: %v", connStr, err)
+	}
+	conn := poolCfg.ConnConfig
+	if conn.Host != "db" || conn.Database != "x" || conn.User != "u" || conn.TLSConfig != nil {
+		t.Errorf("got host %q database %q user %q tls %v", conn.Host, conn.Database, conn.User, conn.TLSConfig != nil)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ttlTable holds the rows of the TTL workload, which expire expires_at
+// after their insert.
+const ttlTable = "demo_db_ttl"
+
+// setupTTL creates the TTL table. Expiring is two steps, as in many
+// applications: rows are first marked expired, which takes them out of the
+// partial index of unexpired rows, and deleted after a grace period. Each
+// step finds its rows through its own partial index, so neither scans the
+// live rows.
+func setupTTL(ctx context.Context, pool *pgxpool.Pool, schemas []string) error {
+	for _, schema := range schemas {
+		table := qualifiedTable(schema, ttlTable)
+		steps := []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+				session_key TEXT NOT NULL,
+				data TEXT,
+				expires_at TIMESTAMPTZ NOT NULL,
+				expired BOOLEAN NOT NULL DEFAULT false
+			)`, table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS demo_db_ttl_unexpired_idx ON %s (expires_at) WHERE NOT expired`, table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS demo_db_ttl_expired_idx ON %s (expires_at) WHERE expired`, table),
+		}
+		for _, step := range steps {
+			if _, err := pool.Exec(ctx, step); err != nil {
+				return fmt.Errorf("creating TTL table failed: %w", err)
+			}
+		}
+		if err := registerObjects(ctx, pool, managedObject{Kind: "table", Schema: schema, Name: ttlTable}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeStats aggregates the batches of a purge step.
+type purgeStats struct {
+	mu          sync.Mutex
+	batches     int64
+	rows        int64
+	maxRows     int64
+	total       time.Duration
+	maxDuration time.Duration
+}
+
+func (p *purgeStats) add(rows int64, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches++
+	p.rows += rows
+	p.maxRows = max(p.maxRows, rows)
+	p.total += d
+	p.maxDuration = max(p.maxDuration, d)
+}
+
+func (p *purgeStats) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.batches == 0 {
+		return "no batches"
+	}
+	return fmt.Sprintf("%d batches, %d rows, avg %.0f rows/batch, max %d, avg %s/batch, max %s",
+		p.batches, p.rows, float64(p.rows)/float64(p.batches), p.maxRows,
+		(p.total / time.Duration(p.batches)).Round(time.Microsecond), p.maxDuration.Round(time.Microsecond))
+}
+
+// ttlWorkload inserts rows with an expiry and expires and purges them in
+// batches.
+type ttlWorkload struct {
+	pool      *pgxpool.Pool
+	schemas   []string
+	label     string
+	ttl       time.Duration
+	grace     time.Duration
+	batchSize int
+	expired   purgeStats
+	purged    purgeStats
+}
+
+// insertTask returns a task inserting a row expiring after the TTL, give or
+// take half of it.
+func (t *ttlWorkload) insertTask(ctx context.Context, r *rand.Rand) task {
+	return insertTask(1, func() error {
+		ttl := time.Duration(float64(t.ttl) * (0.5 + r.Float64()))
+		_, err := t.pool.Exec(ctx, t.label+fmt.Sprintf(`INSERT INTO %s (session_key, data, expires_at)
+			VALUES ($1, $2, NOW() + make_interval(secs => $3))`, qualifiedTable(pickSchema(r, t.schemas), ttlTable)),
+			GenerateRandomString(r, 32), GenerateRandomString(r, 200), ttl.Seconds())
+		return err
+	})
+}
+
+// expireTask returns a task marking one batch of rows past their expiry as
+// expired in every schema.
+func (t *ttlWorkload) expireTask(ctx context.Context) task {
+	return func() (outcome, error) {
+		result := outcome{name: "ttl_expire"}
+		for _, schema := range t.schemas {
+			table := qualifiedTable(schema, ttlTable)
+			started := time.Now()
+			tag, err := t.pool.Exec(ctx, t.label+fmt.Sprintf(`UPDATE %[1]s SET expired = true WHERE id IN (
+				SELECT id FROM %[1]s WHERE NOT expired AND expires_at < NOW() ORDER BY expires_at LIMIT $1)`, table), t.batchSize)
+			if err != nil {
+				return result, err
+			}
+			t.expired.add(tag.RowsAffected(), time.Since(started))
+			result.updated += tag.RowsAffected()
+		}
+		return result, nil
+	}
+}
+
+// purgeTask returns a task deleting one batch of rows expired for longer
+// than the grace period in every schema.
+func (t *ttlWorkload) purgeTask(ctx context.Context) task {
+	return func() (outcome, error) {
+		result := outcome{name: "ttl_purge"}
+		for _, schema := range t.schemas {
+			table := qualifiedTable(schema, ttlTable)
+			started := time.Now()
+			tag, err := t.pool.Exec(ctx, t.label+fmt.Sprintf(`DELETE FROM %[1]s WHERE id IN (
+				SELECT id FROM %[1]s WHERE expired AND expires_at < NOW() - make_interval(secs => $2) ORDER BY expires_at LIMIT $1)`, table),
+				t.batchSize, t.grace.Seconds())
+			if err != nil {
+				return result, err
+			}
+			t.purged.add(tag.RowsAffected(), time.Since(started))
+			result.deleted += tag.RowsAffected()
+		}
+		return result, nil
+	}
+}
+
+// startTTLWorkload starts the insert, expire and purge workers of the TTL
+// workload.
+func startTTLWorkload(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, schemas []string, seed uint64, label string) *ttlWorkload {
+	settings := cfg.Inserter.TTL
+	t := &ttlWorkload{
+		pool:      pool,
+		schemas:   schemas,
+		label:     label,
+		ttl:       time.Duration(settings.TTLSeconds) * time.Second,
+		grace:     time.Duration(settings.GraceSeconds) * time.Second,
+		batchSize: settings.PurgeBatchSize,
+	}
+	if t.ttl <= 0 {
+		t.ttl = 5 * time.Minute
+	}
+	if t.batchSize <= 0 {
+		t.batchSize = 1000
+	}
+	interval := time.Duration(settings.PurgeEveryNSeconds) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	e.start(workerSpec{
+		name:        "ttl",
+		description: fmt.Sprintf("insert worker for %s, rows expiring after about %s", ttlTable, t.ttl),
+		concurrency: settings.Workers,
+		limiter:     newRateLimiter(settings.RatePerSecond),
+		newTask: func(i int) task {
+			return t.insertTask(ctx, newRand(seed, fmt.Sprintf("ttl-worker-%d", i+1)))
+		},
+	})
+	e.start(workerSpec{
+		name:        "ttl_expire",
+		description: fmt.Sprintf("expire worker for %s, batches of %d rows every %s", ttlTable, t.batchSize, interval),
+		interval:    interval,
+		newTask:     func(int) task { return t.expireTask(ctx) },
+	})
+	e.start(workerSpec{
+		name:        "ttl_purge",
+		description: fmt.Sprintf("purge worker for %s, batches of %d rows every %s", ttlTable, t.batchSize, interval),
+		interval:    interval,
+		newTask:     func(int) task { return t.purgeTask(ctx) },
+	})
+	return t
+}
+
+// report prints the purge batches and the backlog and sizes of the TTL
+// table: a growing backlog means the purge falls behind the inserts.
+func (t *ttlWorkload) report(ctx context.Context) error {
+	fmt.Println("TTL report:")
+	fmt.Printf("  expire: %s\n", &t.expired)
+	fmt.Printf("  purge:  %s\n", &t.purged)
+	for _, schema := range t.schemas {
+		table := qualifiedTable(schema, ttlTable)
+		var live, overdue, expired, tableBytes, unexpiredIdx, expiredIdx int64
+		err := t.pool.QueryRow(ctx, fmt.Sprintf(`SELECT
+				count(*) FILTER (WHERE NOT expired AND expires_at >= NOW()),
+				count(*) FILTER (WHERE NOT expired AND expires_at < NOW()),
+				count(*) FILTER (WHERE expired),
+				pg_table_size($1::regclass),
+				pg_relation_size(to_regclass($2)), pg_relation_size(to_regclass($3))
+			FROM %s`, table), table, qualifiedTable(schema, "demo_db_ttl_unexpired_idx"), qualifiedTable(schema, "demo_db_ttl_expired_idx")).
+			Scan(&live, &overdue, &expired, &tableBytes, &unexpiredIdx, &expiredIdx)
+		if err != nil {
+			return fmt.Errorf("reading TTL backlog of %s failed: %w", table, err)
+		}
+		fmt.Printf("  %-20s live=%d overdue=%d expired=%d table=%s unexpired_idx=%s expired_idx=%s\n", table, live, overdue, expired,
+			formatBytes(tableBytes), formatBytes(unexpiredIdx), formatBytes(expiredIdx))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// preparedTable holds the rows inserted by the prepared transactions.
+const preparedTable = "demo_db_prepared"
+
+// setupPreparedTransactions creates the table of the prepared transaction
+// workload, after checking that the server allows prepared transactions.
+func setupPreparedTransactions(ctx context.Context, pool *pgxpool.Pool) error {
+	var allowed string
+	if err := pool.QueryRow(ctx, `SHOW max_prepared_transactions`).Scan(&allowed); err != nil {
+		return fmt.Errorf("reading max_prepared_transactions failed: %w", err)
+	}
+	if allowed == "0" {
+		return fmt.Errorf("max_prepared_transactions is 0, the server does not allow prepared transactions")
+	}
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS demo_db_prepared (
+		id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+		gid TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now())`)
+	if err != nil {
+		return fmt.Errorf("creating %s failed: %w", preparedTable, err)
+	}
+	return registerObjects(ctx, pool, managedObject{Kind: "table", Name: preparedTable})
+}
+
+// preparedTransactions runs transactions in two phases like a transaction
+// manager would: the first phase inserts a row and prepares the
+// transaction, the second commits or rolls it back later, possibly from
+// another session. Leaked transactions are never finished, like those of a
+// crashed coordinator; they hold their locks, keep back the xmin horizon
+// and use up max_prepared_transactions until someone rolls them back.
+type preparedTransactions struct {
+	pool            *pgxpool.Pool
+	label           string
+	runID           string
+	hold            time.Duration
+	rollbackPercent int
+	leakPercent     int
+
+	sequence   atomic.Int64
+	prepared   atomic.Int64
+	committed  atomic.Int64
+	rolledBack atomic.Int64
+	leaked     atomic.Int64
+}
+
+// prepare inserts a row in a new transaction and prepares it as gid.
+func (p *preparedTransactions) prepare(ctx context.Context, gid string) error {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	for _, step := range []string{
+		`BEGIN`,
+		p.label + `INSERT INTO demo_db_prepared (gid) VALUES (` + quoteLiteral(gid) + `)`,
+		`PREPARE TRANSACTION ` + quoteLiteral(gid),
+	} {
+		if _, err := conn.Exec(ctx, step); err != nil {
+			conn.Exec(context.Background(), `ROLLBACK`)
+			return err
+		}
+	}
+	return nil
+}
+
+// finish commits or rolls back the prepared transaction gid.
+func (p *preparedTransactions) finish(ctx context.Context, gid string, commit bool) error {
+	statement := `ROLLBACK PREPARED `
+	if commit {
+		statement = `COMMIT PREPARED `
+	}
+	if _, err := p.pool.Exec(ctx, p.label+statement+quoteLiteral(gid)); err != nil {
+		return fmt.Errorf("finishing prepared transaction %s failed: %w", gid, err)
+	}
+	if commit {
+		p.committed.Add(1)
+	} else {
+		p.rolledBack.Add(1)
+	}
+	return nil
+}
+
+// task returns a task running one transaction in two phases, with the
+// hold time in between.
+func (p *preparedTransactions) task(ctx context.Context, r *rand.Rand) task {
+	return func() (outcome, error) {
+		result := outcome{name: "prepared_transactions"}
+		gid := preparedTxPrefix + p.runID + "_" + strconv.FormatInt(p.sequence.Add(1), 10)
+		if err := p.prepare(ctx, gid); err != nil {
+			return result, err
+		}
+		p.prepared.Add(1)
+
+		if r.IntN(100) < p.leakPercent {
+			p.leaked.Add(1)
+			fmt.Printf("Leaked prepared transaction %s\n", gid)
+			return result, nil
+		}
+		commit := r.IntN(100) >= p.rollbackPercent
+		if !sleep(ctx, p.hold) {
+			// Stopping must not leak the transactions not meant to leak.
+			return result, p.finish(context.WithoutCancel(ctx), gid, commit)
+		}
+		if err := p.finish(ctx, gid, commit); err != nil {
+			return result, err
+		}
+		if commit {
+			result.inserted = 1
+		}
+		return result, nil
+	}
+}
+
+// startPreparedTransactions starts the workers of the prepared transaction
+// workload.
+func startPreparedTransactions(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, runID string, seed uint64, label string) *preparedTransactions {
+	settings := cfg.Inserter.PreparedTransactions
+	p := &preparedTransactions{
+		pool:            pool,
+		label:           label,
+		runID:           runID,
+		hold:            time.Duration(settings.HoldMs) * time.Millisecond,
+		rollbackPercent: settings.RollbackPercent,
+		leakPercent:     settings.LeakPercent,
+	}
+	if p.hold <= 0 {
+		p.hold = time.Second
+	}
+	e.start(workerSpec{
+		name:        "prepared_transactions",
+		description: "prepared transaction worker",
+		concurrency: settings.Workers,
+		limiter:     newRateLimiter(settings.RatePerSecond),
+		newTask: func(i int) task {
+			return p.task(ctx, newRand(workerSeed(seed, i), "prepared_transactions"))
+		},
+	})
+	return p
+}
+
+// report prints how the prepared transactions ended and how many prepared
+// transactions of the tool are still open on the server.
+func (p *preparedTransactions) report(ctx context.Context) error {
+	fmt.Println("Prepared transaction report:")
+	fmt.Printf("  %d prepared, %d committed, %d rolled back, %d leaked\n",
+		p.prepared.Load(), p.committed.Load(), p.rolledBack.Load(), p.leaked.Load())
+	var open int64
+	var oldest float64
+	err := p.pool.QueryRow(ctx, `SELECT count(*), COALESCE(extract(epoch FROM max(now() - prepared)), 0)::float8 FROM pg_prepared_xacts
+		WHERE database = current_database() AND starts_with(gid, $1)`, preparedTxPrefix).Scan(&open, &oldest)
+	if err != nil {
+		return fmt.Errorf("counting prepared transactions failed: %w", err)
+	}
+	if open > 0 {
+		fmt.Printf("  %d prepared transactions still open, the oldest for %s; demo-db cleanup rolls them back\n",
+			open, time.Duration(oldest*float64(time.Second)).Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// checkWalSwitchPermissions verifies that pg_switch_wal() can be called by
+// the configured user, so a missing privilege is reported once up front
+// instead of on every tick.
+func checkWalSwitchPermissions(ctx context.Context, pool *pgxpool.Pool) error {
+	var inRecovery, canExecute bool
+	err := pool.QueryRow(ctx, `SELECT pg_is_in_recovery(), has_function_privilege('pg_switch_wal()', 'EXECUTE')`).Scan(&inRecovery, &canExecute)
+	if err != nil {
+		return fmt.Errorf("checking pg_switch_wal() permissions failed: %w", err)
+	}
+	if inRecovery {
+		return fmt.Errorf("pg_switch_wal() cannot be executed during recovery, the target is a standby")
+	}
+	if !canExecute {
+		return fmt.Errorf("current user may not execute pg_switch_wal(), connect as a superuser or run: GRANT EXECUTE ON FUNCTION pg_switch_wal() TO <user>")
+	}
+	return nil
+}
+
+// startWalSwitcher forces a WAL segment switch every interval, which makes
+// the server archive a segment even when there is little write activity.
+func startWalSwitcher(e *workerEngine, execCtx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+
+	fmt.Printf("Starting WAL switcher, switching every %s ...\n", interval)
+	e.start(workerSpec{
+		name:        "wal_switcher",
+		description: "WAL switcher",
+		interval:    interval,
+		delay:       interval,
+		newTask: func(int) task {
+			return func() (outcome, error) {
+				var lsn string
+				if err := pool.QueryRow(execCtx, `SELECT pg_switch_wal()::text`).Scan(&lsn); err != nil {
+					return outcome{}, err
+				}
+				fmt.Printf("Switched WAL segment at %s\n", lsn)
+				return outcome{}, nil
+			}
+		},
+	})
+}
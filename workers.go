@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// outcome is what one run of a task did. It is recorded in the run
+// statistics under name, or under the name of the worker when empty.
+type outcome struct {
+	name                       string
+	inserted, updated, deleted int64
+	read                       bool
+}
+
+// task runs one unit of work of a worker. The outcome name is also used to
+// record errors, so it may be set when err is not nil.
+type task func() (outcome, error)
+
+// errWorkDone is returned by a task whose worker has nothing left to do,
+// e.g. a bulk loader that loaded its rows. The worker stops without
+// recording an error.
+var errWorkDone = errors.New("work done")
+
+// insertTask returns a task recording the given number of inserted rows
+// for every successful call of fn.
+func insertTask(rows int, fn func() error) task {
+	return func() (outcome, error) {
+		if err := fn(); err != nil {
+			return outcome{}, err
+		}
+		return outcome{inserted: int64(rows)}, nil
+	}
+}
+
+// batchTask returns a task running fn, which inserts a batch and returns
+// the number of rows inserted, fewer than the batch when rows were
+// rejected.
+func batchTask(fn func() (int, error)) task {
+	return func() (outcome, error) {
+		rows, err := fn()
+		if err != nil {
+			return outcome{}, err
+		}
+		return outcome{inserted: int64(rows)}, nil
+	}
+}
+
+// workerSpec describes a worker run by the engine.
+type workerSpec struct {
+	// name is the key of the worker in the statistics, row targets and the
+	// persisted scheduler state.
+	name string
+	// description is used in messages, e.g. "insert worker for table album".
+	description string
+	// concurrency is the number of goroutines running the task, at least one.
+	concurrency int
+	// interval is the pause between runs of a goroutine. Interval based
+	// schedules are persisted in the scheduler store; zero runs back to back.
+	interval time.Duration
+	// delay is the pause of a goroutine before its first run, unless the
+	// scheduler store has a later run to resume from.
+	delay time.Duration
+	// think is the pause of a goroutine after each run, on top of the
+	// interval.
+	think thinkTime
+	// limiter caps the rate of runs over all goroutines, nil does not limit.
+	limiter *rateLimiter
+	// newTask returns the task of goroutine i, which may keep state such as
+	// its own random generator since it is never called concurrently.
+	newTask func(i int) task
+}
+
+// workerEngine runs workers until ctx is done, taking care of rate limits,
+// schedules, retries, statistics and row targets for all workloads.
+type workerEngine struct {
+	ctx   context.Context
+	wg    sync.WaitGroup
+	stats *runStats
+	retry retryPolicy
+	store *schedulerStore
+
+	// startAfter maps a worker name to the workers it waits for and the
+	// number of rows they have to insert first, zero waits until they stop.
+	startAfter map[string]map[string]uint64
+	// tables restricts the workers of demo tables to the listed ones when
+	// set. Workers not named after a demo table, like reads, always run.
+	tables []string
+	// workers overrides the concurrency and interval of the workers of
+	// demo tables.
+	workers map[string]tableWorkers
+	// thinkTimes sets the think time of workers by name, or of all workers
+	// without their own entry under "default".
+	thinkTimes map[string]thinkTime
+
+	mu      sync.Mutex
+	running map[string]int
+	ready   bool
+	// controls pause the workers and override their rate by name, for
+	// the control API.
+	controls map[string]*workerControl
+}
+
+func newWorkerEngine(ctx context.Context, stats *runStats, retry retryPolicy, store *schedulerStore) *workerEngine {
+	return &workerEngine{ctx: ctx, stats: stats, retry: retry, store: store, running: map[string]int{}, controls: map[string]*workerControl{}}
+}
+
+// selected reports whether workers named name are part of the run.
+func (e *workerEngine) selected(name string) bool {
+	return len(e.tables) == 0 || !slices.Contains(demoTables, name) || slices.Contains(e.tables, name)
+}
+
+// start launches the goroutines of spec, unless its table is not selected.
+func (e *workerEngine) start(spec workerSpec) {
+	if !e.selected(spec.name) {
+		return
+	}
+	if spec.description == "" {
+		spec.description = "worker for " + spec.name
+	}
+	if w, ok := e.workers[spec.name]; ok {
+		if w.Workers > 0 {
+			spec.concurrency = w.Workers
+		}
+		if w.IntervalMs > 0 {
+			spec.interval = time.Duration(w.IntervalMs) * time.Millisecond
+		}
+	}
+	if t, ok := e.thinkTimes[spec.name]; ok {
+		spec.think = t
+	} else if t, ok := e.thinkTimes["default"]; ok {
+		spec.think = t
+	}
+	e.mu.Lock()
+	if e.controls[spec.name] == nil {
+		e.controls[spec.name] = newWorkerControl(spec.limiter)
+	}
+	control := e.controls[spec.name]
+	e.mu.Unlock()
+	concurrency := max(spec.concurrency, 1)
+	for i := range concurrency {
+		key := spec.name
+		if concurrency > 1 {
+			key = fmt.Sprintf("%s-%d", spec.name, i+1)
+		}
+		run := spec.newTask(i)
+		e.mu.Lock()
+		e.running[spec.name]++
+		e.mu.Unlock()
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			defer func() {
+				e.mu.Lock()
+				e.running[spec.name]--
+				e.mu.Unlock()
+			}()
+			if !e.waitForDependencies(spec) {
+				return
+			}
+			fmt.Printf("Starting %s ...\n", spec.description)
+			e.run(spec, control, key, run)
+			fmt.Printf("Shutting down %s\n", spec.description)
+		}()
+	}
+}
+
+// started is called once all workers were started, so that dependencies
+// on workers that are not part of the run can be told apart from the ones
+// that were not started yet.
+func (e *workerEngine) started() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ready = true
+	for name, deps := range e.startAfter {
+		if _, ok := e.running[name]; !ok {
+			continue
+		}
+		for dep := range deps {
+			if _, ok := e.running[dep]; !ok {
+				fmt.Printf("Error: %s waits for %s, which has no worker in this run, ignoring\n", name, dep)
+			}
+		}
+	}
+}
+
+// ran reports whether workers named name were started in this run.
+func (e *workerEngine) ran(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.running[name]
+	return ok
+}
+
+// finished reports whether all workers named name have stopped, or never
+// ran.
+func (e *workerEngine) finished(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ready && e.running[name] == 0
+}
+
+// waitForDependencies blocks until the workers spec depends on reached
+// their row thresholds or stopped, and reports false if ctx is done first.
+func (e *workerEngine) waitForDependencies(spec workerSpec) bool {
+	deps := e.startAfter[spec.name]
+	for dep, rows := range deps {
+		waiting := false
+		for {
+			if e.finished(dep) || rows > 0 && e.stats.table(dep).inserts.Load() >= rows {
+				break
+			}
+			if !waiting {
+				if rows > 0 {
+					fmt.Printf("%s waits for %d rows in %s\n", spec.description, rows, dep)
+				} else {
+					fmt.Printf("%s waits for the workers of %s to finish\n", spec.description, dep)
+				}
+				waiting = true
+			}
+			if !sleep(e.ctx, 250*time.Millisecond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// wait blocks until all workers have stopped.
+func (e *workerEngine) wait() {
+	e.wg.Wait()
+}
+
+func (e *workerEngine) run(spec workerSpec, control *workerControl, key string, run task) {
+	ctx, stats := e.ctx, e.stats
+	var inserted uint64
+	failures := 0
+
+	delay := spec.delay
+	if spec.interval > 0 {
+		lastRun, rowsInserted, err := e.store.load(ctx, key)
+		if err != nil {
+			fmt.Printf("Error loading scheduler state for %s: %v\n", key, err)
+		}
+		inserted = rowsInserted
+		if !lastRun.IsZero() {
+			if delay = resumeDelay(lastRun, spec.interval); delay > 0 {
+				fmt.Printf("Resuming schedule for %s in %s\n", key, delay.Round(time.Second))
+			}
+		}
+	}
+	if delay > 0 && !sleep(ctx, delay) {
+		return
+	}
+
+	for {
+		if !control.wait(ctx) {
+			return
+		}
+		if err := control.currentLimiter().wait(ctx); err != nil {
+			return
+		}
+
+		start := time.Now()
+		o, err := run()
+		name := o.name
+		if name == "" {
+			name = spec.name
+		}
+		if errors.Is(err, errWorkDone) {
+			return
+		}
+		if err != nil {
+			if o.read {
+				stats.recordReadError(name)
+			} else {
+				stats.recordError(name)
+			}
+			failures++
+			if !e.retry.retry(ctx, spec.description, failures, err) {
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		latency := time.Since(start)
+		if o.read {
+			stats.recordRead(name, latency)
+		}
+		if o.inserted > 0 {
+			stats.recordBatch(name, o.inserted, latency)
+		}
+		if o.updated > 0 {
+			stats.recordUpdate(name, o.updated, latency)
+		}
+		if o.deleted > 0 {
+			stats.recordDelete(name, o.deleted, latency)
+		}
+
+		if o.inserted > 0 {
+			before := inserted
+			inserted += uint64(o.inserted)
+			if inserted/1000 > before/1000 && !stats.quiet {
+				fmt.Printf("Inserted %d rows into table %s\n", inserted, name)
+			}
+			if stats.targetReached(name) {
+				fmt.Printf("Target of %d rows reached for table %s\n", stats.targets[name], name)
+				return
+			}
+		}
+
+		if d := spec.think.delay(); d > 0 && !sleep(ctx, d) {
+			return
+		}
+		if spec.interval > 0 {
+			if err := e.store.save(context.WithoutCancel(ctx), key, time.Now(), inserted); err != nil {
+				fmt.Printf("Error saving scheduler state for %s: %v\n", key, err)
+			}
+			if !sleep(ctx, spec.interval) {
+				return
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// workMemOperations are the operations of the work_mem stress workload,
+// each spilling to temporary files once its input exceeds work_mem.
+var workMemOperations = []string{"sort", "hash_aggregate", "hash_join"}
+
+// workMemQueries are the queries of the operations over the temporary table.
+var workMemQueries = map[string]string{
+	"sort":           `SELECT id FROM demo_db_work_mem ORDER BY payload OFFSET $1`,
+	"hash_aggregate": `SELECT count(*) FROM (SELECT payload, count(*) FROM demo_db_work_mem GROUP BY payload) g`,
+	"hash_join":      `SELECT count(*) FROM demo_db_work_mem a JOIN demo_db_work_mem b USING (payload)`,
+}
+
+// workMemStress fills a temporary table and runs a large sort, hash
+// aggregation or hash join over it, which spill to temporary files when
+// work_mem is too small. The temporary files show up in
+// pg_stat_database.temp_files and, with log_temp_files, in the server log.
+type workMemStress struct {
+	pool       *pgxpool.Pool
+	label      string
+	rows       int
+	rowBytes   int
+	workMem    string
+	operations []string
+
+	runs       atomic.Int64
+	tempFiles  int64
+	tempBytes  int64
+	operationN map[string]*atomic.Int64
+}
+
+// tempFileStats returns the temporary files and bytes written in the
+// current database so far.
+func tempFileStats(ctx context.Context, pool *pgxpool.Pool) (files, bytes int64, err error) {
+	err = pool.QueryRow(ctx, `SELECT temp_files, temp_bytes FROM pg_stat_database WHERE datname = current_database()`).Scan(&files, &bytes)
+	return files, bytes, err
+}
+
+// task returns a task running one operation, in a transaction that drops
+// the temporary table at its end.
+func (w *workMemStress) task(ctx context.Context, r *rand.Rand) task {
+	return func() (outcome, error) {
+		result := outcome{name: "work_mem_stress", read: true}
+		operation := w.operations[r.IntN(len(w.operations))]
+		err := pgx.BeginFunc(ctx, w.pool, func(tx pgx.Tx) error {
+			if w.workMem != "" {
+				if _, err := tx.Exec(ctx, `SELECT set_config('work_mem', $1, true)`, w.workMem); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(ctx, `CREATE TEMP TABLE demo_db_work_mem (id INT, payload TEXT) ON COMMIT DROP`)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, w.label+`INSERT INTO demo_db_work_mem
+				SELECT g, left(repeat(md5(random()::text), $2::int / 32 + 1), $2::int) FROM generate_series(1, $1::int) g`, w.rows, w.rowBytes)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `ANALYZE demo_db_work_mem`); err != nil {
+				return err
+			}
+			if operation == "sort" {
+				_, err = tx.Exec(ctx, w.label+workMemQueries[operation], w.rows)
+			} else {
+				_, err = tx.Exec(ctx, w.label+workMemQueries[operation])
+			}
+			return err
+		})
+		if err != nil {
+			return result, fmt.Errorf("%s over %d rows failed: %w", operation, w.rows, err)
+		}
+		w.runs.Add(1)
+		w.operationN[operation].Add(1)
+		return result, nil
+	}
+}
+
+// startWorkMemStress starts the workers of the work_mem stress workload.
+func startWorkMemStress(e *workerEngine, ctx context.Context, cfg *InserterConfig, pool *pgxpool.Pool, seed uint64, label string) *workMemStress {
+	settings := cfg.Inserter.WorkMemStress
+	w := &workMemStress{
+		pool:       pool,
+		label:      label,
+		rows:       settings.Rows,
+		rowBytes:   settings.RowBytes,
+		workMem:    settings.WorkMem,
+		operations: settings.Operations,
+		operationN: map[string]*atomic.Int64{},
+	}
+	if w.rows <= 0 {
+		w.rows = 1_000_000
+	}
+	if w.rowBytes <= 0 {
+		w.rowBytes = 100
+	}
+	if len(w.operations) == 0 {
+		w.operations = workMemOperations
+	}
+	for _, operation := range workMemOperations {
+		w.operationN[operation] = &atomic.Int64{}
+	}
+	var err error
+	if w.tempFiles, w.tempBytes, err = tempFileStats(ctx, pool); err != nil {
+		fmt.Println("Error reading temporary file statistics:", err)
+	}
+	e.start(workerSpec{
+		name:        "work_mem_stress",
+		description: "work_mem stress worker",
+		concurrency: settings.Workers,
+		limiter:     newRateLimiter(settings.RatePerSecond),
+		newTask: func(i int) task {
+			return w.task(ctx, newRand(workerSeed(seed, i), "work_mem_stress"))
+		},
+	})
+	return w
+}
+
+// report prints the operations run and the temporary files written by the
+// database meanwhile, which includes those of other sessions.
+func (w *workMemStress) report(ctx context.Context) error {
+	files, bytes, err := tempFileStats(ctx, w.pool)
+	if err != nil {
+		return fmt.Errorf("reading temporary file statistics failed: %w", err)
+	}
+	fmt.Println("work_mem stress report:")
+	for _, operation := range workMemOperations {
+		if n := w.operationN[operation].Load(); n > 0 {
+			fmt.Printf("  %-15s %d runs over %d rows of %d bytes\n", operation, n, w.rows, w.rowBytes)
+		}
+	}
+	fmt.Printf("  temporary files written by the database: %d, %s\n", files-w.tempFiles, formatBytes(bytes-w.tempBytes))
+	if w.runs.Load() > 0 && files == w.tempFiles {
+		fmt.Println("  nothing spilled to disk, work_mem is large enough for these sizes")
+	}
+	return nil
+}